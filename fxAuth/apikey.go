@@ -0,0 +1,61 @@
+package fxauth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/labstack/echo/v4"
+)
+
+// APIKeyAuthenticator authenticates requests carrying a static API key header
+type APIKeyAuthenticator struct {
+	header string
+	keys   map[[sha256.Size]byte]APIKey
+}
+
+// NewAPIKeyAuthenticator creates an API key authenticator for the configured keys
+func NewAPIKeyAuthenticator(config APIKeyConfig) (*APIKeyAuthenticator, error) {
+	a := &APIKeyAuthenticator{
+		header: config.Header,
+		keys:   make(map[[sha256.Size]byte]APIKey, len(config.Keys)),
+	}
+	for _, k := range config.Keys {
+		if k.Subject == "" {
+			return nil, fmt.Errorf("api key entries require key and subject")
+		}
+		if k.Key == "" {
+			// Usually an unset environment variable in the config
+			return nil, fmt.Errorf("api key of %s is empty", k.Subject)
+		}
+		// Keys are looked up by digest so comparison time does not depend
+		// on how much of the presented key matches
+		a.keys[sha256.Sum256([]byte(k.Key))] = k
+	}
+	return a, nil
+}
+
+// Challenge implements Authenticator
+func (a *APIKeyAuthenticator) Challenge() string {
+	return fmt.Sprintf(`ApiKey header=%q`, a.header)
+}
+
+// Authenticate implements Authenticator
+func (a *APIKeyAuthenticator) Authenticate(c echo.Context) (*Principal, error) {
+	presented := c.Request().Header.Get(a.header)
+	if presented == "" {
+		return nil, ErrNoCredentials
+	}
+
+	key, ok := a.keys[sha256.Sum256([]byte(presented))]
+	if !ok {
+		return nil, errors.New("unknown api key")
+	}
+
+	return &Principal{
+		ID:     key.Subject,
+		Method: MethodAPIKey,
+		Scopes: key.Scopes,
+		Roles:  key.Roles,
+	}, nil
+}
@@ -0,0 +1,269 @@
+package fxauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	fxConfig "github.com/UTOL-s/module/fxConfig"
+	fxEcho "github.com/UTOL-s/module/fxEcho"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestEcho(authenticators ...Authenticator) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = fxEcho.NewErrorHandler(fxEcho.ErrorHandlerParams{Logger: zap.NewNop()}).Handle
+	e.Use(Middleware(authenticators...))
+
+	whoami := func(c echo.Context) error {
+		p, _ := GetPrincipal(c)
+		return c.String(http.StatusOK, p.ID)
+	}
+	for _, r := range []fxEcho.RouteRegistryIf{
+		fxEcho.GET("/me", whoami).RequireScopes("profile").Build(),
+		fxEcho.GET("/admin", whoami).RequireRole("admin").Build(),
+	} {
+		e.Add(r.Method(), r.Path(), r.Handle)
+	}
+	return e
+}
+
+func serve(e *echo.Echo, path string, setup func(r *http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if setup != nil {
+		setup(req)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func bearer(token string) func(r *http.Request) {
+	return func(r *http.Request) {
+		r.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+}
+
+func TestJWTAuthenticatorHMAC(t *testing.T) {
+	config := &AuthConfig{JWT: JWTConfig{Secret: "secret", Issuer: "issuer"}}
+	config.SetDefaults()
+	a, err := NewJWTAuthenticator(config.JWT)
+	require.NoError(t, err)
+	e := newTestEcho(a)
+
+	sign := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		require.NoError(t, err)
+		return token
+	}
+
+	valid := sign(jwt.MapClaims{
+		"sub":   "alice",
+		"iss":   "issuer",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"scope": "profile users:read",
+		"roles": []string{"admin"},
+	})
+	rec := serve(e, "/me", bearer(valid))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "alice", rec.Body.String())
+	assert.Equal(t, http.StatusOK, serve(e, "/admin", bearer(valid)).Code)
+
+	expired := sign(jwt.MapClaims{"sub": "alice", "iss": "issuer", "exp": time.Now().Add(-time.Minute).Unix()})
+	rec = serve(e, "/me", bearer(expired))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderWWWAuthenticate), "Bearer")
+
+	wrongIssuer := sign(jwt.MapClaims{"sub": "alice", "iss": "other", "scope": "profile"})
+	assert.Equal(t, http.StatusUnauthorized, serve(e, "/me", bearer(wrongIssuer)).Code)
+
+	noScope := sign(jwt.MapClaims{"sub": "bob", "iss": "issuer", "exp": time.Now().Add(time.Minute).Unix()})
+	assert.Equal(t, http.StatusForbidden, serve(e, "/me", bearer(noScope)).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(e, "/me", nil).Code)
+}
+
+func TestJWTAuthenticatorRequiredClaims(t *testing.T) {
+	sign := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		require.NoError(t, err)
+		return token
+	}
+	exp := time.Now().Add(time.Minute).Unix()
+
+	a, err := NewJWTAuthenticator(JWTConfig{Secret: "secret", ScopeClaim: "scope"})
+	require.NoError(t, err)
+	e := newTestEcho(a)
+
+	// Tokens without exp would never expire
+	noExpiration := sign(jwt.MapClaims{"sub": "alice", "scope": "profile"})
+	assert.Equal(t, http.StatusUnauthorized, serve(e, "/me", bearer(noExpiration)).Code)
+	noSubject := sign(jwt.MapClaims{"exp": exp, "scope": "profile"})
+	assert.Equal(t, http.StatusUnauthorized, serve(e, "/me", bearer(noSubject)).Code)
+	emptySubject := sign(jwt.MapClaims{"sub": "", "exp": exp, "scope": "profile"})
+	assert.Equal(t, http.StatusUnauthorized, serve(e, "/me", bearer(emptySubject)).Code)
+
+	a, err = NewJWTAuthenticator(JWTConfig{Secret: "secret", ScopeClaim: "scope", AllowMissingExpiration: true})
+	require.NoError(t, err)
+	e = newTestEcho(a)
+	assert.Equal(t, http.StatusOK, serve(e, "/me", bearer(noExpiration)).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(e, "/me", bearer(noSubject)).Code)
+}
+
+func TestJWTAuthenticatorJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	b64 := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N), "e": b64(big.NewInt(int64(rsaKey.E)))},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X), "y": b64(ecKey.Y)},
+	}})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwks, 0o600))
+
+	a, err := NewJWTAuthenticator(JWTConfig{
+		Algorithms: []string{"RS256", "ES256"},
+		JWKSFile:   path,
+		RoleClaim:  "realm_access.roles",
+		ScopeClaim: "scope",
+	})
+	require.NoError(t, err)
+	e := newTestEcho(a)
+
+	claims := jwt.MapClaims{"sub": "svc", "exp": time.Now().Add(time.Minute).Unix(), "realm_access": map[string]any{"roles": []string{"admin"}}}
+
+	rsaToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	rsaToken.Header["kid"] = "rsa-1"
+	signed, err := rsaToken.SignedString(rsaKey)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serve(e, "/admin", bearer(signed)).Code)
+
+	ecToken := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	ecToken.Header["kid"] = "ec-1"
+	signed, err = ecToken.SignedString(ecKey)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serve(e, "/admin", bearer(signed)).Code)
+
+	// HS256 is not in the accepted algorithms
+	hsToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, serve(e, "/admin", bearer(hsToken)).Code)
+}
+
+func TestJWTAuthenticatorDefaultAlgorithms(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	config := &AuthConfig{JWT: JWTConfig{PublicKeyFile: path}}
+	config.SetDefaults()
+	a, err := NewJWTAuthenticator(config.JWT)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ES384"}, a.config.Algorithms)
+	e := newTestEcho(a)
+
+	claims := jwt.MapClaims{"sub": "svc", "exp": time.Now().Add(time.Minute).Unix(), "roles": []string{"admin"}}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodES384, claims).SignedString(ecKey)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serve(e, "/admin", bearer(signed)).Code)
+
+	hsToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, serve(e, "/admin", bearer(hsToken)).Code)
+
+	a, err = NewJWTAuthenticator(JWTConfig{Secret: "secret", PublicKeyFile: path})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ES384", "HS256"}, a.config.Algorithms)
+}
+
+func TestAPIKeyAndBasicAuthenticators(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	apiKeys, err := NewAPIKeyAuthenticator(APIKeyConfig{
+		Header: "X-API-Key",
+		Keys:   []APIKey{{Key: "key-1", Subject: "billing", Scopes: []string{"profile"}}},
+	})
+	require.NoError(t, err)
+	basic, err := NewBasicAuthenticator(BasicConfig{
+		Realm: "admin",
+		Users: []BasicUser{{Username: "root", PasswordHash: string(hash), Roles: []string{"admin"}}},
+	})
+	require.NoError(t, err)
+	e := newTestEcho(apiKeys, basic)
+
+	rec := serve(e, "/me", func(r *http.Request) { r.Header.Set("X-API-Key", "key-1") })
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "billing", rec.Body.String())
+
+	assert.Equal(t, http.StatusUnauthorized, serve(e, "/me", func(r *http.Request) { r.Header.Set("X-API-Key", "nope") }).Code)
+	assert.Equal(t, http.StatusForbidden, serve(e, "/admin", func(r *http.Request) { r.Header.Set("X-API-Key", "key-1") }).Code)
+
+	assert.Equal(t, http.StatusOK, serve(e, "/admin", func(r *http.Request) { r.SetBasicAuth("root", "s3cret") }).Code)
+	rec = serve(e, "/admin", func(r *http.Request) { r.SetBasicAuth("root", "wrong") })
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Basic realm="admin"`, rec.Header().Get(echo.HeaderWWWAuthenticate))
+}
+
+func TestFxAuthModule(t *testing.T) {
+	viper.Set("auth.api_key.enabled", true)
+	viper.Set("auth.api_key.keys", []map[string]any{
+		{"key": "key-1", "subject": "ops", "roles": []string{"admin"}},
+	})
+	defer viper.Reset()
+
+	var e *echo.Echo
+	app := fxtest.New(t,
+		fx.Provide(
+			func() *fxConfig.Config {
+				return &fxConfig.Config{Accessor: fxConfig.ConfigAccessor()}
+			},
+			zap.NewNop,
+			fxEcho.AsGroup(func() fxEcho.GroupRegistryIf {
+				return fxEcho.NewGroup("/admin").
+					RequireRole("admin").
+					AddRoute(fxEcho.GET("/dashboard", func(c echo.Context) error {
+						return c.NoContent(http.StatusNoContent)
+					}).Build()).
+					Build()
+			}),
+		),
+		FxAuth,
+		fxEcho.FxEcho,
+		fx.Populate(&e),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	assert.Equal(t, http.StatusUnauthorized, serve(e, "/admin/dashboard", nil).Code)
+	assert.Equal(t, http.StatusNoContent, serve(e, "/admin/dashboard", func(r *http.Request) {
+		r.Header.Set("X-API-Key", "key-1")
+	}).Code)
+}
@@ -0,0 +1,63 @@
+package fxauth
+
+import (
+	"errors"
+
+	fxEcho "github.com/UTOL-s/module/fxEcho"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request does
+// not carry credentials it understands
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator resolves the principal of a request
+type Authenticator interface {
+	// Challenge returns the WWW-Authenticate value sent on failure
+	Challenge() string
+	Authenticate(c echo.Context) (*Principal, error)
+}
+
+// AsAuthenticator annotates a custom authenticator constructor for Fx.
+func AsAuthenticator(f any) any {
+	return fx.Annotate(
+		f,
+		fx.As(new(Authenticator)),
+		fx.ResultTags(`group:"authenticators"`),
+	)
+}
+
+// Middleware returns a middleware that authenticates requests with the
+// first authenticator finding credentials. Requests without credentials
+// continue anonymously; route requirements such as RequireRole reject them.
+func Middleware(authenticators ...Authenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			for _, a := range authenticators {
+				principal, err := a.Authenticate(c)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if err != nil {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, a.Challenge())
+					return fxEcho.NewUnauthorizedError("invalid credentials").Wrap(err)
+				}
+				fxEcho.SetPrincipal(c, principal)
+				return next(c)
+			}
+			return next(c)
+		}
+	}
+}
+
+// GetPrincipal returns the principal authenticated by this module, if any
+func GetPrincipal(c echo.Context) (*Principal, bool) {
+	p, ok := fxEcho.GetPrincipal(c)
+	if !ok {
+		return nil, false
+	}
+	principal, ok := p.(*Principal)
+	return principal, ok
+}
+
@@ -0,0 +1,66 @@
+package fxauth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared against for unknown users so that response time
+// does not reveal which usernames exist
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("fxauth"), bcrypt.DefaultCost)
+
+// BasicAuthenticator authenticates HTTP basic credentials against bcrypt hashes
+type BasicAuthenticator struct {
+	realm string
+	users map[string]BasicUser
+}
+
+// NewBasicAuthenticator creates a basic-auth authenticator for the configured users
+func NewBasicAuthenticator(config BasicConfig) (*BasicAuthenticator, error) {
+	a := &BasicAuthenticator{
+		realm: config.Realm,
+		users: make(map[string]BasicUser, len(config.Users)),
+	}
+	for _, u := range config.Users {
+		if u.Username == "" || u.PasswordHash == "" {
+			return nil, fmt.Errorf("basic auth users require username and password_hash")
+		}
+		if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+			return nil, fmt.Errorf("invalid bcrypt hash for user %q: %w", u.Username, err)
+		}
+		a.users[u.Username] = u
+	}
+	return a, nil
+}
+
+// Challenge implements Authenticator
+func (a *BasicAuthenticator) Challenge() string {
+	return fmt.Sprintf(`Basic realm=%q`, a.realm)
+}
+
+// Authenticate implements Authenticator
+func (a *BasicAuthenticator) Authenticate(c echo.Context) (*Principal, error) {
+	username, password, ok := c.Request().BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	user, known := a.users[username]
+	hash := dummyHash
+	if known {
+		hash = []byte(user.PasswordHash)
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !known {
+		return nil, errors.New("invalid username or password")
+	}
+
+	return &Principal{
+		ID:     user.Username,
+		Method: MethodBasic,
+		Scopes: user.Scopes,
+		Roles:  user.Roles,
+	}, nil
+}
@@ -0,0 +1,94 @@
+package fxauth
+
+import (
+	"fmt"
+	"time"
+
+	fxconfig "github.com/UTOL-s/module/fxConfig"
+)
+
+// JWTConfig configures bearer token authentication
+type JWTConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Algorithms lists the accepted signing methods, e.g. HS256, RS256,
+	// ES256. By default they follow the configured secret and keys.
+	Algorithms    []string      `mapstructure:"algorithms"`
+	Secret        string        `mapstructure:"secret"`
+	PublicKeyFile string        `mapstructure:"public_key_file"`
+	JWKSFile      string        `mapstructure:"jwks_file"`
+	Issuer        string        `mapstructure:"issuer"`
+	Audience      string        `mapstructure:"audience"`
+	ScopeClaim    string        `mapstructure:"scope_claim"`
+	RoleClaim     string        `mapstructure:"role_claim"`
+	Leeway        time.Duration `mapstructure:"-"`
+	LeewaySeconds int           `mapstructure:"leeway"`
+	// AllowMissingExpiration accepts tokens without an exp claim, which
+	// never expire. Tokens must carry exp by default.
+	AllowMissingExpiration bool `mapstructure:"allow_missing_expiration"`
+}
+
+// APIKey is a static key granted to a client
+type APIKey struct {
+	Key     string   `mapstructure:"key"`
+	Subject string   `mapstructure:"subject"`
+	Scopes  []string `mapstructure:"scopes"`
+	Roles   []string `mapstructure:"roles"`
+}
+
+// APIKeyConfig configures API key authentication
+type APIKeyConfig struct {
+	Enabled bool     `mapstructure:"enabled"`
+	Header  string   `mapstructure:"header"`
+	Keys    []APIKey `mapstructure:"keys"`
+}
+
+// BasicUser is a basic-auth user with a bcrypt password hash
+type BasicUser struct {
+	Username     string   `mapstructure:"username"`
+	PasswordHash string   `mapstructure:"password_hash"`
+	Scopes       []string `mapstructure:"scopes"`
+	Roles        []string `mapstructure:"roles"`
+}
+
+// BasicConfig configures HTTP basic authentication
+type BasicConfig struct {
+	Enabled bool        `mapstructure:"enabled"`
+	Realm   string      `mapstructure:"realm"`
+	Users   []BasicUser `mapstructure:"users"`
+}
+
+// AuthConfig holds the complete authentication configuration
+type AuthConfig struct {
+	JWT    JWTConfig    `mapstructure:"jwt"`
+	APIKey APIKeyConfig `mapstructure:"api_key"`
+	Basic  BasicConfig  `mapstructure:"basic"`
+}
+
+// NewAuthConfig creates the authentication configuration from the main config
+func NewAuthConfig(config *fxconfig.Config) (*AuthConfig, error) {
+	authConfig := &AuthConfig{}
+	if err := config.Accessor.UnmarshalKey("auth", authConfig); err != nil {
+		return nil, fmt.Errorf("failed to read auth config: %w", err)
+	}
+	authConfig.SetDefaults()
+	return authConfig, nil
+}
+
+// SetDefaults sets default values for unconfigured settings
+func (ac *AuthConfig) SetDefaults() {
+	if ac.JWT.ScopeClaim == "" {
+		ac.JWT.ScopeClaim = "scope"
+	}
+	if ac.JWT.RoleClaim == "" {
+		ac.JWT.RoleClaim = "roles"
+	}
+	if ac.JWT.Leeway == 0 {
+		ac.JWT.Leeway = time.Duration(ac.JWT.LeewaySeconds) * time.Second
+	}
+	if ac.APIKey.Header == "" {
+		ac.APIKey.Header = "X-API-Key"
+	}
+	if ac.Basic.Realm == "" {
+		ac.Basic.Realm = "Restricted"
+	}
+}
@@ -0,0 +1,326 @@
+package fxauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// JWTAuthenticator authenticates bearer tokens signed with HMAC, RSA or ECDSA
+type JWTAuthenticator struct {
+	config    JWTConfig
+	parser    *jwt.Parser
+	secret    []byte
+	publicKey crypto.PublicKey
+	jwks      map[string]crypto.PublicKey
+}
+
+// NewJWTAuthenticator creates a JWT authenticator loading keys from the config
+func NewJWTAuthenticator(config JWTConfig) (*JWTAuthenticator, error) {
+	a := &JWTAuthenticator{
+		config: config,
+		secret: []byte(config.Secret),
+	}
+
+	if config.PublicKeyFile != "" {
+		key, err := loadPublicKey(config.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		a.publicKey = key
+	}
+	if config.JWKSFile != "" {
+		keys, err := loadJWKS(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.jwks = keys
+	}
+	if len(a.secret) == 0 && a.publicKey == nil && len(a.jwks) == 0 {
+		return nil, fmt.Errorf("jwt requires a secret, public_key_file or jwks_file")
+	}
+
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = a.defaultAlgorithms()
+		a.config.Algorithms = config.Algorithms
+	}
+
+	opts := []jwt.ParserOption{jwt.WithValidMethods(config.Algorithms)}
+	if !config.AllowMissingExpiration {
+		opts = append(opts, jwt.WithExpirationRequired())
+	}
+	if config.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		opts = append(opts, jwt.WithAudience(config.Audience))
+	}
+	if config.Leeway > 0 {
+		opts = append(opts, jwt.WithLeeway(config.Leeway))
+	}
+	a.parser = jwt.NewParser(opts...)
+
+	return a, nil
+}
+
+// defaultAlgorithms accepts the signing methods of the configured keys:
+// HS256 for a secret, RS256/384/512 for RSA keys and the ES algorithm
+// matching the curve of ECDSA keys
+func (a *JWTAuthenticator) defaultAlgorithms() []string {
+	var algorithms []string
+	add := func(algs ...string) {
+		for _, alg := range algs {
+			if !slices.Contains(algorithms, alg) {
+				algorithms = append(algorithms, alg)
+			}
+		}
+	}
+
+	if len(a.secret) > 0 {
+		add("HS256")
+	}
+	keys := slices.Collect(maps.Values(a.jwks))
+	if a.publicKey != nil {
+		keys = append(keys, a.publicKey)
+	}
+	for _, key := range keys {
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			add("RS256", "RS384", "RS512")
+		case *ecdsa.PublicKey:
+			switch key.Curve {
+			case elliptic.P256():
+				add("ES256")
+			case elliptic.P384():
+				add("ES384")
+			case elliptic.P521():
+				add("ES512")
+			}
+		}
+	}
+	slices.Sort(algorithms)
+	return algorithms
+}
+
+// Challenge implements Authenticator
+func (a *JWTAuthenticator) Challenge() string {
+	return `Bearer error="invalid_token"`
+}
+
+// Authenticate implements Authenticator
+func (a *JWTAuthenticator) Authenticate(c echo.Context) (*Principal, error) {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := a.parser.ParseWithClaims(token, claims, a.keyFunc); err != nil {
+		return nil, err
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil {
+		return nil, err
+	}
+	if subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	return &Principal{
+		ID:     subject,
+		Method: MethodJWT,
+		Scopes: claimStrings(claims, a.config.ScopeClaim),
+		Roles:  claimStrings(claims, a.config.RoleClaim),
+		Claims: claims,
+	}, nil
+}
+
+// keyFunc selects the verification key for the token signing method
+func (a *JWTAuthenticator) keyFunc(token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if len(a.secret) == 0 {
+			return nil, fmt.Errorf("no secret configured for %s", token.Method.Alg())
+		}
+		return a.secret, nil
+	}
+
+	if len(a.jwks) > 0 {
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := a.jwks[kid]; ok {
+			return key, nil
+		}
+		if kid == "" && len(a.jwks) == 1 {
+			for _, key := range a.jwks {
+				return key, nil
+			}
+		}
+		if a.publicKey == nil {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+	}
+
+	if a.publicKey == nil {
+		return nil, fmt.Errorf("no public key configured for %s", token.Method.Alg())
+	}
+	return a.publicKey, nil
+}
+
+// claimStrings reads a space separated string or string array claim.
+// Nested claims are addressed with dots, e.g. "realm_access.roles".
+func claimStrings(claims map[string]any, path string) []string {
+	var value any = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[part]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// loadPublicKey reads a PEM encoded RSA or ECDSA public key
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		return cert.PublicKey, nil
+	default:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		return key, nil
+	}
+}
+
+// jsonWebKey is the subset of RFC 7517 fields needed for verification
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// loadJWKS reads RSA and EC signing keys from a JWKS file, keyed by kid
+func loadJWKS(path string) (map[string]crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks: %w", err)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64url value: %w", err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,69 @@
+package fxauth
+
+import (
+	"fmt"
+
+	fxEcho "github.com/UTOL-s/module/fxEcho"
+	"go.uber.org/fx"
+)
+
+const ModuleName = "fxauth"
+
+// MiddlewarePriority runs authentication before other registered middlewares
+const MiddlewarePriority = 1000
+
+// Params holds the dependencies of the authentication middleware
+type Params struct {
+	fx.In
+	Config         *AuthConfig
+	Authenticators []Authenticator `group:"authenticators"`
+}
+
+var FxAuth = fx.Module(
+	ModuleName,
+	fx.Provide(
+		NewAuthConfig,
+		fxEcho.AsMiddleware(NewAuthMiddleware),
+	),
+)
+
+// NewAuthenticators creates the authenticators enabled in the configuration
+func NewAuthenticators(config *AuthConfig) ([]Authenticator, error) {
+	authenticators := make([]Authenticator, 0, 3)
+
+	if config.JWT.Enabled {
+		a, err := NewJWTAuthenticator(config.JWT)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create jwt authenticator: %w", err)
+		}
+		authenticators = append(authenticators, a)
+	}
+	if config.APIKey.Enabled {
+		a, err := NewAPIKeyAuthenticator(config.APIKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create api key authenticator: %w", err)
+		}
+		authenticators = append(authenticators, a)
+	}
+	if config.Basic.Enabled {
+		a, err := NewBasicAuthenticator(config.Basic)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create basic authenticator: %w", err)
+		}
+		authenticators = append(authenticators, a)
+	}
+
+	return authenticators, nil
+}
+
+// NewAuthMiddleware creates the authentication middleware from the
+// configured and custom authenticators
+func NewAuthMiddleware(p Params) (fxEcho.MiddlewareRegistryIf, error) {
+	authenticators, err := NewAuthenticators(p.Config)
+	if err != nil {
+		return nil, err
+	}
+	authenticators = append(authenticators, p.Authenticators...)
+
+	return fxEcho.NewMiddleware(MiddlewarePriority, Middleware(authenticators...)), nil
+}
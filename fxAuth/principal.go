@@ -0,0 +1,34 @@
+package fxauth
+
+import "slices"
+
+// Authentication methods recorded on a Principal
+const (
+	MethodJWT    = "jwt"
+	MethodAPIKey = "api_key"
+	MethodBasic  = "basic"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	ID     string
+	Method string
+	Scopes []string
+	Roles  []string
+	Claims map[string]any
+}
+
+// Subject returns the principal identifier
+func (p *Principal) Subject() string {
+	return p.ID
+}
+
+// HasScope reports whether the principal was granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// HasRole reports whether the principal holds the role
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
@@ -1,10 +1,13 @@
 package fxconfig
 
 import (
-	"fmt"
 	"os"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/UTOL-s/module/fxGorm/dsn"
 	"github.com/spf13/viper"
 )
 
@@ -14,12 +17,20 @@ type Config struct {
 		Port string `mapstructure:"port"`
 	} `mapstructure:"app"`
 	Database struct {
-		Host     string `mapstructure:"host"`
-		Port     int    `mapstructure:"port"`
-		User     string `mapstructure:"user"`
-		Password string `mapstructure:"password"`
-		DBName   string `mapstructure:"dbname"`
-		SSLMode  string `mapstructure:"sslmode"`
+		DSN             string            `mapstructure:"dsn"`
+		Host            string            `mapstructure:"host"`
+		Port            int               `mapstructure:"port"`
+		User            string            `mapstructure:"user"`
+		Password        string            `mapstructure:"password"`
+		DBName          string            `mapstructure:"dbname"`
+		SSLMode         string            `mapstructure:"sslmode"`
+		SSLRootCert     string            `mapstructure:"sslrootcert"`
+		SSLCert         string            `mapstructure:"sslcert"`
+		SSLKey          string            `mapstructure:"sslkey"`
+		ConnectTimeout  time.Duration     `mapstructure:"connect_timeout"` // e.g. "5s"; bare numbers are seconds
+		ApplicationName string            `mapstructure:"application_name"`
+		SearchPath      string            `mapstructure:"search_path"`
+		Params          map[string]string `mapstructure:"params"`
 	} `mapstructure:"database"`
 	Accessor *Accessor
 }
@@ -28,22 +39,59 @@ var configAccessor = &Accessor{}
 
 // Accessor provides Yokai-style config access
 // e.g., fxConfig.Config().String("app.name")
-type Accessor struct{}
+type Accessor struct {
+	// v is the viper instance read, the global one when nil
+	v *viper.Viper
+}
+
+// NewAccessor returns an accessor reading v instead of the global viper,
+// e.g. to isolate the config of parallel tests
+func NewAccessor(v *viper.Viper) *Accessor {
+	return &Accessor{v: v}
+}
+
+// viper returns the instance read; a nil accessor reads the global one
+func (a *Accessor) viper() *viper.Viper {
+	if a != nil && a.v != nil {
+		return a.v
+	}
+	return viper.GetViper()
+}
 
 func (a *Accessor) String(key string) string {
-	return viper.GetString(key)
+	return a.viper().GetString(key)
 }
 func (a *Accessor) Int(key string) int {
-	return viper.GetInt(key)
+	return a.viper().GetInt(key)
 }
 func (a *Accessor) Bool(key string) bool {
-	return viper.GetBool(key)
+	return a.viper().GetBool(key)
 }
 func (a *Accessor) Float64(key string) float64 {
-	return viper.GetFloat64(key)
+	return a.viper().GetFloat64(key)
+}
+func (a *Accessor) StringSlice(key string) []string {
+	return a.viper().GetStringSlice(key)
+}
+func (a *Accessor) IsSet(key string) bool {
+	return a.viper().IsSet(key)
 }
 func (a *Accessor) AllSettings() map[string]interface{} {
-	return viper.AllSettings()
+	return a.viper().AllSettings()
+}
+
+func (a *Accessor) Get(key string) interface{} {
+	return a.viper().Get(key)
+}
+
+// Set overrides the value of key, e.g. in tests
+func (a *Accessor) Set(key string, value interface{}) {
+	a.viper().Set(key, value)
+}
+
+// UnmarshalKey decodes the config subtree at key into out
+func (a *Accessor) UnmarshalKey(key string, out interface{}) error {
+	return a.viper().UnmarshalKey(key, out)
 }
 
 // ConfigAccessor returns the global config accessor, Yokai-style
@@ -71,13 +119,40 @@ func NewConfig() (*Config, error) {
 	}
 
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := viper.Unmarshal(&config, viper.DecodeHook(durationHook)); err != nil {
 		return nil, err
 	}
 	config.Accessor = configAccessor
 	return &config, nil
 }
 
+// durationHook decodes durations from Go duration strings such as "5s" or
+// from bare numbers of seconds, like the durations read by fxGorm
+func durationHook(_ reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(time.Duration(0)) {
+		return data, nil
+	}
+	if value, ok := data.(string); ok {
+		if value == "" {
+			return time.Duration(0), nil
+		}
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.ParseDuration(value)
+		}
+		data = seconds
+	}
+	switch value := reflect.ValueOf(data); value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return time.Duration(value.Int()) * time.Second, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return time.Duration(value.Uint()) * time.Second, nil
+	case reflect.Float32, reflect.Float64:
+		return time.Duration(value.Float() * float64(time.Second)), nil
+	}
+	return data, nil
+}
+
 // GetEnv is still available for direct env access
 func GetEnv(key string) string {
 	return os.Getenv(key)
@@ -88,11 +163,25 @@ func NewConfigAccessor() *Accessor {
 	return configAccessor
 }
 
+// PostgresDSN returns the PostgreSQL connection string of the database
+// settings, built like fxGorm's. A configured database.dsn is returned as is.
 func (c *Config) PostgresDSN() string {
-	return "host=" + c.Database.Host +
-		" user=" + c.Database.User +
-		" password=" + c.Database.Password +
-		" dbname=" + c.Database.DBName +
-		" port=" + fmt.Sprintf("%d", c.Database.Port) +
-		" sslmode=" + c.Database.SSLMode
+	if c.Database.DSN != "" {
+		return c.Database.DSN
+	}
+	return dsn.Postgres(dsn.Options{
+		Host:            c.Database.Host,
+		Port:            c.Database.Port,
+		User:            c.Database.User,
+		Password:        c.Database.Password,
+		DBName:          c.Database.DBName,
+		SSLMode:         c.Database.SSLMode,
+		SSLRootCert:     c.Database.SSLRootCert,
+		SSLCert:         c.Database.SSLCert,
+		SSLKey:          c.Database.SSLKey,
+		ConnectTimeout:  c.Database.ConnectTimeout,
+		ApplicationName: c.Database.ApplicationName,
+		SearchPath:      c.Database.SearchPath,
+		Params:          c.Database.Params,
+	})
 }
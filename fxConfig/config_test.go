@@ -2,7 +2,12 @@ package fxconfig
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/spf13/viper"
 )
 
 func TestConfigAccessor(t *testing.T) {
@@ -34,7 +39,10 @@ func TestAccessorMethods(t *testing.T) {
 	_ = accessor.Int("test")
 	_ = accessor.Bool("test")
 	_ = accessor.Float64("test")
+	_ = accessor.StringSlice("test")
+	_ = accessor.IsSet("test")
 	_ = accessor.AllSettings()
+	_ = accessor.UnmarshalKey("test", &struct{}{})
 }
 
 func TestConfigAccessorSingleton(t *testing.T) {
@@ -45,3 +53,86 @@ func TestConfigAccessorSingleton(t *testing.T) {
 		t.Error("ConfigAccessor should return the same instance")
 	}
 }
+
+func TestAccessorSet(t *testing.T) {
+	accessor := ConfigAccessor()
+	accessor.Set("test.set_key", "value")
+
+	if got := accessor.String("test.set_key"); got != "value" {
+		t.Errorf("Expected value, got %s", got)
+	}
+	if got := accessor.Get("test.set_key"); got != "value" {
+		t.Errorf("Expected value, got %v", got)
+	}
+}
+
+func TestNewAccessor(t *testing.T) {
+	v := viper.New()
+	accessor := NewAccessor(v)
+	accessor.Set("test.isolated_key", "value")
+
+	if got := v.GetString("test.isolated_key"); got != "value" {
+		t.Errorf("Expected value, got %s", got)
+	}
+	if ConfigAccessor().IsSet("test.isolated_key") {
+		t.Error("NewAccessor should not write to the global config")
+	}
+}
+
+func TestPostgresDSN(t *testing.T) {
+	var config Config
+	config.Database.Host = "localhost"
+	config.Database.Port = 5432
+	config.Database.User = "postgres"
+	config.Database.Password = "p@ss word"
+	config.Database.DBName = "utol_db"
+	config.Database.SSLMode = "verify-full"
+	config.Database.SSLRootCert = "/etc/ssl/ca.pem"
+	config.Database.Params = map[string]string{"statement_timeout": "5000"}
+
+	expected := "host=localhost user=postgres password='p@ss word' dbname=utol_db port=5432 sslmode=verify-full sslrootcert=/etc/ssl/ca.pem statement_timeout=5000"
+	if got := config.PostgresDSN(); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	config.Database.DSN = "postgres://postgres@localhost/utol_db"
+	if got := config.PostgresDSN(); got != config.Database.DSN {
+		t.Errorf("Expected the configured DSN, got %s", got)
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "configs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	defer viper.Reset()
+
+	tests := []struct {
+		value    string
+		expected time.Duration
+		dsn      string
+	}{
+		{`"5s"`, 5 * time.Second, "connect_timeout=5"},
+		{`5`, 5 * time.Second, "connect_timeout=5"},
+		{`"2.5"`, 2500 * time.Millisecond, "connect_timeout=3"},
+	}
+	for _, test := range tests {
+		config := "database:\n  host: localhost\n  connect_timeout: " + test.value + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "configs", "config.yaml"), []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		viper.Reset()
+		loaded, err := NewConfig()
+		if err != nil {
+			t.Fatalf("NewConfig() with connect_timeout %s: %v", test.value, err)
+		}
+		if loaded.Database.ConnectTimeout != test.expected {
+			t.Errorf("connect_timeout %s: expected %s, got %s", test.value, test.expected, loaded.Database.ConnectTimeout)
+		}
+		if dsn := loaded.PostgresDSN(); !strings.Contains(dsn, test.dsn) {
+			t.Errorf("connect_timeout %s: expected %s in %s", test.value, test.dsn, dsn)
+		}
+	}
+}
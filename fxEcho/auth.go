@@ -0,0 +1,101 @@
+package FxEcho
+
+import (
+	"context"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PrincipalContextKey is the echo context key holding the Principal
+const PrincipalContextKey = "fxecho.principal"
+
+type principalCtxKey struct{}
+
+// Principal is the authenticated caller of a request
+type Principal interface {
+	Subject() string
+	HasScope(scope string) bool
+	HasRole(role string) bool
+}
+
+// SetPrincipal stores the principal on the echo context and the request context
+func SetPrincipal(c echo.Context, p Principal) {
+	c.Set(PrincipalContextKey, p)
+	req := c.Request()
+	c.SetRequest(req.WithContext(context.WithValue(req.Context(), principalCtxKey{}, p)))
+}
+
+// GetPrincipal returns the principal authenticated for the request, if any
+func GetPrincipal(c echo.Context) (Principal, bool) {
+	p, ok := c.Get(PrincipalContextKey).(Principal)
+	return p, ok && p != nil
+}
+
+// PrincipalFromContext returns the principal stored in a request context
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalCtxKey{}).(Principal)
+	return p, ok && p != nil
+}
+
+// KeyByPrincipal counts rate limited requests per authenticated subject,
+// falling back to the client IP for anonymous requests
+func KeyByPrincipal() RateLimitKeyFunc {
+	return func(c echo.Context) (string, error) {
+		if p, ok := GetPrincipal(c); ok {
+			return "user:" + p.Subject(), nil
+		}
+		return "ip:" + clientIP(c), nil
+	}
+}
+
+// RequireScopes returns a middleware rejecting requests whose principal
+// lacks any of the given scopes
+func RequireScopes(scopes ...string) echo.MiddlewareFunc {
+	return requirePrincipal(func(p Principal) *Error {
+		missing := make([]string, 0)
+		for _, s := range scopes {
+			if !p.HasScope(s) {
+				missing = append(missing, s)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		return NewForbiddenError("missing required scopes").
+			WithDetails(map[string]string{"missing_scopes": strings.Join(missing, " ")})
+	})
+}
+
+// RequireRole returns a middleware rejecting requests whose principal has
+// none of the given roles
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return requirePrincipal(func(p Principal) *Error {
+		for _, r := range roles {
+			if p.HasRole(r) {
+				return nil
+			}
+		}
+		return NewForbiddenError("missing required role")
+	})
+}
+
+// RequireAuthenticated returns a middleware rejecting anonymous requests
+func RequireAuthenticated() echo.MiddlewareFunc {
+	return requirePrincipal(func(Principal) *Error { return nil })
+}
+
+func requirePrincipal(check func(p Principal) *Error) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := GetPrincipal(c)
+			if !ok {
+				return NewUnauthorizedError("authentication required")
+			}
+			if err := check(p); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
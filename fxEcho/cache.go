@@ -0,0 +1,402 @@
+package FxEcho
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Cache headers not defined by Echo
+const (
+	HeaderETag        = "ETag"
+	HeaderAge         = "Age"
+	HeaderIfNoneMatch = "If-None-Match"
+	// HeaderXCache reports whether a response was served from the cache
+	HeaderXCache = "X-Cache"
+)
+
+// CachedResponse is a response stored by a CacheStore
+type CachedResponse struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	StoredAt time.Time
+}
+
+// CacheStore stores responses by key. Get returns nil without an error
+// for missing or expired entries.
+type CacheStore interface {
+	Get(ctx context.Context, key string) (*CachedResponse, error)
+	Set(ctx context.Context, key string, response *CachedResponse, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// CacheConfig configures the caching middleware
+type CacheConfig struct {
+	// TTL is how long responses are stored and may be cached by clients.
+	// Zero only adds ETags and answers conditional requests.
+	TTL   time.Duration
+	Store CacheStore
+	// VaryHeaders are request headers that select different responses,
+	// e.g. Accept-Language or Authorization
+	VaryHeaders []string
+	// VaryQuery restricts the cache key to these query parameters; all
+	// parameters are part of the key when nil
+	VaryQuery []string
+	// WeakETag generates weak validators (W/"...") instead of strong ones
+	WeakETag bool
+	// Private marks responses as cacheable by browsers but not proxies.
+	// Private responses are not stored by the server either.
+	Private bool
+	// MaxSize is the largest body stored in bytes, 1MB by default
+	MaxSize int
+	Skipper middleware.Skipper
+	// Scope separates entries of different routes or groups sharing a store
+	Scope string
+}
+
+// CacheMiddleware returns a middleware caching successful GET and HEAD
+// responses and answering conditional requests with 304 Not Modified
+func CacheMiddleware(config CacheConfig) echo.MiddlewareFunc {
+	if config.Store == nil {
+		config.Store = NewMemoryCacheStore(0)
+	}
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.MaxSize == 0 {
+		config.MaxSize = 1 << 20
+	}
+	cacheControl := "no-cache"
+	if config.TTL > 0 {
+		visibility := "public"
+		if config.Private {
+			visibility = "private"
+		}
+		cacheControl = fmt.Sprintf("%s, max-age=%d", visibility, ceilSeconds(config.TTL))
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if (req.Method != http.MethodGet && req.Method != http.MethodHead) || config.Skipper(c) {
+				return next(c)
+			}
+			// Streams and protocol upgrades cannot be buffered
+			if req.Header.Get(echo.HeaderUpgrade) != "" || isLongLived(req) {
+				return next(c)
+			}
+
+			// Private responses are only cached by the client
+			store := config.TTL > 0 && !config.Private
+			key := cacheKey(config, req)
+			if store {
+				cached, err := config.Store.Get(req.Context(), key)
+				if err != nil {
+					return fmt.Errorf("cache store: %w", err)
+				}
+				if cached != nil {
+					c.Response().Header().Set(HeaderAge, strconv.Itoa(int(time.Since(cached.StoredAt).Seconds())))
+					c.Response().Header().Set(HeaderXCache, "HIT")
+					return writeCached(c, cached)
+				}
+			}
+
+			// Buffer the response to validate and store it
+			res := c.Response()
+			writer := res.Writer
+			recorder := &cacheRecorder{ResponseWriter: writer, status: http.StatusOK}
+			res.Writer = recorder
+			returned := false
+			defer func() {
+				res.Writer = writer
+				if !returned {
+					// The handler panicked; nothing reached the client yet, so
+					// the error handler can still answer the request
+					res.Committed, res.Status, res.Size = false, 0, 0
+				}
+			}()
+			err := next(c)
+			returned = true
+			res.Writer = writer
+			if err != nil {
+				if res.Committed {
+					_ = flushRecorded(writer, recorder.status, recorder.body.Bytes())
+				}
+				return err
+			}
+
+			response := &CachedResponse{
+				Status:   recorder.status,
+				Header:   res.Header().Clone(),
+				Body:     recorder.body.Bytes(),
+				StoredAt: time.Now(),
+			}
+			if response.Status != http.StatusOK || !cacheable(response.Header) {
+				return flushRecorded(writer, response.Status, response.Body)
+			}
+
+			header := res.Header()
+			if header.Get(echo.HeaderCacheControl) == "" {
+				header.Set(echo.HeaderCacheControl, cacheControl)
+			}
+			if header.Get(HeaderETag) == "" {
+				header.Set(HeaderETag, etagFor(response.Body, config.WeakETag))
+			}
+			if header.Get(echo.HeaderLastModified) == "" {
+				header.Set(echo.HeaderLastModified, response.StoredAt.UTC().Format(http.TimeFormat))
+			}
+			for _, name := range config.VaryHeaders {
+				header.Add(echo.HeaderVary, name)
+			}
+			response.Header = header.Clone()
+
+			if store && len(response.Body) <= config.MaxSize {
+				if err := config.Store.Set(req.Context(), key, response, config.TTL); err != nil {
+					c.Logger().Warnf("failed to store cached response: %v", err)
+				}
+				header.Set(HeaderXCache, "MISS")
+			}
+			return writeCached(c, response)
+		}
+	}
+}
+
+// cacheKey identifies the response selected by a request
+func cacheKey(config CacheConfig, req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(config.Scope)
+	b.WriteString("|")
+	b.WriteString(req.URL.Path)
+
+	query := req.URL.Query()
+	if config.VaryQuery != nil {
+		selected := make(url.Values, len(config.VaryQuery))
+		for _, name := range config.VaryQuery {
+			if v, ok := query[name]; ok {
+				selected[name] = v
+			}
+		}
+		query = selected
+	}
+	b.WriteString("?")
+	b.WriteString(query.Encode())
+
+	for _, name := range config.VaryHeaders {
+		b.WriteString("|")
+		b.WriteString(strings.ToLower(name))
+		b.WriteString("=")
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// cacheable reports whether the handler allowed the response to be shared
+func cacheable(header http.Header) bool {
+	if header.Get(echo.HeaderSetCookie) != "" {
+		return false
+	}
+	directives := strings.ToLower(header.Get(echo.HeaderCacheControl))
+	return !strings.Contains(directives, "no-store") && !strings.Contains(directives, "private")
+}
+
+// etagFor derives an entity tag from the response body
+func etagFor(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since without it
+func notModified(req *http.Request, header http.Header) bool {
+	if match := req.Header.Get(HeaderIfNoneMatch); match != "" {
+		etag := strings.TrimPrefix(header.Get(HeaderETag), "W/")
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// If-None-Match uses the weak comparison
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(req.Header.Get(echo.HeaderIfModifiedSince))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get(echo.HeaderLastModified))
+	return err == nil && !modified.After(since)
+}
+
+// writeCached writes a validated response, or 304 when the client copy
+// is still current
+func writeCached(c echo.Context, response *CachedResponse) error {
+	res := c.Response()
+	header := res.Header()
+	for name, values := range response.Header {
+		if name == HeaderXCache && header.Get(HeaderXCache) != "" {
+			continue
+		}
+		header[name] = slices.Clone(values)
+	}
+
+	if notModified(c.Request(), header) {
+		header.Del(echo.HeaderContentType)
+		header.Del(echo.HeaderContentLength)
+		return writeRaw(res, http.StatusNotModified, nil)
+	}
+	if c.Request().Method == http.MethodHead {
+		return writeRaw(res, response.Status, nil)
+	}
+	return writeRaw(res, response.Status, response.Body)
+}
+
+// writeRaw writes to the underlying writer, bypassing a recorder that
+// already marked the Echo response committed. Size counts what reaches
+// the client rather than what the handler wrote to the recorder.
+func writeRaw(res *echo.Response, status int, body []byte) error {
+	res.Status = status
+	res.Committed = true
+	res.Size = 0
+	res.Writer.WriteHeader(status)
+	if len(body) == 0 {
+		return nil
+	}
+	n, err := res.Writer.Write(body)
+	res.Size = int64(n)
+	return err
+}
+
+// flushRecorded writes a buffered response that is not cached
+func flushRecorded(w http.ResponseWriter, status int, body []byte) error {
+	w.WriteHeader(status)
+	_, err := w.Write(body)
+	return err
+}
+
+// cacheRecorder buffers a response body and status
+type cacheRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *cacheRecorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *cacheRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+// Flush does nothing, the response is sent once complete
+func (r *cacheRecorder) Flush() {}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (r *cacheRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// MemoryCacheStore is an in-process LRU CacheStore
+type MemoryCacheStore struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+	now      func() time.Time
+}
+
+type cacheEntry struct {
+	key      string
+	response *CachedResponse
+	expires  time.Time
+}
+
+// NewMemoryCacheStore creates an LRU store holding up to capacity
+// responses, 1024 when capacity is zero
+func NewMemoryCacheStore(capacity int) *MemoryCacheStore {
+	if capacity <= 0 {
+		capacity = 1024
+	}
+	return &MemoryCacheStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Get implements CacheStore
+func (s *MemoryCacheStore) Get(_ context.Context, key string) (*CachedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	entry := element.Value.(*cacheEntry)
+	if !s.now().Before(entry.expires) {
+		s.order.Remove(element)
+		delete(s.entries, key)
+		return nil, nil
+	}
+	s.order.MoveToFront(element)
+	return entry.response, nil
+}
+
+// Set implements CacheStore, evicting the least recently used entry
+// when the store is full
+func (s *MemoryCacheStore) Set(_ context.Context, key string, response *CachedResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &cacheEntry{key: key, response: response, expires: s.now().Add(ttl)}
+	if element, ok := s.entries[key]; ok {
+		element.Value = entry
+		s.order.MoveToFront(element)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(entry)
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*cacheEntry).key)
+	}
+	return nil
+}
+
+// Delete implements CacheStore
+func (s *MemoryCacheStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.entries[key]; ok {
+		s.order.Remove(element)
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// Len returns the number of stored responses
+func (s *MemoryCacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
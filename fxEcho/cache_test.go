@@ -0,0 +1,233 @@
+package FxEcho
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCacheEcho(config CacheConfig, calls *int) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = NewErrorHandler(ErrorHandlerParams{Logger: newTestLogger()}).Handle
+
+	handler := func(c echo.Context) error {
+		*calls++
+		return c.String(http.StatusOK, "hello "+c.QueryParam("name")+c.Request().Header.Get("Accept-Language"))
+	}
+	routes := []RouteRegistryIf{
+		GET("/greeting", handler).Cache(config).Build(),
+		GET("/private", func(c echo.Context) error {
+			*calls++
+			c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+			return c.String(http.StatusOK, "secret")
+		}).Cache(config).Build(),
+		GET("/missing", func(c echo.Context) error {
+			*calls++
+			return NewNotFoundError("missing")
+		}).Cache(config).Build(),
+	}
+	for _, r := range routes {
+		e.Add(r.Method(), r.Path(), r.Handle)
+	}
+	return e
+}
+
+func request(e *echo.Echo, method, target string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCacheMiddleware(t *testing.T) {
+	calls := 0
+	e := newCacheEcho(CacheConfig{TTL: time.Minute, VaryHeaders: []string{"Accept-Language"}, VaryQuery: []string{"name"}}, &calls)
+
+	rec := request(e, http.MethodGet, "/greeting?name=bob&page=1")
+	assert.Equal(t, "hello bob", rec.Body.String())
+	assert.Equal(t, "MISS", rec.Header().Get(HeaderXCache))
+	assert.Equal(t, "public, max-age=60", rec.Header().Get(echo.HeaderCacheControl))
+	assert.Equal(t, "Accept-Language", rec.Header().Get(echo.HeaderVary))
+	etag := rec.Header().Get(HeaderETag)
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+
+	// Unlisted query parameters share the entry
+	rec = request(e, http.MethodGet, "/greeting?page=2&name=bob")
+	assert.Equal(t, "hello bob", rec.Body.String())
+	assert.Equal(t, "HIT", rec.Header().Get(HeaderXCache))
+	assert.Equal(t, etag, rec.Header().Get(HeaderETag))
+	assert.Equal(t, "0", rec.Header().Get(HeaderAge))
+	assert.Equal(t, 1, calls)
+
+	// Vary headers and query parameters select other entries
+	assert.Equal(t, "hello bobfr", request(e, http.MethodGet, "/greeting?name=bob", "Accept-Language", "fr").Body.String())
+	assert.Equal(t, "hello ann", request(e, http.MethodGet, "/greeting?name=ann").Body.String())
+	assert.Equal(t, 3, calls)
+
+	// Conditional requests
+	rec = request(e, http.MethodGet, "/greeting?name=bob", HeaderIfNoneMatch, `"other", W/`+etag)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, etag, rec.Header().Get(HeaderETag))
+
+	lastModified := rec.Header().Get(echo.HeaderLastModified)
+	assert.Equal(t, http.StatusNotModified, request(e, http.MethodGet, "/greeting?name=bob", echo.HeaderIfModifiedSince, lastModified).Code)
+	assert.Equal(t, http.StatusOK, request(e, http.MethodGet, "/greeting?name=bob", echo.HeaderIfModifiedSince, "Mon, 01 Jan 2001 00:00:00 GMT").Code)
+	assert.Equal(t, 3, calls)
+
+	// Responses marked no-store and errors are not cached
+	request(e, http.MethodGet, "/private")
+	rec = request(e, http.MethodGet, "/private")
+	assert.Equal(t, "secret", rec.Body.String())
+	assert.Empty(t, rec.Header().Get(HeaderETag))
+	rec = request(e, http.MethodGet, "/missing")
+	request(e, http.MethodGet, "/missing")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, 7, calls)
+}
+
+func TestCacheMiddlewareValidationOnly(t *testing.T) {
+	calls := 0
+	e := newCacheEcho(CacheConfig{WeakETag: true}, &calls)
+
+	rec := request(e, http.MethodGet, "/greeting")
+	etag := rec.Header().Get(HeaderETag)
+	assert.True(t, strings.HasPrefix(etag, `W/"`))
+	assert.Equal(t, "no-cache", rec.Header().Get(echo.HeaderCacheControl))
+	assert.Empty(t, rec.Header().Get(HeaderXCache))
+
+	rec = request(e, http.MethodGet, "/greeting", HeaderIfNoneMatch, etag)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestCacheMiddlewarePanicAndStreams(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = NewErrorHandler(ErrorHandlerParams{Logger: newTestLogger()}).Handle
+	e.Use(Recover())
+	config := CacheConfig{TTL: time.Minute}
+	routes := []RouteRegistryIf{
+		GET("/panic", func(c echo.Context) error {
+			_ = c.String(http.StatusOK, "partial")
+			panic("boom")
+		}).Cache(config).Build(),
+		GET("/events", func(c echo.Context) error {
+			c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+			_, _ = c.Response().Write([]byte("data: 1\n\n"))
+			c.Response().Flush()
+			return nil
+		}).Cache(config).Build(),
+	}
+	for _, r := range routes {
+		e.Add(r.Method(), r.Path(), r.Handle)
+	}
+
+	rec := request(e, http.MethodGet, "/panic")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "partial")
+
+	rec = request(e, http.MethodGet, "/events", echo.HeaderAccept, "text/event-stream")
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "data: 1\n\n", rec.Body.String())
+	assert.Empty(t, rec.Header().Get(HeaderXCache))
+}
+
+func TestCacheMiddlewareRunsAfterAuth(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = NewErrorHandler(ErrorHandlerParams{Logger: newTestLogger()}).Handle
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if role := c.Request().Header.Get("X-Role"); role != "" {
+				SetPrincipal(c, testPrincipal{subject: "alice", roles: []string{role}})
+			}
+			return next(c)
+		}
+	})
+	var size int64
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			size = c.Response().Size
+			return err
+		}
+	})
+	calls := 0
+	route := GET("/report", func(c echo.Context) error {
+		calls++
+		return c.String(http.StatusOK, "report")
+	}).Cache(CacheConfig{TTL: time.Minute}).RequireRole("admin").Build()
+	e.Add(route.Method(), route.Path(), route.Handle)
+
+	rec := request(e, http.MethodGet, "/report", "X-Role", "admin")
+	assert.Equal(t, "MISS", rec.Header().Get(HeaderXCache))
+	assert.Equal(t, int64(len("report")), size)
+	rec = request(e, http.MethodGet, "/report", "X-Role", "admin")
+	assert.Equal(t, "HIT", rec.Header().Get(HeaderXCache))
+	assert.Equal(t, int64(len("report")), size)
+	assert.Equal(t, 1, calls)
+
+	// Cached responses are not served before the role check
+	assert.Equal(t, http.StatusUnauthorized, request(e, http.MethodGet, "/report").Code)
+	assert.Equal(t, http.StatusForbidden, request(e, http.MethodGet, "/report", "X-Role", "viewer").Code)
+
+	// A group cache cannot run before the role checks of its routes
+	assert.Panics(t, func() {
+		NewGroup("/admin").
+			Cache(CacheConfig{TTL: time.Minute}).
+			AddRoute(GET("/report", textHandler("report")).RequireRole("admin").Build()).
+			Build()
+	})
+}
+
+func TestCacheMiddlewarePrivate(t *testing.T) {
+	calls := 0
+	e := newCacheEcho(CacheConfig{TTL: time.Minute, Private: true}, &calls)
+
+	// Private responses are left to the browser cache
+	for range 2 {
+		rec := request(e, http.MethodGet, "/greeting")
+		assert.Equal(t, "private, max-age=60", rec.Header().Get(echo.HeaderCacheControl))
+		assert.Empty(t, rec.Header().Get(HeaderXCache))
+		assert.NotEmpty(t, rec.Header().Get(HeaderETag))
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestMemoryCacheStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryCacheStore(2)
+	store.now = func() time.Time { return now }
+
+	for _, key := range []string{"a", "b"} {
+		require.NoError(t, store.Set(ctx, key, &CachedResponse{Body: []byte(key)}, time.Minute))
+	}
+	// Reading a makes b the least recently used entry
+	got, err := store.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(got.Body))
+
+	require.NoError(t, store.Set(ctx, "c", &CachedResponse{Body: []byte("c")}, time.Second))
+	assert.Equal(t, 2, store.Len())
+	got, _ = store.Get(ctx, "b")
+	assert.Nil(t, got)
+
+	now = now.Add(2 * time.Second)
+	got, _ = store.Get(ctx, "c")
+	assert.Nil(t, got)
+	assert.Equal(t, 1, store.Len())
+
+	require.NoError(t, store.Delete(ctx, "a"))
+	assert.Zero(t, store.Len())
+}
@@ -0,0 +1,201 @@
+package FxEcho
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"regexp"
+	"runtime/debug"
+	runtimepprof "runtime/pprof"
+	"strings"
+
+	fxConfig "github.com/UTOL-s/module/fxConfig"
+	"github.com/labstack/echo/v4"
+)
+
+// DebugConfig configures the debug endpoints of a server. They are off by
+// default and require an allowlist, roles, or both when enabled.
+type DebugConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Path prefixes the debug endpoints, "/debug" by default
+	Path string `mapstructure:"path"`
+	// Allow lists client IPs or CIDR ranges, e.g. "10.0.0.0/8"
+	Allow []string `mapstructure:"allow"`
+	// Roles admits authenticated principals with any of these roles
+	Roles []string `mapstructure:"roles"`
+}
+
+// secretKey matches config keys whose values are hidden by the config endpoint
+var secretKey = regexp.MustCompile(`(?i)(password|secret|token|key|dsn|credential)`)
+
+// mountDebug registers pprof, expvar, goroutine dumps, build info and the
+// config and route introspection endpoints behind the access checks
+func mountDebug(e *echo.Echo, config DebugConfig, accessor *fxConfig.Accessor, servers *Servers) error {
+	networks, err := parseAllowList(config.Allow)
+	if err != nil {
+		return err
+	}
+
+	g := e.Group(config.Path)
+	if len(networks) > 0 {
+		g.Use(allowNetworks(networks))
+	}
+	if len(config.Roles) > 0 {
+		g.Use(RequireRole(config.Roles...))
+	}
+	// Profiles and traces run for as long as the client asks
+	g.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			clearTimeout(c)
+			return next(c)
+		}
+	})
+
+	g.GET("/pprof/", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+	g.GET("/pprof/:profile", func(c echo.Context) error {
+		var handler http.HandlerFunc
+		switch profile := c.Param("profile"); profile {
+		case "cmdline":
+			handler = pprof.Cmdline
+		case "profile":
+			handler = pprof.Profile
+		case "symbol":
+			handler = pprof.Symbol
+		case "trace":
+			handler = pprof.Trace
+		default:
+			if runtimepprof.Lookup(profile) == nil {
+				return NewNotFoundError("unknown profile " + profile)
+			}
+			handler = pprof.Handler(profile).ServeHTTP
+		}
+		handler(c.Response(), c.Request())
+		return nil
+	})
+	g.POST("/pprof/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	g.GET("/vars", echo.WrapHandler(expvar.Handler()))
+	g.GET("/goroutines", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+		c.Response().WriteHeader(http.StatusOK)
+		return runtimepprof.Lookup("goroutine").WriteTo(c.Response(), 2)
+	})
+	g.GET("/build", buildInfoHandler)
+	g.GET("/config", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, redactSettings(accessor.AllSettings()))
+	})
+	g.GET("/routes", func(c echo.Context) error {
+		routes := make(map[string]any, len(servers.names))
+		for _, name := range servers.Names() {
+			if server, ok := servers.Get(name); ok {
+				routes[name] = map[string]any{
+					"routes":    server.Routes.Routes(),
+					"conflicts": server.Routes.Conflicts(),
+				}
+			}
+		}
+		return c.JSON(http.StatusOK, routes)
+	})
+	return nil
+}
+
+// parseAllowList parses IPs and CIDR ranges
+func parseAllowList(allow []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(allow))
+	for _, entry := range allow {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid debug allowlist entry %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid debug allowlist entry %q: %w", entry, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// allowNetworks rejects clients outside the given networks. The client
+// IP comes from the connection unless the Echo IPExtractor trusts proxies.
+func allowNetworks(networks []*net.IPNet) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if ip := net.ParseIP(clientIP(c)); ip != nil {
+				for _, network := range networks {
+					if network.Contains(ip) {
+						return next(c)
+					}
+				}
+			}
+			return NewForbiddenError("client not allowed")
+		}
+	}
+}
+
+// buildInfoHandler serves the module versions and VCS settings of the binary
+func buildInfoHandler(c echo.Context) error {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return NewNotFoundError("build info not available")
+	}
+	settings := make(map[string]string, len(info.Settings))
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+	deps := make(map[string]string, len(info.Deps))
+	for _, d := range info.Deps {
+		deps[d.Path] = d.Version
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"go_version": info.GoVersion,
+		"path":       info.Path,
+		"version":    info.Main.Version,
+		"settings":   settings,
+		"deps":       deps,
+	})
+}
+
+// redactSettings copies settings, hiding values of secret-looking keys
+func redactSettings(settings map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(settings))
+	for key, value := range settings {
+		redacted[key] = redactValue(key, value)
+	}
+	return redacted
+}
+
+// redactValue hides value when key looks secret, recursing into nested
+// settings and lists such as database.replicas
+func redactValue(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return redactSettings(v)
+	case []map[string]interface{}:
+		redacted := make([]map[string]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactSettings(item)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactValue(key, item)
+		}
+		return redacted
+	}
+	if secretKey.MatchString(key) && value != nil && value != "" {
+		return "<redacted>"
+	}
+	return value
+}
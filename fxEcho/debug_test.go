@@ -0,0 +1,176 @@
+package FxEcho
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type testPrincipal struct {
+	subject string
+	roles   []string
+}
+
+func (p testPrincipal) Subject() string      { return p.subject }
+func (p testPrincipal) HasScope(string) bool { return false }
+func (p testPrincipal) HasRole(role string) bool {
+	for _, r := range p.roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func serveFrom(e *echo.Echo, path, remoteAddr string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remoteAddr
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDebugEndpoints(t *testing.T) {
+	viper.Set("server.listen", false)
+	viper.Set("database.password", "hunter2")
+	viper.Set("servers.admin.port", "9090")
+	viper.Set("servers.admin.debug.enabled", true)
+	viper.Set("servers.admin.debug.allow", []string{"10.0.0.0/8", "127.0.0.1"})
+	defer viper.Reset()
+
+	var servers *Servers
+	var e *echo.Echo
+	app := fxtest.New(t,
+		fx.Provide(
+			newTestConfig,
+			newTestLogger,
+			AsRoute(func() RouteRegistryIf {
+				return GET("/users", exampleHandler).Build()
+			}),
+		),
+		FxEcho,
+		fx.Populate(&servers, &e),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	admin, _ := servers.Get("admin")
+	assert.Equal(t, http.StatusNotFound, serve(e, "/debug/vars").Code)
+
+	assert.Equal(t, http.StatusForbidden, serveFrom(admin.Echo, "/debug/vars", "192.168.1.5:4000").Code)
+	// Forwarded headers are not trusted without an IPExtractor
+	assert.Equal(t, http.StatusForbidden, serveFrom(admin.Echo, "/debug/vars", "192.168.1.5:4000", echo.HeaderXForwardedFor, "10.1.1.1").Code)
+	assert.Equal(t, http.StatusOK, serveFrom(admin.Echo, "/debug/vars", "10.1.2.3:4000").Code)
+
+	rec := serveFrom(admin.Echo, "/debug/pprof/", "127.0.0.1:4000")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "goroutine")
+	assert.Equal(t, http.StatusOK, serveFrom(admin.Echo, "/debug/pprof/heap", "127.0.0.1:4000").Code)
+	assert.Equal(t, http.StatusOK, serveFrom(admin.Echo, "/debug/pprof/cmdline", "127.0.0.1:4000").Code)
+	assert.Equal(t, http.StatusNotFound, serveFrom(admin.Echo, "/debug/pprof/missing", "127.0.0.1:4000").Code)
+	assert.Contains(t, serveFrom(admin.Echo, "/debug/goroutines", "127.0.0.1:4000").Body.String(), "goroutine ")
+
+	var build map[string]any
+	require.NoError(t, json.Unmarshal(serveFrom(admin.Echo, "/debug/build", "127.0.0.1:4000").Body.Bytes(), &build))
+	assert.NotEmpty(t, build["go_version"])
+
+	var config map[string]map[string]any
+	require.NoError(t, json.Unmarshal(serveFrom(admin.Echo, "/debug/config", "127.0.0.1:4000").Body.Bytes(), &config))
+	assert.Equal(t, "<redacted>", config["database"]["password"])
+
+	var routes map[string]struct {
+		Routes []RouteInfo `json:"routes"`
+	}
+	require.NoError(t, json.Unmarshal(serveFrom(admin.Echo, "/debug/routes", "127.0.0.1:4000").Body.Bytes(), &routes))
+	assert.Contains(t, routes[DefaultServer].Routes, RouteInfo{Method: http.MethodGet, Path: "/users"})
+	assert.Contains(t, routes["admin"].Routes, RouteInfo{Method: http.MethodGet, Path: "/debug/vars"})
+}
+
+func TestDebugEndpointsRequireRole(t *testing.T) {
+	viper.Set("server.listen", false)
+	viper.Set("server.debug.enabled", true)
+	viper.Set("server.debug.path", "/_debug")
+	viper.Set("server.debug.roles", []string{"ops"})
+	defer viper.Reset()
+
+	authenticate := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if role := c.Request().Header.Get("X-Role"); role != "" {
+				SetPrincipal(c, testPrincipal{subject: "alice", roles: []string{role}})
+			}
+			return next(c)
+		}
+	}
+
+	var e *echo.Echo
+	app := fxtest.New(t,
+		fx.Provide(
+			newTestConfig,
+			newTestLogger,
+			AsMiddleware(func() MiddlewareRegistryIf {
+				return NewMiddleware(100, authenticate)
+			}),
+		),
+		FxEcho,
+		fx.Populate(&e),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	assert.Equal(t, http.StatusUnauthorized, serve(e, "/_debug/vars").Code)
+	assert.Equal(t, http.StatusForbidden, serveFrom(e, "/_debug/vars", "127.0.0.1:4000", "X-Role", "dev").Code)
+	assert.Equal(t, http.StatusOK, serveFrom(e, "/_debug/vars", "127.0.0.1:4000", "X-Role", "ops").Code)
+}
+
+func TestDebugEndpointsRequireProtection(t *testing.T) {
+	viper.Set("server.debug.enabled", true)
+	defer viper.Reset()
+
+	app := fx.New(fx.NopLogger, fx.Provide(newTestConfig, newTestLogger), FxEcho)
+	assert.Error(t, app.Err())
+	assert.Contains(t, app.Err().Error(), "server.debug requires an allow list or roles")
+
+	viper.Set("server.debug.allow", []string{"not-an-ip"})
+	app = fx.New(fx.NopLogger, fx.Provide(newTestConfig, newTestLogger), FxEcho)
+	assert.Error(t, app.Err())
+	assert.Contains(t, app.Err().Error(), `invalid debug allowlist entry "not-an-ip"`)
+}
+
+func TestRedactSettingsLists(t *testing.T) {
+	settings := map[string]interface{}{
+		"database": map[string]interface{}{
+			"host": "db",
+			"replicas": []interface{}{
+				map[string]interface{}{"host": "replica-1", "password": "s3cret"},
+			},
+		},
+		"auth": map[string]interface{}{
+			"basic": map[string]interface{}{
+				"users": []map[string]interface{}{{"name": "admin", "password_hash": "$2a$10$abc"}},
+			},
+			"api_keys": []interface{}{"key-1", "key-2"},
+		},
+	}
+
+	redacted := redactSettings(settings)
+	database := redacted["database"].(map[string]interface{})
+	assert.Equal(t, "db", database["host"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"host": "replica-1", "password": "<redacted>"}}, database["replicas"])
+	auth := redacted["auth"].(map[string]interface{})
+	assert.Equal(t, []map[string]interface{}{{"name": "admin", "password_hash": "<redacted>"}},
+		auth["basic"].(map[string]interface{})["users"])
+	assert.Equal(t, []interface{}{"<redacted>", "<redacted>"}, auth["api_keys"])
+	// The settings are copied, not modified
+	assert.Equal(t, "s3cret", settings["database"].(map[string]interface{})["replicas"].([]interface{})[0].(map[string]interface{})["password"])
+}
@@ -0,0 +1,156 @@
+package FxEcho
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// drainContextKey stores the drain state of a request in the Echo context
+const drainContextKey = "fxecho.drain"
+
+// drainPollInterval is how often shutdown checks for finished requests
+const drainPollInterval = 10 * time.Millisecond
+
+// ShutdownConfig holds graceful shutdown configuration
+type ShutdownConfig struct {
+	// DrainDelay is how long readiness fails before the listener closes,
+	// giving load balancers time to stop routing traffic
+	DrainDelay time.Duration `mapstructure:"drain_delay"`
+	// Timeout bounds the wait for in-flight requests after the delay
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// Drain tracks the in-flight requests and the draining state of a server
+type Drain struct {
+	draining  atomic.Bool
+	once      sync.Once
+	done      chan struct{}
+	inFlight  atomic.Int64
+	longLived atomic.Int64
+}
+
+// NewDrain creates the drain state of a server
+func NewDrain() *Drain {
+	return &Drain{done: make(chan struct{})}
+}
+
+// Draining reports whether the server is shutting down
+func (d *Drain) Draining() bool {
+	return d.draining.Load()
+}
+
+// Done is closed when the server starts draining. Long-lived handlers
+// should finish their stream when it is closed.
+func (d *Drain) Done() <-chan struct{} {
+	return d.done
+}
+
+// InFlight returns the number of regular requests being served
+func (d *Drain) InFlight() int64 {
+	return d.inFlight.Load()
+}
+
+// LongLived returns the number of open SSE and WebSocket connections
+func (d *Drain) LongLived() int64 {
+	return d.longLived.Load()
+}
+
+// Start marks the server as draining; readiness fails from now on
+func (d *Drain) Start() {
+	d.once.Do(func() {
+		d.draining.Store(true)
+		close(d.done)
+	})
+}
+
+// Wait blocks until every tracked request has finished or ctx is done
+func (d *Drain) Wait(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for d.InFlight()+d.LongLived() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// ReadinessHandler reports 503 once the server is draining
+func (d *Drain) ReadinessHandler(c echo.Context) error {
+	if d.Draining() {
+		return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+			"status": "draining",
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "ready",
+	})
+}
+
+// drainRequest is the tracking state of a single request
+type drainRequest struct {
+	drain     *Drain
+	longLived atomic.Bool
+}
+
+// track counts requests until their handler returns
+func (d *Drain) track() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r := &drainRequest{drain: d}
+			if isLongLived(c.Request()) {
+				r.longLived.Store(true)
+				d.longLived.Add(1)
+			} else {
+				d.inFlight.Add(1)
+			}
+			defer func() {
+				if r.longLived.Load() {
+					d.longLived.Add(-1)
+				} else {
+					d.inFlight.Add(-1)
+				}
+			}()
+
+			c.Set(drainContextKey, r)
+			return next(c)
+		}
+	}
+}
+
+// isLongLived detects WebSocket upgrades and SSE subscriptions
+func isLongLived(r *http.Request) bool {
+	if strings.EqualFold(r.Header.Get(echo.HeaderUpgrade), "websocket") {
+		return true
+	}
+	return strings.Contains(r.Header.Get(echo.HeaderAccept), "text/event-stream")
+}
+
+// MarkLongLived counts the request as a long-lived connection, e.g. for
+// streaming handlers not detected from the request headers
+func MarkLongLived(c echo.Context) {
+	r, ok := c.Get(drainContextKey).(*drainRequest)
+	if !ok || !r.longLived.CompareAndSwap(false, true) {
+		return
+	}
+	r.drain.inFlight.Add(-1)
+	r.drain.longLived.Add(1)
+}
+
+// Draining returns a channel closed when the server serving the request
+// starts draining, or nil when the request is not tracked
+func Draining(c echo.Context) <-chan struct{} {
+	r, ok := c.Get(drainContextKey).(*drainRequest)
+	if !ok {
+		return nil
+	}
+	return r.drain.Done()
+}
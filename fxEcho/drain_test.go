@@ -0,0 +1,148 @@
+package FxEcho
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+func TestDrainTracksRequests(t *testing.T) {
+	drain := NewDrain()
+	e := echo.New()
+	e.Use(drain.track())
+
+	var inFlight, longLived int64
+	e.GET("/work", func(c echo.Context) error {
+		inFlight, longLived = drain.InFlight(), drain.LongLived()
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/stream", func(c echo.Context) error {
+		MarkLongLived(c)
+		inFlight, longLived = drain.InFlight(), drain.LongLived()
+		assert.NotNil(t, Draining(c))
+		return c.NoContent(http.StatusOK)
+	})
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/work", nil))
+	assert.Equal(t, []int64{1, 0}, []int64{inFlight, longLived})
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assert.Equal(t, []int64{0, 1}, []int64{inFlight, longLived})
+
+	req := httptest.NewRequest(http.MethodGet, "/work", nil)
+	req.Header.Set(echo.HeaderAccept, "text/event-stream")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, []int64{0, 1}, []int64{inFlight, longLived})
+
+	assert.Zero(t, drain.InFlight()+drain.LongLived())
+	assert.NoError(t, drain.Wait(context.Background()))
+}
+
+func TestDrainReadiness(t *testing.T) {
+	drain := NewDrain()
+	e := echo.New()
+	e.GET("/ready", drain.ReadinessHandler)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	drain.Start()
+	drain.Start()
+	<-drain.Done()
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestGracefulShutdownCutsOffRequests(t *testing.T) {
+	viper.Set("server.host", "127.0.0.1")
+	viper.Set("server.port", "0")
+	viper.Set("server.shutdown.drain_delay", 1)
+	viper.Set("server.shutdown.timeout", 1)
+	defer viper.Reset()
+
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+
+	var servers *Servers
+	app := fxtest.New(t,
+		fx.Provide(
+			newTestConfig,
+			newTestLogger,
+			AsRoute(func() RouteRegistryIf {
+				return GET("/slow", func(c echo.Context) error {
+					close(started)
+					<-release
+					return c.NoContent(http.StatusOK)
+				}).Build()
+			}),
+		),
+		FxEcho,
+		fx.Populate(&servers),
+	)
+	app.RequireStart()
+
+	server, _ := servers.Get(DefaultServer)
+	require.Eventually(t, func() bool { return server.Echo.ListenerAddr() != nil }, time.Second, 10*time.Millisecond)
+	base := "http://" + server.Echo.ListenerAddr().String()
+
+	go func() {
+		if resp, err := http.Get(base + "/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+	assert.Equal(t, int64(1), server.Drain.InFlight())
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- app.Stop(context.Background()) }()
+
+	// Readiness fails while the listener still accepts connections
+	require.Eventually(t, server.Drain.Draining, time.Second, 10*time.Millisecond)
+	resp, err := http.Get(base + "/ready")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	err = <-stopped
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "1 requests cut off")
+}
+
+func TestGracefulShutdownDrainsServersTogether(t *testing.T) {
+	viper.Set("server.listen", false)
+	viper.Set("server.shutdown.drain_delay", 1)
+	viper.Set("servers.admin.listen", false)
+	viper.Set("servers.admin.port", "9090")
+	viper.Set("servers.admin.shutdown.drain_delay", 1)
+	defer viper.Reset()
+
+	var servers *Servers
+	app := fxtest.New(t,
+		fx.Provide(newTestConfig, newTestLogger),
+		FxEcho,
+		fx.Populate(&servers),
+	)
+	app.RequireStart()
+
+	start := time.Now()
+	app.RequireStop()
+	// The drain delay passes once for all servers
+	assert.Less(t, time.Since(start), 1900*time.Millisecond)
+	for _, name := range servers.Names() {
+		server, _ := servers.Get(name)
+		assert.True(t, server.Drain.Draining(), name)
+	}
+}
@@ -0,0 +1,366 @@
+package FxEcho
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// MIMEApplicationProblemJSON is the RFC 7807 problem details media type
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// StatusClientClosedRequest is returned when the client cancels the request
+const StatusClientClosedRequest = 499
+
+// Error is the standardized error returned by handlers
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Type    string
+	Details any
+	Err     error
+}
+
+// NewError creates a new error with the given HTTP status, code and message
+func NewError(status int, code, message string) *Error {
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+// NewBadRequestError creates a 400 error
+func NewBadRequestError(message string) *Error {
+	return NewError(http.StatusBadRequest, "bad_request", message)
+}
+
+// NewUnauthorizedError creates a 401 error
+func NewUnauthorizedError(message string) *Error {
+	return NewError(http.StatusUnauthorized, "unauthorized", message)
+}
+
+// NewForbiddenError creates a 403 error
+func NewForbiddenError(message string) *Error {
+	return NewError(http.StatusForbidden, "forbidden", message)
+}
+
+// NewNotFoundError creates a 404 error
+func NewNotFoundError(message string) *Error {
+	return NewError(http.StatusNotFound, "not_found", message)
+}
+
+// NewConflictError creates a 409 error
+func NewConflictError(message string) *Error {
+	return NewError(http.StatusConflict, "conflict", message)
+}
+
+// NewInternalError creates a 500 error
+func NewInternalError(message string) *Error {
+	return NewError(http.StatusInternalServerError, "internal_error", message)
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithDetails returns a copy of the error carrying the given details
+func (e *Error) WithDetails(details any) *Error {
+	clone := *e
+	clone.Details = details
+	return &clone
+}
+
+// WithType returns a copy of the error with the given problem type URI
+func (e *Error) WithType(problemType string) *Error {
+	clone := *e
+	clone.Type = problemType
+	return &clone
+}
+
+// Wrap returns a copy of the error with the given underlying cause
+func (e *Error) Wrap(err error) *Error {
+	clone := *e
+	clone.Err = err
+	return &clone
+}
+
+// Problem is the RFC 7807 representation of an error
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Problem converts the error into problem details for the given instance
+func (e *Error) Problem(instance string) *Problem {
+	problemType := e.Type
+	if problemType == "" {
+		problemType = "about:blank"
+	}
+	return &Problem{
+		Type:     problemType,
+		Title:    http.StatusText(e.Status),
+		Status:   e.Status,
+		Detail:   e.Message,
+		Instance: instance,
+		Code:     e.Code,
+		Details:  e.Details,
+	}
+}
+
+// FieldError describes a validation failure on a single field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when request input fails validation
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// NewValidationError creates a new validation error
+func NewValidationError(fields ...FieldError) *ValidationError {
+	return &ValidationError{Fields: fields}
+}
+
+// Add appends a field failure to the validation error
+func (v *ValidationError) Add(field, message string) *ValidationError {
+	v.Fields = append(v.Fields, FieldError{Field: field, Message: message})
+	return v
+}
+
+func (v *ValidationError) Error() string {
+	parts := make([]string, 0, len(v.Fields))
+	for _, f := range v.Fields {
+		parts = append(parts, f.Field+": "+f.Message)
+	}
+	return "validation failed: " + strings.Join(parts, ", ")
+}
+
+// PanicError wraps a value recovered from a panicking handler
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// Recover returns a middleware that converts panics into a PanicError
+// handled by the central error handler
+func Recover() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					if r == http.ErrAbortHandler {
+						panic(r)
+					}
+					stack := make([]byte, 4<<10)
+					stack = stack[:runtime.Stack(stack, false)]
+					err = &PanicError{Value: r, Stack: stack}
+				}
+			}()
+			return next(c)
+		}
+	}
+}
+
+// ErrorMapperIf maps application errors to a standardized Error.
+// MapError returns nil when the error is not handled by the mapper.
+type ErrorMapperIf interface {
+	MapError(err error) *Error
+}
+
+// ErrorMapperFunc adapts a function to the ErrorMapperIf interface
+type ErrorMapperFunc func(err error) *Error
+
+// MapError calls f(err)
+func (f ErrorMapperFunc) MapError(err error) *Error {
+	return f(err)
+}
+
+// AsErrorMapper annotates an error mapper constructor for Fx.
+func AsErrorMapper(f any) any {
+	return fx.Annotate(
+		f,
+		fx.As(new(ErrorMapperIf)),
+		fx.ResultTags(`group:"error_mappers"`),
+	)
+}
+
+// ErrorHandlerParams holds dependencies for the error handler
+type ErrorHandlerParams struct {
+	fx.In
+	Logger  *zap.Logger
+	Mappers []ErrorMapperIf `group:"error_mappers"`
+}
+
+// ErrorHandler is the central HTTP error handler installed on Echo
+type ErrorHandler struct {
+	mu      sync.RWMutex
+	mappers []ErrorMapperIf
+	logger  *zap.Logger
+}
+
+// NewErrorHandler creates the central error handler with registered mappers
+func NewErrorHandler(p ErrorHandlerParams) *ErrorHandler {
+	logger := p.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &ErrorHandler{
+		mappers: append([]ErrorMapperIf(nil), p.Mappers...),
+		logger:  logger,
+	}
+}
+
+// Register adds application error mappers. Mappers are consulted in
+// registration order before the built-in mappings.
+func (h *ErrorHandler) Register(mappers ...ErrorMapperIf) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mappers = append(h.mappers, mappers...)
+}
+
+// Resolve converts any error into a standardized Error
+func (h *ErrorHandler) Resolve(err error) *Error {
+	h.mu.RLock()
+	mappers := h.mappers
+	h.mu.RUnlock()
+
+	for _, m := range mappers {
+		if mapped := m.MapError(err); mapped != nil {
+			return mapped
+		}
+	}
+
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return NewError(http.StatusUnprocessableEntity, "validation_failed", "request validation failed").
+			WithDetails(validationErr.Fields).
+			Wrap(err)
+	}
+
+	var bindingErr *echo.BindingError
+	if errors.As(err, &bindingErr) {
+		return NewError(http.StatusBadRequest, "invalid_request", fmt.Sprint(bindingErr.Message)).
+			WithDetails([]FieldError{{Field: bindingErr.Field, Message: fmt.Sprint(bindingErr.Message)}}).
+			Wrap(err)
+	}
+
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return NewInternalError(http.StatusText(http.StatusInternalServerError)).Wrap(err)
+	}
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return NewNotFoundError("resource not found").Wrap(err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return NewError(http.StatusGatewayTimeout, "timeout", "request timed out").Wrap(err)
+	case errors.Is(err, context.Canceled):
+		return NewError(StatusClientClosedRequest, "canceled", "request canceled").Wrap(err)
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		if inner, ok := httpErr.Internal.(*echo.HTTPError); ok {
+			httpErr = inner
+		}
+		message := http.StatusText(httpErr.Code)
+		switch m := httpErr.Message.(type) {
+		case string:
+			message = m
+		case error:
+			message = m.Error()
+		}
+		return NewError(httpErr.Code, codeForStatus(httpErr.Code), message).Wrap(err)
+	}
+
+	return NewInternalError(http.StatusText(http.StatusInternalServerError)).Wrap(err)
+}
+
+// Handle writes the error as application/problem+json. It satisfies
+// echo.HTTPErrorHandler.
+func (h *ErrorHandler) Handle(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	appErr := h.Resolve(err)
+	req := c.Request()
+
+	fields := []zap.Field{
+		zap.String("method", req.Method),
+		zap.String("path", req.URL.Path),
+		zap.Int("status", appErr.Status),
+		zap.String("code", appErr.Code),
+		zap.Error(err),
+	}
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		fields = append(fields, zap.ByteString("stack", panicErr.Stack))
+	}
+	if appErr.Status >= http.StatusInternalServerError {
+		h.logger.Error("request failed", fields...)
+	} else {
+		h.logger.Debug("request failed", fields...)
+	}
+
+	problem := appErr.Problem(req.URL.Path)
+	problem.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+	if problem.RequestID == "" {
+		problem.RequestID = req.Header.Get(echo.HeaderXRequestID)
+	}
+
+	if req.Method == http.MethodHead {
+		err = c.NoContent(appErr.Status)
+	} else {
+		c.Response().Header().Set(echo.HeaderContentType, MIMEApplicationProblemJSON)
+		err = c.JSON(appErr.Status, problem)
+	}
+	if err != nil {
+		h.logger.Error("failed to write error response", zap.Error(err))
+	}
+}
+
+// codeForStatus derives a machine readable code from an HTTP status
+func codeForStatus(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	text = strings.ReplaceAll(strings.ToLower(text), "'", "")
+	return strings.ReplaceAll(strings.ReplaceAll(text, "-", "_"), " ", "_")
+}
@@ -0,0 +1,148 @@
+package FxEcho
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/UTOL-s/module/fxGorm/query"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+func TestErrorHandlerResolve(t *testing.T) {
+	h := NewErrorHandler(ErrorHandlerParams{Logger: zap.NewNop(), Mappers: []ErrorMapperIf{NewQueryErrorMapper()}})
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"app error", NewConflictError("already exists"), http.StatusConflict, "conflict"},
+		{"wrapped app error", fmt.Errorf("create: %w", NewNotFoundError("missing")), http.StatusNotFound, "not_found"},
+		{"validation", NewValidationError().Add("email", "is required"), http.StatusUnprocessableEntity, "validation_failed"},
+		{"record not found", fmt.Errorf("lookup: %w", gorm.ErrRecordNotFound), http.StatusNotFound, "not_found"},
+		{"invalid query", fmt.Errorf("list: %w: unknown field sku", query.ErrInvalidQuery), http.StatusBadRequest, "invalid_query"},
+		{"deadline", context.DeadlineExceeded, http.StatusGatewayTimeout, "timeout"},
+		{"canceled", context.Canceled, StatusClientClosedRequest, "canceled"},
+		{"echo http error", echo.ErrMethodNotAllowed, http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"panic", &PanicError{Value: "boom"}, http.StatusInternalServerError, "internal_error"},
+		{"unknown", errors.New("db exploded"), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved := h.Resolve(tt.err)
+			assert.Equal(t, tt.status, resolved.Status)
+			assert.Equal(t, tt.code, resolved.Code)
+		})
+	}
+}
+
+func TestErrorHandlerCustomMapper(t *testing.T) {
+	h := NewErrorHandler(ErrorHandlerParams{Logger: zap.NewNop()})
+	h.Register(ErrorMapperFunc(func(err error) *Error {
+		if errors.Is(err, errQuotaExceeded) {
+			return NewError(http.StatusTooManyRequests, "quota_exceeded", "quota exceeded")
+		}
+		return nil
+	}))
+
+	resolved := h.Resolve(fmt.Errorf("upload: %w", errQuotaExceeded))
+	assert.Equal(t, http.StatusTooManyRequests, resolved.Status)
+	assert.Equal(t, "quota_exceeded", resolved.Code)
+}
+
+func TestErrorHandlerProblemResponse(t *testing.T) {
+	h := NewErrorHandler(ErrorHandlerParams{Logger: zap.NewNop()})
+	e := echo.New()
+	e.HTTPErrorHandler = h.Handle
+	e.Use(Recover())
+	e.GET("/users/:id", func(c echo.Context) error {
+		return NewNotFoundError("user not found").WithDetails(map[string]string{"id": c.Param("id")})
+	})
+	e.GET("/panic", func(c echo.Context) error {
+		panic("boom")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+
+	var problem Problem
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+	assert.Equal(t, "about:blank", problem.Type)
+	assert.Equal(t, "Not Found", problem.Title)
+	assert.Equal(t, "user not found", problem.Detail)
+	assert.Equal(t, "/users/42", problem.Instance)
+	assert.Equal(t, "req-1", problem.RequestID)
+
+	req = httptest.NewRequest(http.MethodGet, "/panic", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "boom")
+}
+
+func TestErrorHandlerInstalledByModule(t *testing.T) {
+	var e *echo.Echo
+
+	app := fxtest.New(t,
+		fx.Provide(
+			newTestConfig,
+			newTestLogger,
+			AsRoute(func() RouteRegistryIf {
+				return GET("/quota", func(c echo.Context) error {
+					return errQuotaExceeded
+				}).Build()
+			}),
+			AsRoute(func() RouteRegistryIf {
+				return GET("/list", func(c echo.Context) error {
+					return fmt.Errorf("list: %w", query.ErrInvalidQuery)
+				}).Build()
+			}),
+			AsErrorMapper(func() ErrorMapperIf {
+				return ErrorMapperFunc(func(err error) *Error {
+					if errors.Is(err, errQuotaExceeded) {
+						return NewError(http.StatusTooManyRequests, "quota_exceeded", err.Error())
+					}
+					return nil
+				})
+			}),
+		),
+		FxEcho,
+		fx.Populate(&e),
+	)
+
+	app.RequireStart()
+	defer app.RequireStop()
+
+	req := httptest.NewRequest(http.MethodGet, "/quota", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Contains(t, rec.Body.String(), "quota_exceeded")
+
+	// The query error mapper is registered by the module
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/list", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid_query")
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 
+	fxEcho "github.com/UTOL-s/module/fxEcho"
 	"github.com/UTOL-s/module/fxEcho/example/models"
 )
 
@@ -39,9 +40,7 @@ func (h *UserHandler) GetUser(c echo.Context) error {
 	user, exists := h.userService.GetUserByID(id)
 	if !exists {
 		h.logger.Warn("user not found", zap.String("id", id))
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "User not found",
-		})
+		return fxEcho.NewNotFoundError("User not found")
 	}
 
 	h.logger.Info("retrieved user", zap.String("id", id))
@@ -57,15 +56,18 @@ func (h *UserHandler) CreateUser(c echo.Context) error {
 
 	if err := c.Bind(&request); err != nil {
 		h.logger.Error("failed to bind request", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid request body",
-		})
+		return fxEcho.NewBadRequestError("Invalid request body").Wrap(err)
 	}
 
-	if request.Name == "" || request.Email == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Name and email are required",
-		})
+	validation := fxEcho.NewValidationError()
+	if request.Name == "" {
+		validation.Add("name", "is required")
+	}
+	if request.Email == "" {
+		validation.Add("email", "is required")
+	}
+	if len(validation.Fields) > 0 {
+		return validation
 	}
 
 	user := h.userService.CreateUser(request.Name, request.Email)
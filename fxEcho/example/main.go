@@ -5,6 +5,7 @@ import (
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 
+	fxauth "github.com/UTOL-s/module/fxAuth"
 	fxEcho "github.com/UTOL-s/module/fxEcho"
 	"github.com/UTOL-s/module/fxEcho/example/handlers"
 	"github.com/UTOL-s/module/fxEcho/example/middleware"
@@ -35,6 +36,9 @@ func main() {
 			fxEcho.AsGroup(routes.NewAdminRoutes),
 		),
 
+		// Authenticate requests for routes requiring a role or scopes
+		fxauth.FxAuth,
+
 		// Include the fxEcho module
 		fxEcho.FxEcho,
 
@@ -22,14 +22,15 @@ func NewUserRoutes(userHandler *handlers.UserHandler, requestTimingMiddleware ec
 		Use(requestTimingMiddleware, requestIDMiddleware). // Apply middleware to the entire API group
 		AddRoute(fxEcho.GET("/users", userHandler.ListUsers).Build()).
 		AddRoute(fxEcho.GET("/users/:id", userHandler.GetUser).Build()).
-		AddRoute(fxEcho.POST("/users", userHandler.CreateUser).Build()).
+		AddRoute(fxEcho.POST("/users", userHandler.CreateUser).Idempotent(fxEcho.IdempotencyConfig{}).Build()).
 		Build()
 }
 
-// NewAdminRoutes creates admin routes with different middleware (example for future use)
+// NewAdminRoutes creates admin routes restricted to principals with the admin role
 func NewAdminRoutes(requestTimingMiddleware echo.MiddlewareFunc) fxEcho.GroupRegistryIf {
 	return fxEcho.NewGroup("/admin").
 		Use(requestTimingMiddleware). // Only timing middleware for admin routes
+		RequireRole("admin").
 		AddRoute(fxEcho.GET("/dashboard", func(c echo.Context) error {
 			return c.JSON(200, map[string]string{"message": "Admin dashboard"})
 		}).Build()).
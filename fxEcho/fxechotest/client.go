@@ -0,0 +1,199 @@
+package fxechotest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Request is a request to the application under test, sent on the first
+// expectation or on Do
+type Request struct {
+	app    *App
+	method string
+	path   string
+	header http.Header
+	query  url.Values
+	body   io.Reader
+	resp   *Response
+}
+
+// Request creates a request with the given method and path
+func (a *App) Request(method, path string) *Request {
+	return &Request{
+		app:    a,
+		method: method,
+		path:   path,
+		header: a.header.Clone(),
+		query:  make(url.Values),
+	}
+}
+
+// GET creates a GET request
+func (a *App) GET(path string) *Request {
+	return a.Request(http.MethodGet, path)
+}
+
+// POST creates a POST request
+func (a *App) POST(path string) *Request {
+	return a.Request(http.MethodPost, path)
+}
+
+// PUT creates a PUT request
+func (a *App) PUT(path string) *Request {
+	return a.Request(http.MethodPut, path)
+}
+
+// PATCH creates a PATCH request
+func (a *App) PATCH(path string) *Request {
+	return a.Request(http.MethodPatch, path)
+}
+
+// DELETE creates a DELETE request
+func (a *App) DELETE(path string) *Request {
+	return a.Request(http.MethodDelete, path)
+}
+
+// WithHeader sets a request header
+func (r *Request) WithHeader(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// WithQuery adds a query parameter
+func (r *Request) WithQuery(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// WithBody sets the raw request body
+func (r *Request) WithBody(contentType string, body io.Reader) *Request {
+	r.header.Set(echo.HeaderContentType, contentType)
+	r.body = body
+	return r
+}
+
+// WithJSON encodes v as the JSON request body
+func (r *Request) WithJSON(v any) *Request {
+	r.app.t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		r.app.t.Fatalf("failed to encode request body: %v", err)
+	}
+	return r.WithBody(echo.MIMEApplicationJSON, bytes.NewReader(body))
+}
+
+// Do sends the request once and returns its response
+func (r *Request) Do() *Response {
+	if r.resp != nil {
+		return r.resp
+	}
+
+	target := r.path
+	if len(r.query) > 0 {
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + r.query.Encode()
+	}
+
+	req := httptest.NewRequest(r.method, target, r.body)
+	for key, values := range r.header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	r.app.echo.ServeHTTP(rec, req)
+
+	r.resp = &Response{t: r.app.t, request: r.method + " " + target, Recorder: rec}
+	return r.resp
+}
+
+// ExpectStatus sends the request and checks the response status
+func (r *Request) ExpectStatus(status int) *Response {
+	r.app.t.Helper()
+	return r.Do().ExpectStatus(status)
+}
+
+// ExpectHeader sends the request and checks a response header
+func (r *Request) ExpectHeader(key, value string) *Response {
+	r.app.t.Helper()
+	return r.Do().ExpectHeader(key, value)
+}
+
+// JSON sends the request and decodes the response body into out
+func (r *Request) JSON(out any) *Response {
+	r.app.t.Helper()
+	return r.Do().JSON(out)
+}
+
+// Golden sends the request and compares the response with a golden file
+func (r *Request) Golden(name string, redact ...string) *Response {
+	r.app.t.Helper()
+	return r.Do().Golden(name, redact...)
+}
+
+// Response is the recorded response of a Request
+type Response struct {
+	t        testing.TB
+	request  string
+	Recorder *httptest.ResponseRecorder
+}
+
+// Status returns the response status code
+func (r *Response) Status() int {
+	return r.Recorder.Code
+}
+
+// Header returns the response headers
+func (r *Response) Header() http.Header {
+	return r.Recorder.Header()
+}
+
+// Body returns the response body
+func (r *Response) Body() string {
+	return r.Recorder.Body.String()
+}
+
+// ExpectStatus checks the response status, reporting the body on mismatch
+func (r *Response) ExpectStatus(status int) *Response {
+	r.t.Helper()
+	if r.Recorder.Code != status {
+		r.t.Errorf("%s: expected status %d, got %d\nbody: %s", r.request, status, r.Recorder.Code, r.Body())
+	}
+	return r
+}
+
+// ExpectHeader checks a response header value
+func (r *Response) ExpectHeader(key, value string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Header().Get(key); got != value {
+		r.t.Errorf("%s: expected header %s %q, got %q", r.request, key, value, got)
+	}
+	return r
+}
+
+// ExpectBody checks the raw response body
+func (r *Response) ExpectBody(body string) *Response {
+	r.t.Helper()
+	if got := r.Body(); got != body {
+		r.t.Errorf("%s: expected body %q, got %q", r.request, body, got)
+	}
+	return r
+}
+
+// JSON decodes the response body into out
+func (r *Response) JSON(out any) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), out); err != nil {
+		r.t.Fatalf("%s: failed to decode response body: %v\nbody: %s", r.request, err, r.Body())
+	}
+	return r
+}
@@ -0,0 +1,151 @@
+// Package fxechotest boots fx applications using FxEcho in tests and
+// exercises their routes in-process, without binding a port.
+//
+//	app := fxechotest.New(t,
+//		fxechotest.WithConfig("server.routes.on_conflict", "warn"),
+//		fxechotest.WithOptions(fx.Provide(fxEcho.AsRoute(NewUserRoute))),
+//	)
+//	var users []User
+//	app.GET("/api/users").ExpectStatus(http.StatusOK).JSON(&users)
+package fxechotest
+
+import (
+	"net/http"
+	"testing"
+
+	fxConfig "github.com/UTOL-s/module/fxConfig"
+	fxEcho "github.com/UTOL-s/module/fxEcho"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// App is a started fx application serving requests in-process
+type App struct {
+	t       testing.TB
+	app     *fxtest.App
+	echo    *echo.Echo
+	servers *fxEcho.Servers
+	header  http.Header
+}
+
+type settings struct {
+	config  map[string]any
+	logger  *zap.Logger
+	options []fx.Option
+	module  bool
+}
+
+// Option configures the test application
+type Option func(*settings)
+
+// WithConfig overrides a config key for the lifetime of the test
+func WithConfig(key string, value any) Option {
+	return func(s *settings) {
+		s.config[key] = value
+	}
+}
+
+// WithLogger provides logger instead of a no-op logger
+func WithLogger(logger *zap.Logger) Option {
+	return func(s *settings) {
+		s.logger = logger
+	}
+}
+
+// WithOptions adds fx options, e.g. the routes and modules under test
+func WithOptions(opts ...fx.Option) Option {
+	return func(s *settings) {
+		s.options = append(s.options, opts...)
+	}
+}
+
+// WithoutDefaults stops New from providing the config, the logger and the
+// FxEcho module, for applications whose options already include them
+func WithoutDefaults() Option {
+	return func(s *settings) {
+		s.module = false
+	}
+}
+
+// New starts an fx application with FxEcho and the given options. The
+// HTTP listener is disabled; requests go through Echo directly. The
+// application reads a copy of the global config with the overrides applied
+// and registers metrics with its own registry, so apps may run in parallel
+// tests. The application stops when the test ends.
+func New(t testing.TB, opts ...Option) *App {
+	t.Helper()
+
+	s := &settings{
+		config: map[string]any{"server.listen": false},
+		logger: zap.NewNop(),
+		module: true,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	// Each app reads its own copy of the global config, so overrides do
+	// not leak into other tests, including parallel ones
+	v := viper.New()
+	if err := v.MergeConfigMap(viper.AllSettings()); err != nil {
+		t.Fatalf("failed to copy the config: %v", err)
+	}
+	for key, value := range s.config {
+		v.Set(key, value)
+	}
+	accessor := fxConfig.NewAccessor(v)
+
+	options := []fx.Option{fx.NopLogger}
+	if s.module {
+		options = append(options,
+			fx.Provide(
+				func() *fxConfig.Config {
+					return &fxConfig.Config{Accessor: accessor}
+				},
+				func() *zap.Logger { return s.logger },
+				// A registry per app, the default registerer would reject
+				// the metrics of a second app
+				func() prometheus.Registerer { return prometheus.NewRegistry() },
+			),
+			fxEcho.FxEcho,
+		)
+	}
+	options = append(options, s.options...)
+
+	a := &App{t: t, header: make(http.Header)}
+	options = append(options, fx.Populate(&a.echo, &a.servers))
+
+	a.app = fxtest.New(t, options...)
+	a.app.RequireStart()
+	t.Cleanup(a.app.RequireStop)
+	return a
+}
+
+// Echo returns the application Echo server
+func (a *App) Echo() *echo.Echo {
+	return a.echo
+}
+
+// SetHeader sets a header sent with every request, e.g. Authorization
+func (a *App) SetHeader(key, value string) *App {
+	a.header.Set(key, value)
+	return a
+}
+
+// Server returns a view of the app sending requests to the named server
+// configured under servers.<name>
+func (a *App) Server(name string) *App {
+	a.t.Helper()
+	server, ok := a.servers.Get(name)
+	if !ok {
+		a.t.Fatalf("unknown server %q", name)
+	}
+	view := *a
+	view.echo = server.Echo
+	view.header = a.header.Clone()
+	return &view
+}
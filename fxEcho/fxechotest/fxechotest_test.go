@@ -0,0 +1,131 @@
+package fxechotest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	fxConfig "github.com/UTOL-s/module/fxConfig"
+	fxEcho "github.com/UTOL-s/module/fxEcho"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/fx"
+)
+
+type user struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func testRoutes() fx.Option {
+	return fx.Provide(
+		fxEcho.AsGroup(func() fxEcho.GroupRegistryIf {
+			return fxEcho.NewGroup("/api").
+				AddRoute(fxEcho.GET("/users", func(c echo.Context) error {
+					return c.JSON(http.StatusOK, []user{{ID: 1, Name: c.QueryParam("name"), CreatedAt: time.Now()}})
+				}).Build()).
+				AddRoute(fxEcho.POST("/users", func(c echo.Context) error {
+					if c.Request().Header.Get("Authorization") != "Bearer token" {
+						return fxEcho.NewUnauthorizedError("missing token")
+					}
+					var u user
+					if err := c.Bind(&u); err != nil {
+						return err
+					}
+					u.ID = 2
+					return c.JSON(http.StatusCreated, u)
+				}).Build()).
+				Build()
+		}),
+	)
+}
+
+func TestAppRequests(t *testing.T) {
+	app := New(t, WithOptions(testRoutes()))
+
+	var users []user
+	app.GET("/api/users").WithQuery("name", "alice").ExpectStatus(http.StatusOK).JSON(&users)
+	assert.Equal(t, "alice", users[0].Name)
+
+	app.POST("/api/users").WithJSON(user{Name: "bob"}).
+		ExpectStatus(http.StatusUnauthorized).
+		ExpectHeader(echo.HeaderContentType, fxEcho.MIMEApplicationProblemJSON)
+
+	var created user
+	app.SetHeader("Authorization", "Bearer token")
+	app.POST("/api/users").WithJSON(user{Name: "bob"}).ExpectStatus(http.StatusCreated).JSON(&created)
+	assert.Equal(t, user{ID: 2, Name: "bob"}, created)
+
+	app.GET("/health").ExpectStatus(http.StatusOK)
+}
+
+func TestAppGolden(t *testing.T) {
+	app := New(t, WithOptions(testRoutes()))
+
+	app.GET("/api/users").WithQuery("name", "alice").
+		ExpectStatus(http.StatusOK).
+		Golden("users", "created_at")
+	app.GET("/api/missing").Golden("not_found")
+}
+
+func TestAppConfigOverrides(t *testing.T) {
+	accessor := fxConfig.ConfigAccessor()
+
+	t.Run("override", func(t *testing.T) {
+		app := New(t, WithConfig("server.routes.path", "/admin/routes"))
+
+		var table struct {
+			Routes []fxEcho.RouteInfo `json:"routes"`
+		}
+		app.GET("/admin/routes").ExpectStatus(http.StatusOK).JSON(&table)
+		assert.NotEmpty(t, table.Routes)
+	})
+
+	// Overrides never reach the global config
+	assert.False(t, accessor.IsSet("server.routes.path"))
+	assert.False(t, accessor.IsSet("server.listen"))
+}
+
+func TestAppParallel(t *testing.T) {
+	for _, path := range []string{"/routes/a", "/routes/b"} {
+		t.Run(path, func(t *testing.T) {
+			t.Parallel()
+			app := New(t, WithConfig("server.routes.path", path), WithConfig("server.request_timeout", 5))
+
+			app.GET(path).ExpectStatus(http.StatusOK)
+			for _, other := range []string{"/routes/a", "/routes/b"} {
+				if other != path {
+					app.GET(other).ExpectStatus(http.StatusNotFound)
+				}
+			}
+		})
+	}
+}
+
+func TestAppNamedServer(t *testing.T) {
+	t.Run("admin", func(t *testing.T) {
+		testNamedServer(t)
+	})
+
+	// The override only applied to the app of the subtest
+	app := New(t)
+	_, ok := app.servers.Get("admin")
+	assert.False(t, ok)
+}
+
+func testNamedServer(t *testing.T) {
+	app := New(t,
+		WithConfig("servers.admin.port", "9090"),
+		WithOptions(fx.Provide(
+			fxEcho.AsRoute(func() fxEcho.RouteRegistryIf {
+				return fxEcho.GET("/metrics", func(c echo.Context) error {
+					return c.String(http.StatusOK, "metrics")
+				}).Server("admin").Build()
+			}),
+		)),
+	)
+
+	app.GET("/metrics").ExpectStatus(http.StatusNotFound)
+	app.Server("admin").GET("/metrics").ExpectStatus(http.StatusOK).ExpectBody("metrics")
+}
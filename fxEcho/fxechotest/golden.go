@@ -0,0 +1,101 @@
+package fxechotest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// UpdateEnv regenerates golden files instead of comparing them when set,
+// e.g. FXECHOTEST_UPDATE=1 go test ./...
+const UpdateEnv = "FXECHOTEST_UPDATE"
+
+// Redacted replaces the values of redacted fields in snapshots
+const Redacted = "<redacted>"
+
+// Golden compares the response status, content type and body with
+// testdata/<name>.golden. JSON bodies are indented with sorted keys, and
+// the values of fields named in redact are replaced at any depth so
+// volatile data such as IDs and timestamps does not break snapshots.
+func (r *Response) Golden(name string, redact ...string) *Response {
+	r.t.Helper()
+
+	got := r.snapshot(redact)
+	path := filepath.Join("testdata", name+".golden")
+
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			r.t.Fatalf("failed to create golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			r.t.Fatalf("failed to write golden file: %v", err)
+		}
+		return r
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		r.t.Fatalf("failed to read golden file (run with %s=1 to create it): %v", UpdateEnv, err)
+	}
+	if !bytes.Equal(want, got) {
+		r.t.Errorf("%s: response does not match %s (run with %s=1 to update)\nwant:\n%s\ngot:\n%s",
+			r.request, path, UpdateEnv, want, got)
+	}
+	return r
+}
+
+// snapshot renders the response in its golden file form
+func (r *Response) snapshot(redact []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("status: ")
+	buf.WriteString(strconv.Itoa(r.Recorder.Code) + " ")
+	buf.WriteString(http.StatusText(r.Recorder.Code))
+	buf.WriteString("\ncontent-type: ")
+	buf.WriteString(r.Recorder.Header().Get("Content-Type"))
+	buf.WriteString("\n\n")
+
+	body := r.Recorder.Body.Bytes()
+	var v any
+	if json.Unmarshal(body, &v) == nil {
+		fields := make(map[string]bool, len(redact))
+		for _, f := range redact {
+			fields[f] = true
+		}
+		// encoding/json sorts map keys, which keeps snapshots stable
+		var out bytes.Buffer
+		enc := json.NewEncoder(&out)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if enc.Encode(redactFields(v, fields)) == nil {
+			body = out.Bytes()
+		}
+	}
+	buf.Write(bytes.TrimRight(body, "\n"))
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+// redactFields replaces the values of the named fields in decoded JSON
+func redactFields(v any, fields map[string]bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k := range v {
+			if fields[k] {
+				v[k] = Redacted
+				continue
+			}
+			v[k] = redactFields(v[k], fields)
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = redactFields(v[i], fields)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,441 @@
+package FxEcho
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Idempotency headers
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// ErrIdempotencyKeyLost is returned by IdempotencyStore.Complete when the
+// reservation expired and the key was reserved by another request
+var ErrIdempotencyKeyLost = errors.New("idempotency key reservation lost")
+
+// IdempotencyRecord is the stored outcome of the first request with a key
+type IdempotencyRecord struct {
+	Key string
+	// Fingerprint identifies the method, path and body of the request
+	Fingerprint string
+	// Owner identifies the request holding the reservation
+	Owner string
+	// Completed is false while the first request is still running
+	Completed bool
+	Status    int
+	Header    http.Header
+	Body      []byte
+	ExpiresAt time.Time
+}
+
+// IdempotencyStore records idempotency keys. Implementations must reserve
+// keys atomically so concurrent duplicates see the reservation.
+type IdempotencyStore interface {
+	// Begin reserves key for the owner request until the lease expires. It
+	// returns the existing record when the key is already reserved or
+	// completed, nil otherwise.
+	Begin(ctx context.Context, key, fingerprint, owner string, lease time.Duration) (*IdempotencyRecord, error)
+	// Complete stores the response of the request holding the key, or
+	// returns ErrIdempotencyKeyLost when record.Owner no longer holds it
+	Complete(ctx context.Context, record *IdempotencyRecord) error
+	// Release removes the reservation of owner so the request can be
+	// retried. It leaves the key alone once another request reserved it.
+	Release(ctx context.Context, key, owner string) error
+}
+
+// IdempotencyConfig configures the idempotency middleware
+type IdempotencyConfig struct {
+	Store IdempotencyStore
+	// TTL is how long completed responses are remembered, 24 hours by default
+	TTL time.Duration
+	// LockTimeout is how long a key stays reserved by a request still
+	// running, 1 minute by default. A request crashing its instance holds
+	// the key no longer than this; it should exceed the handler deadline.
+	LockTimeout time.Duration
+	// Methods are the methods honoring the header, POST and PATCH by default
+	Methods []string
+	// Required rejects requests without an Idempotency-Key
+	Required bool
+	// MaxBodySize is the largest request body in bytes, 1MB by default.
+	// Larger requests with a key get 413 Request Entity Too Large.
+	MaxBodySize int64
+	// KeyFunc partitions keys per client, KeyByPrincipal() by default
+	KeyFunc RateLimitKeyFunc
+	Skipper middleware.Skipper
+	// Scope separates keys of applications sharing a store
+	Scope string
+}
+
+// IdempotencyMiddleware returns a middleware replaying the stored response
+// of requests retried with the same Idempotency-Key. Concurrent duplicates
+// get 409 and keys reused for a different request get 422. Errors and 5xx
+// responses release the key so the request can be retried.
+func IdempotencyMiddleware(config IdempotencyConfig) echo.MiddlewareFunc {
+	if config.Store == nil {
+		config.Store = NewMemoryIdempotencyStore()
+	}
+	if config.TTL == 0 {
+		config.TTL = 24 * time.Hour
+	}
+	if config.LockTimeout == 0 {
+		config.LockTimeout = time.Minute
+	}
+	if len(config.Methods) == 0 {
+		config.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = 1 << 20
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = KeyByPrincipal()
+	}
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if !slices.Contains(config.Methods, req.Method) || config.Skipper(c) {
+				return next(c)
+			}
+
+			key := req.Header.Get(HeaderIdempotencyKey)
+			if key == "" {
+				if config.Required {
+					return NewBadRequestError(HeaderIdempotencyKey + " header is required")
+				}
+				return next(c)
+			}
+			if len(key) > 255 {
+				return NewBadRequestError(HeaderIdempotencyKey + " header is too long")
+			}
+			client, err := config.KeyFunc(c)
+			if err != nil {
+				return err
+			}
+			key = storeKey(config.Scope, client, key)
+
+			fingerprint, err := requestFingerprint(req, config.MaxBodySize)
+			if err != nil {
+				return err
+			}
+
+			ctx := req.Context()
+			owner := rand.Text()
+			existing, err := config.Store.Begin(ctx, key, fingerprint, owner, config.LockTimeout)
+			if err != nil {
+				return fmt.Errorf("idempotency store: %w", err)
+			}
+			if existing != nil {
+				switch {
+				case existing.Fingerprint != fingerprint:
+					return NewError(http.StatusUnprocessableEntity, "idempotency_key_reused", "idempotency key was used for a different request")
+				case !existing.Completed:
+					return NewConflictError("a request with this idempotency key is in progress")
+				}
+				return replay(c, existing)
+			}
+
+			// Detach from the request so the outcome is recorded after a disconnect
+			storeCtx := context.WithoutCancel(ctx)
+
+			res := c.Response()
+			writer := res.Writer
+			recorder := &idempotencyRecorder{ResponseWriter: writer}
+			res.Writer = recorder
+			stored := false
+			defer func() {
+				res.Writer = writer
+				// Errors, 5xx responses and panics release the key for a retry
+				if !stored {
+					if releaseErr := config.Store.Release(storeCtx, key, owner); releaseErr != nil {
+						c.Logger().Warnf("failed to release idempotency key: %v", releaseErr)
+					}
+				}
+			}()
+			err = next(c)
+			res.Writer = writer
+			if err != nil || !res.Committed || res.Status >= http.StatusInternalServerError {
+				return err
+			}
+
+			record := &IdempotencyRecord{
+				Key:         key,
+				Fingerprint: fingerprint,
+				Owner:       owner,
+				Completed:   true,
+				Status:      res.Status,
+				Header:      res.Header().Clone(),
+				Body:        recorder.body.Bytes(),
+				ExpiresAt:   time.Now().Add(config.TTL),
+			}
+			if err := config.Store.Complete(storeCtx, record); err != nil {
+				c.Logger().Warnf("failed to store idempotent response: %v", err)
+				return nil
+			}
+			stored = true
+			return nil
+		}
+	}
+}
+
+// storeKey hashes the scope, client and header key into a fixed size key
+func storeKey(scope, client, key string) string {
+	sum := sha256.Sum256([]byte(scope + "\x00" + client + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// requestFingerprint hashes the method, path and body, restoring the body.
+// Bodies above limit are rejected rather than buffered.
+func requestFingerprint(req *http.Request, limit int64) (string, error) {
+	hash := sha256.New()
+	hash.Write([]byte(req.Method + " " + req.URL.Path + "\n"))
+	if req.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+		if err != nil {
+			return "", fmt.Errorf("failed to read request body: %w", err)
+		}
+		if int64(len(body)) > limit {
+			return "", echo.ErrStatusRequestEntityTooLarge
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		hash.Write(body)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// replay writes a stored response
+func replay(c echo.Context, record *IdempotencyRecord) error {
+	header := c.Response().Header()
+	for name, values := range record.Header {
+		header[name] = slices.Clone(values)
+	}
+	header.Set(HeaderIdempotentReplayed, "true")
+	c.Response().WriteHeader(record.Status)
+	_, err := c.Response().Write(record.Body)
+	return err
+}
+
+// idempotencyRecorder copies the response body while writing it
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// MemoryIdempotencyStore is an in-process IdempotencyStore
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[string]*IdempotencyRecord
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryIdempotencyStore creates an empty in-memory store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records: make(map[string]*IdempotencyRecord),
+		now:     time.Now,
+	}
+}
+
+// Begin implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Begin(_ context.Context, key, fingerprint, owner string, lease time.Duration) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	if record, ok := s.records[key]; ok && now.Before(record.ExpiresAt) {
+		copied := *record
+		return &copied, nil
+	}
+	s.records[key] = &IdempotencyRecord{Key: key, Fingerprint: fingerprint, Owner: owner, ExpiresAt: now.Add(lease)}
+	return nil, nil
+}
+
+// Complete implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, record *IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reserved, ok := s.records[record.Key]; !ok || reserved.Owner != record.Owner {
+		return ErrIdempotencyKeyLost
+	}
+	copied := *record
+	s.records[record.Key] = &copied
+	return nil
+}
+
+// Release implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.records[key]; ok && record.Owner == owner && !record.Completed {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+// sweep drops expired keys at most once a minute
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for k, r := range s.records {
+		if !now.Before(r.ExpiresAt) {
+			delete(s.records, k)
+		}
+	}
+}
+
+// IdempotencyKey is the table row of GormIdempotencyStore
+type IdempotencyKey struct {
+	Key         string `gorm:"column:idempotency_key;primaryKey;size:512"`
+	Fingerprint string `gorm:"size:64;not null"`
+	Owner       string `gorm:"size:32;not null"`
+	Completed   bool   `gorm:"not null"`
+	Status      int
+	Header      []byte
+	Body        []byte
+	ExpiresAt   time.Time `gorm:"index;not null"`
+	CreatedAt   time.Time
+}
+
+// TableName implements gorm's Tabler
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
+
+// GormIdempotencyStore stores idempotency keys in a database table,
+// sharing them between instances of the application
+type GormIdempotencyStore struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+// NewGormIdempotencyStore creates a store on db, e.g. the *gorm.DB
+// provided by fxGorm. The idempotency_keys table is created by Migrate or
+// by a migration of the application.
+func NewGormIdempotencyStore(db *gorm.DB) *GormIdempotencyStore {
+	return &GormIdempotencyStore{db: db, now: time.Now}
+}
+
+// NewGormIdempotencyStoreWithLifecycle creates a store on db and its table
+// when the app starts, after the database connects
+func NewGormIdempotencyStoreWithLifecycle(lc fx.Lifecycle, db *gorm.DB) *GormIdempotencyStore {
+	s := NewGormIdempotencyStore(db)
+	lc.Append(fx.Hook{OnStart: s.Migrate})
+	return s
+}
+
+// Migrate creates the idempotency_keys table if needed
+func (s *GormIdempotencyStore) Migrate(ctx context.Context) error {
+	if err := s.db.WithContext(ctx).AutoMigrate(&IdempotencyKey{}); err != nil {
+		return fmt.Errorf("failed to migrate idempotency keys: %w", err)
+	}
+	return nil
+}
+
+// Begin implements IdempotencyStore
+func (s *GormIdempotencyStore) Begin(ctx context.Context, key, fingerprint, owner string, lease time.Duration) (*IdempotencyRecord, error) {
+	db := s.db.WithContext(ctx)
+	now := s.now()
+
+	if err := db.Where("idempotency_key = ? AND expires_at <= ?", key, now).Delete(&IdempotencyKey{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete expired idempotency key: %w", err)
+	}
+
+	row := IdempotencyKey{Key: key, Fingerprint: fingerprint, Owner: owner, ExpiresAt: now.Add(lease), CreatedAt: now}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", result.Error)
+	}
+	if result.RowsAffected == 1 {
+		return nil, nil
+	}
+
+	var existing IdempotencyKey
+	if err := db.Where("idempotency_key = ?", key).Take(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to load idempotency key: %w", err)
+	}
+	record := &IdempotencyRecord{
+		Key:         existing.Key,
+		Fingerprint: existing.Fingerprint,
+		Completed:   existing.Completed,
+		Status:      existing.Status,
+		Body:        existing.Body,
+		ExpiresAt:   existing.ExpiresAt,
+	}
+	if len(existing.Header) > 0 {
+		if err := json.Unmarshal(existing.Header, &record.Header); err != nil {
+			return nil, fmt.Errorf("failed to decode idempotent response headers: %w", err)
+		}
+	}
+	return record, nil
+}
+
+// Complete implements IdempotencyStore
+func (s *GormIdempotencyStore) Complete(ctx context.Context, record *IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotent response headers: %w", err)
+	}
+	result := s.db.WithContext(ctx).Model(&IdempotencyKey{}).
+		Where("idempotency_key = ? AND owner = ?", record.Key, record.Owner).
+		Updates(map[string]any{
+			"completed":  true,
+			"status":     record.Status,
+			"header":     header,
+			"body":       record.Body,
+			"expires_at": record.ExpiresAt,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrIdempotencyKeyLost
+	}
+	return nil
+}
+
+// Release implements IdempotencyStore
+func (s *GormIdempotencyStore) Release(ctx context.Context, key, owner string) error {
+	err := s.db.WithContext(ctx).Where("idempotency_key = ? AND owner = ? AND completed = ?", key, owner, false).Delete(&IdempotencyKey{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Sweep deletes expired keys, e.g. from a periodic job
+func (s *GormIdempotencyStore) Sweep(ctx context.Context) error {
+	if err := s.db.WithContext(ctx).Where("expires_at <= ?", s.now()).Delete(&IdempotencyKey{}).Error; err != nil {
+		return fmt.Errorf("failed to sweep idempotency keys: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package FxEcho
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newIdempotentEcho(store IdempotencyStore, calls *atomic.Int32, block chan struct{}) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = NewErrorHandler(ErrorHandlerParams{Logger: newTestLogger()}).Handle
+
+	route := POST("/users", func(c echo.Context) error {
+		n := calls.Add(1)
+		if block != nil {
+			<-block
+		}
+		if c.QueryParam("fail") != "" {
+			return NewInternalError("failed")
+		}
+		c.Response().Header().Set("X-User", "created")
+		return c.JSON(http.StatusCreated, map[string]int32{"id": n})
+	}).Idempotent(IdempotencyConfig{Store: store, Required: true}).Build()
+	e.Add(route.Method(), route.Path(), route.Handle)
+	return e
+}
+
+func postWithKey(e *echo.Echo, target, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if key != "" {
+		req.Header.Set(HeaderIdempotencyKey, key)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func newIdempotencyStores(t *testing.T) map[string]IdempotencyStore {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// A single connection keeps the in-memory database shared
+	sqlDB.SetMaxOpenConns(1)
+	gormStore := NewGormIdempotencyStore(db)
+	require.NoError(t, gormStore.Migrate(context.Background()))
+
+	return map[string]IdempotencyStore{
+		"memory": NewMemoryIdempotencyStore(),
+		"gorm":   gormStore,
+	}
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	for name, store := range newIdempotencyStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var calls atomic.Int32
+			e := newIdempotentEcho(store, &calls, nil)
+
+			first := postWithKey(e, "/users", "key-1", `{"name":"bob"}`)
+			assert.Equal(t, http.StatusCreated, first.Code)
+
+			retry := postWithKey(e, "/users", "key-1", `{"name":"bob"}`)
+			assert.Equal(t, http.StatusCreated, retry.Code)
+			assert.Equal(t, first.Body.String(), retry.Body.String())
+			assert.Equal(t, "created", retry.Header().Get("X-User"))
+			assert.Equal(t, "true", retry.Header().Get(HeaderIdempotentReplayed))
+			assert.Equal(t, int32(1), calls.Load())
+
+			// Reusing the key for another request is rejected
+			assert.Equal(t, http.StatusUnprocessableEntity, postWithKey(e, "/users", "key-1", `{"name":"ann"}`).Code)
+
+			// Failures release the key
+			assert.Equal(t, http.StatusInternalServerError, postWithKey(e, "/users?fail=1", "key-2", `{}`).Code)
+			assert.Equal(t, http.StatusInternalServerError, postWithKey(e, "/users?fail=1", "key-2", `{}`).Code)
+			assert.Equal(t, int32(3), calls.Load())
+
+			assert.Equal(t, http.StatusBadRequest, postWithKey(e, "/users", "", `{}`).Code)
+		})
+	}
+}
+
+func TestIdempotencyConcurrentDuplicate(t *testing.T) {
+	for name, store := range newIdempotencyStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var calls atomic.Int32
+			block := make(chan struct{})
+			e := newIdempotentEcho(store, &calls, block)
+
+			done := make(chan *httptest.ResponseRecorder)
+			go func() { done <- postWithKey(e, "/users", "key-1", `{}`) }()
+			require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+			rec := postWithKey(e, "/users", "key-1", `{}`)
+			assert.Equal(t, http.StatusConflict, rec.Code)
+
+			close(block)
+			assert.Equal(t, http.StatusCreated, (<-done).Code)
+			assert.Equal(t, int32(1), calls.Load())
+		})
+	}
+}
+
+func TestIdempotencyPanicReleasesKey(t *testing.T) {
+	for name, store := range newIdempotencyStores(t) {
+		t.Run(name, func(t *testing.T) {
+			e := echo.New()
+			e.HTTPErrorHandler = NewErrorHandler(ErrorHandlerParams{Logger: newTestLogger()}).Handle
+			e.Use(Recover())
+			var calls atomic.Int32
+			route := POST("/users", func(c echo.Context) error {
+				if calls.Add(1) == 1 {
+					panic("boom")
+				}
+				return c.NoContent(http.StatusCreated)
+			}).Idempotent(IdempotencyConfig{Store: store}).Build()
+			e.Add(route.Method(), route.Path(), route.Handle)
+
+			assert.Equal(t, http.StatusInternalServerError, postWithKey(e, "/users", "key-1", `{}`).Code)
+			assert.Equal(t, http.StatusCreated, postWithKey(e, "/users", "key-1", `{}`).Code)
+			assert.Equal(t, int32(2), calls.Load())
+		})
+	}
+}
+
+func TestIdempotencyKeysPerClient(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = NewErrorHandler(ErrorHandlerParams{Logger: newTestLogger()}).Handle
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if subject := c.Request().Header.Get("X-User"); subject != "" {
+				SetPrincipal(c, testPrincipal{subject: subject})
+			}
+			return next(c)
+		}
+	})
+	var calls atomic.Int32
+	route := POST("/users", func(c echo.Context) error {
+		return c.JSON(http.StatusCreated, map[string]int32{"id": calls.Add(1)})
+	}).Idempotent(IdempotencyConfig{MaxBodySize: 16}).Build()
+	e.Add(route.Method(), route.Path(), route.Handle)
+
+	post := func(remoteAddr, user, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(HeaderIdempotencyKey, "key-1")
+		req.Header.Set("X-User", user)
+		// Forwarded headers are not trusted without an IP extractor
+		req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.9")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Keys are scoped to the principal, or to the peer address without one
+	assert.Equal(t, `{"id":1}`+"\n", post("192.0.2.1:1000", "", `{}`).Body.String())
+	assert.Equal(t, `{"id":2}`+"\n", post("192.0.2.2:1000", "", `{}`).Body.String())
+	assert.Equal(t, `{"id":1}`+"\n", post("192.0.2.1:2000", "", `{}`).Body.String())
+	assert.Equal(t, `{"id":3}`+"\n", post("192.0.2.1:1000", "alice", `{}`).Body.String())
+	assert.Equal(t, `{"id":3}`+"\n", post("192.0.2.9:1000", "alice", `{}`).Body.String())
+	assert.Equal(t, `{"id":4}`+"\n", post("192.0.2.1:1000", "bob", `{}`).Body.String())
+
+	// Long keys are hashed, bodies above the limit are rejected
+	rec := post("192.0.2.1:1000", strings.Repeat("x", 1000), `{}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("192.0.2.1:1000", "", `{"name":"a long name"}`).Code)
+	assert.Equal(t, int32(5), calls.Load())
+}
+
+func TestIdempotencyExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	memory := NewMemoryIdempotencyStore()
+	memory.now = func() time.Time { return now }
+	gormStore := newIdempotencyStores(t)["gorm"].(*GormIdempotencyStore)
+	gormStore.now = func() time.Time { return now }
+
+	for name, store := range map[string]IdempotencyStore{"memory": memory, "gorm": gormStore} {
+		t.Run(name, func(t *testing.T) {
+			existing, err := store.Begin(ctx, "key", "fp", "first", time.Minute)
+			require.NoError(t, err)
+			assert.Nil(t, existing)
+
+			existing, err = store.Begin(ctx, "key", "fp", "second", time.Minute)
+			require.NoError(t, err)
+			require.NotNil(t, existing)
+			assert.False(t, existing.Completed)
+
+			require.NoError(t, store.Complete(ctx, &IdempotencyRecord{
+				Key: "key", Fingerprint: "fp", Owner: "first", Completed: true, Status: http.StatusCreated,
+				Header: http.Header{"X-Id": {"1"}}, Body: []byte("ok"), ExpiresAt: now.Add(time.Minute),
+			}))
+			existing, err = store.Begin(ctx, "key", "fp", "second", time.Minute)
+			require.NoError(t, err)
+			assert.True(t, existing.Completed)
+			assert.Equal(t, "1", existing.Header.Get("X-Id"))
+			assert.Equal(t, "ok", string(existing.Body))
+
+			now = now.Add(2 * time.Minute)
+			existing, err = store.Begin(ctx, "key", "fp", "second", time.Minute)
+			require.NoError(t, err)
+			assert.Nil(t, existing)
+
+			// A request whose lease expired neither releases nor completes
+			// the reservation of the request that took the key over
+			now = now.Add(2 * time.Minute)
+			existing, err = store.Begin(ctx, "key", "fp", "third", time.Minute)
+			require.NoError(t, err)
+			assert.Nil(t, existing)
+			require.NoError(t, store.Release(ctx, "key", "second"))
+			assert.ErrorIs(t, store.Complete(ctx, &IdempotencyRecord{
+				Key: "key", Fingerprint: "fp", Owner: "second", Completed: true, Status: http.StatusCreated,
+				ExpiresAt: now.Add(time.Minute),
+			}), ErrIdempotencyKeyLost)
+			existing, err = store.Begin(ctx, "key", "fp", "fourth", time.Minute)
+			require.NoError(t, err)
+			require.NotNil(t, existing)
+			assert.False(t, existing.Completed)
+
+			require.NoError(t, store.Release(ctx, "key", "third"))
+			existing, err = store.Begin(ctx, "key", "fp", "fourth", time.Minute)
+			require.NoError(t, err)
+			assert.Nil(t, existing)
+		})
+	}
+	assert.NoError(t, gormStore.Sweep(ctx))
+}
+
+func TestGormIdempotencyStoreLifecycle(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	var store *GormIdempotencyStore
+	app := fxtest.New(t,
+		fx.Supply(db),
+		fx.Provide(NewGormIdempotencyStoreWithLifecycle),
+		fx.Populate(&store),
+	)
+	assert.False(t, db.Migrator().HasTable(&IdempotencyKey{}), "the table is created on start")
+	app.RequireStart()
+	defer app.RequireStop()
+	assert.True(t, db.Migrator().HasTable(&IdempotencyKey{}))
+}
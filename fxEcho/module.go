@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	fxConfig "github.com/UTOL-s/module/fxConfig"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
@@ -22,36 +25,100 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout time.Duration `mapstructure:"write_timeout"`
 	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
+	// RequestTimeout is the default handler deadline, zero for none
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+	// RequestTimeoutStatus answers exceeded deadlines, 503 or 504
+	RequestTimeoutStatus int `mapstructure:"request_timeout_status"`
+	// Listen starts the HTTP listener on start; tests disable it
+	Listen   bool           `mapstructure:"listen"`
+	Routes   RoutesConfig   `mapstructure:"routes"`
+	Shutdown ShutdownConfig `mapstructure:"shutdown"`
+	Debug    DebugConfig    `mapstructure:"debug"`
+}
+
+// RoutesConfig holds route table configuration
+type RoutesConfig struct {
+	// OnConflict is "error" to fail startup on duplicate routes or "warn"
+	OnConflict string `mapstructure:"on_conflict"`
+	// Path serves the route table when set, e.g. "/internal/routes". The
+	// endpoint is public unless Allow or Roles restrict it.
+	Path string `mapstructure:"path"`
+	// Allow lists client IPs or CIDR ranges, e.g. "10.0.0.0/8"
+	Allow []string `mapstructure:"allow"`
+	// Roles admits authenticated principals with any of these roles
+	Roles []string `mapstructure:"roles"`
 }
 
 // EchoParams holds all dependencies for Echo server
 type EchoParams struct {
 	fx.In
-	Lifecycle   fx.Lifecycle
-	Routes      []RouteRegistryIf `group:"routes"`
-	Groups      []GroupRegistryIf `group:"groups"`
-	Config      *fxConfig.Config
-	Middlewares []echo.MiddlewareFunc `group:"middlewares"`
-	Logger      *zap.Logger
+	Lifecycle    fx.Lifecycle
+	Routes       []RouteRegistryIf `group:"routes"`
+	Groups       []GroupRegistryIf `group:"groups"`
+	Config       *fxConfig.Config
+	Middlewares  []echo.MiddlewareFunc  `group:"middlewares"`
+	Registered   []MiddlewareRegistryIf `group:"middlewares"`
+	Logger       *zap.Logger
+	ErrorHandler *ErrorHandler
+	RouteTable   *RouteTable
+	// Registerer receives the request timeout counter, the default
+	// registerer when the app provides none
+	Registerer prometheus.Registerer `optional:"true"`
 }
 
 var FxEcho = fx.Module(
 	ModuleName,
 	fx.Provide(
 		NewEcho,
+		NewServers,
 		NewServerConfig,
+		NewErrorHandler,
+		NewRouteTable,
+		NewStreamHub,
+		AsErrorMapper(NewQueryErrorMapper),
 	),
 	fx.Invoke(func(e *echo.Echo) {}),
 )
 
-// NewServerConfig creates server configuration from fxConfig
+// NewServerConfig creates the default server configuration from fxConfig
 func NewServerConfig(config *fxConfig.Config) (*ServerConfig, error) {
+	return newServerConfig(config.Accessor, "server", nil)
+}
+
+// newServerConfig reads the server configuration under prefix. Named
+// servers inherit the listen flag of the default server.
+func newServerConfig(accessor *fxConfig.Accessor, prefix string, base *ServerConfig) (*ServerConfig, error) {
 	serverConfig := &ServerConfig{
-		Host:         config.Accessor.String("server.host"),
-		Port:         config.Accessor.String("server.port"),
-		ReadTimeout:  time.Duration(config.Accessor.Int("server.read_timeout")) * time.Second,
-		WriteTimeout: time.Duration(config.Accessor.Int("server.write_timeout")) * time.Second,
-		IdleTimeout:  time.Duration(config.Accessor.Int("server.idle_timeout")) * time.Second,
+		Host:                 accessor.String(prefix + ".host"),
+		Port:                 accessor.String(prefix + ".port"),
+		ReadTimeout:          time.Duration(accessor.Int(prefix+".read_timeout")) * time.Second,
+		WriteTimeout:         time.Duration(accessor.Int(prefix+".write_timeout")) * time.Second,
+		IdleTimeout:          time.Duration(accessor.Int(prefix+".idle_timeout")) * time.Second,
+		RequestTimeout:       time.Duration(accessor.Int(prefix+".request_timeout")) * time.Second,
+		RequestTimeoutStatus: accessor.Int(prefix + ".request_timeout_status"),
+		Listen:               true,
+		Routes: RoutesConfig{
+			OnConflict: accessor.String(prefix + ".routes.on_conflict"),
+			Path:       accessor.String(prefix + ".routes.path"),
+			Allow:      accessor.StringSlice(prefix + ".routes.allow"),
+			Roles:      accessor.StringSlice(prefix + ".routes.roles"),
+		},
+		Shutdown: ShutdownConfig{
+			DrainDelay: time.Duration(accessor.Int(prefix+".shutdown.drain_delay")) * time.Second,
+			Timeout:    time.Duration(accessor.Int(prefix+".shutdown.timeout")) * time.Second,
+		},
+		Debug: DebugConfig{
+			Enabled: accessor.Bool(prefix + ".debug.enabled"),
+			Path:    accessor.String(prefix + ".debug.path"),
+			Allow:   accessor.StringSlice(prefix + ".debug.allow"),
+			Roles:   accessor.StringSlice(prefix + ".debug.roles"),
+		},
+	}
+	if base != nil {
+		serverConfig.Listen = base.Listen
+	}
+	if accessor.IsSet(prefix + ".listen") {
+		serverConfig.Listen = accessor.Bool(prefix + ".listen")
 	}
 
 	// Set defaults if not configured
@@ -59,6 +126,9 @@ func NewServerConfig(config *fxConfig.Config) (*ServerConfig, error) {
 		serverConfig.Host = "0.0.0.0"
 	}
 	if serverConfig.Port == "" {
+		if base != nil {
+			return nil, fmt.Errorf("%s.port is required", prefix)
+		}
 		serverConfig.Port = "8080"
 	}
 	if serverConfig.ReadTimeout == 0 {
@@ -70,20 +140,49 @@ func NewServerConfig(config *fxConfig.Config) (*ServerConfig, error) {
 	if serverConfig.IdleTimeout == 0 {
 		serverConfig.IdleTimeout = 60 * time.Second
 	}
+	if serverConfig.RequestTimeoutStatus == 0 {
+		serverConfig.RequestTimeoutStatus = http.StatusGatewayTimeout
+	}
+	if !validTimeoutStatus(serverConfig.RequestTimeoutStatus) {
+		return nil, fmt.Errorf("invalid %s.request_timeout_status %d, must be 503 or 504", prefix, serverConfig.RequestTimeoutStatus)
+	}
+	if serverConfig.Shutdown.Timeout == 0 {
+		serverConfig.Shutdown.Timeout = 30 * time.Second
+	}
+	if serverConfig.Routes.OnConflict == "" {
+		serverConfig.Routes.OnConflict = RouteConflictError
+	}
+	if serverConfig.Routes.OnConflict != RouteConflictError && serverConfig.Routes.OnConflict != RouteConflictWarn {
+		return nil, fmt.Errorf("invalid %s.routes.on_conflict %q", prefix, serverConfig.Routes.OnConflict)
+	}
+	if serverConfig.Debug.Path == "" {
+		serverConfig.Debug.Path = "/debug"
+	}
+	if serverConfig.Debug.Enabled && len(serverConfig.Debug.Allow) == 0 && len(serverConfig.Debug.Roles) == 0 {
+		return nil, fmt.Errorf("%s.debug requires an allow list or roles", prefix)
+	}
 
 	return serverConfig, nil
 }
 
-// NewEcho creates and configures Echo server with FX lifecycle management
-func NewEcho(p EchoParams) (*echo.Echo, error) {
+// NewEcho returns the default Echo server
+func NewEcho(servers *Servers) *echo.Echo {
+	server, _ := servers.Get(DefaultServer)
+	return server.Echo
+}
+
+// newServer creates and configures an Echo server with FX lifecycle management
+func newServer(p EchoParams, name string, serverConfig *ServerConfig, table *RouteTable, servers *Servers) (*Server, error) {
+	logger := p.Logger.With(zap.String("server", name))
+	drain := NewDrain()
+
 	// Create Echo instance
 	e := echo.New()
 	e.HideBanner = true
-
-	// Configure server settings
-	serverConfig, err := NewServerConfig(p.Config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create server config: %w", err)
+	e.HTTPErrorHandler = p.ErrorHandler.Handle
+	table.mount(e)
+	e.OnAddRouteHandler = func(_ string, route echo.Route, _ echo.HandlerFunc, _ []echo.MiddlewareFunc) {
+		table.record(route)
 	}
 
 	// Set up HTTP server with timeouts
@@ -94,10 +193,16 @@ func NewEcho(p EchoParams) (*echo.Echo, error) {
 		IdleTimeout:  serverConfig.IdleTimeout,
 	}
 
+	// Track in-flight requests for graceful draining
+	e.Use(drain.track())
+
+	// Apply the default handler deadline
+	e.Use(requestTimeout(serverConfig.RequestTimeout))
+
 	// Add default middlewares if none provided
 	if len(p.Middlewares) == 0 {
 		e.Use(middleware.Logger())
-		e.Use(middleware.Recover())
+		e.Use(Recover())
 		e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 			AllowOrigins: []string{"*"},
 			AllowMethods: []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete},
@@ -107,31 +212,110 @@ func NewEcho(p EchoParams) (*echo.Echo, error) {
 		for _, m := range p.Middlewares {
 			e.Use(m)
 		}
+		e.Use(Recover())
 	}
 
+	// Add middlewares registered through AsMiddleware, highest priority first
+	registered := make([]MiddlewareRegistryIf, 0, len(p.Registered))
+	for _, m := range p.Registered {
+		if m.Server() == "" || m.Server() == name {
+			registered = append(registered, m)
+		}
+	}
+	sort.SliceStable(registered, func(i, j int) bool {
+		return registered[i].Priority() > registered[j].Priority()
+	})
+	for _, m := range registered {
+		e.Use(m.Middleware())
+	}
+
+	// Report exceeded deadlines before the middlewares above handle the error
+	e.Use(reportTimeouts(name, serverConfig.RequestTimeoutStatus, logger, servers.timeouts))
+
 	// Register route groups
 	for _, group := range p.Groups {
+		if targetServer(group.Server()) != name {
+			continue
+		}
 		g := e.Group(group.Prefix())
 		group.Register(g)
+		table.addAliases(group)
 	}
 
 	// Register individual routes
 	for _, route := range p.Routes {
-		e.Add(route.Method(), route.Path(), route.Handle)
+		if targetServer(route.Server()) != name {
+			continue
+		}
+		addRoute(e.Add, route)
 	}
 
-	// Add health check endpoint
-	e.GET("/health", func(c echo.Context) error {
-		return c.JSON(http.StatusOK, map[string]interface{}{
-			"status": "healthy",
-			"time":   time.Now().UTC(),
+	// Add health check endpoint unless the application provides its own
+	if _, ok := table.Lookup(http.MethodGet, "/health"); !ok {
+		e.GET("/health", func(c echo.Context) error {
+			return c.JSON(http.StatusOK, map[string]interface{}{
+				"status": "healthy",
+				"time":   time.Now().UTC(),
+			})
 		})
-	})
+	}
+
+	// Add readiness endpoint, failing while the server drains
+	if _, ok := table.Lookup(http.MethodGet, "/ready"); !ok {
+		e.GET("/ready", drain.ReadinessHandler)
+	}
+
+	// Add the debug endpoints when enabled
+	if serverConfig.Debug.Enabled {
+		if err := mountDebug(e, serverConfig.Debug, p.Config.Accessor, servers); err != nil {
+			return nil, fmt.Errorf("failed to mount debug endpoints on server %s: %w", name, err)
+		}
+	}
+
+	// Expose the route table when configured
+	if serverConfig.Routes.Path != "" {
+		networks, err := parseAllowList(serverConfig.Routes.Allow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route table allowlist on server %s: %w", name, err)
+		}
+		var middlewares []echo.MiddlewareFunc
+		if len(networks) > 0 {
+			middlewares = append(middlewares, allowNetworks(networks))
+		}
+		if len(serverConfig.Routes.Roles) > 0 {
+			middlewares = append(middlewares, RequireRole(serverConfig.Routes.Roles...))
+		}
+		e.GET(serverConfig.Routes.Path, table.Handler, middlewares...)
+	}
+
+	table.syncNames(e.Routes())
+	if conflicts := table.Conflicts(); len(conflicts) > 0 {
+		descriptions := make([]string, 0, len(conflicts))
+		for _, c := range conflicts {
+			descriptions = append(descriptions, c.String())
+		}
+		if serverConfig.Routes.OnConflict == RouteConflictError {
+			return nil, fmt.Errorf("duplicate routes registered on server %s: %s", name, strings.Join(descriptions, "; "))
+		}
+		logger.Warn("duplicate routes registered", zap.Strings("conflicts", descriptions))
+	}
 
-	// Configure FX lifecycle hooks
+	routes := table.Routes()
+	routeList := make([]string, 0, len(routes))
+	for _, r := range routes {
+		routeList = append(routeList, r.String())
+	}
+	logger.Info("registered routes", zap.Int("count", len(routes)), zap.Strings("routes", routeList))
+
+	// Start the listener; Servers stops every server with a single hook
 	p.Lifecycle.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
-			p.Logger.Info("starting Echo server",
+			if !serverConfig.Listen {
+				logger.Info("Echo server listener disabled")
+				return nil
+			}
+
+			logger.Info("starting Echo server",
 				zap.String("address", e.Server.Addr),
 				zap.String("host", serverConfig.Host),
 				zap.String("port", serverConfig.Port),
@@ -139,27 +323,44 @@ func NewEcho(p EchoParams) (*echo.Echo, error) {
 
 			go func() {
 				if err := e.Start(e.Server.Addr); err != nil && err != http.ErrServerClosed {
-					p.Logger.Error("failed to start Echo server", zap.Error(err))
+					logger.Error("failed to start Echo server", zap.Error(err))
 				}
 			}()
 			return nil
 		},
-		OnStop: func(ctx context.Context) error {
-			p.Logger.Info("shutting down Echo server")
+	})
 
-			// Create shutdown context with timeout
-			shutdownCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-			defer cancel()
+	return &Server{Name: name, Echo: e, Config: serverConfig, Routes: table, Drain: drain, logger: logger}, nil
+}
 
-			if err := e.Shutdown(shutdownCtx); err != nil {
-				p.Logger.Error("error during server shutdown", zap.Error(err))
-				return err
-			}
+// shutdown closes the listener of a draining server and waits for its
+// in-flight requests, cutting them off after the shutdown timeout
+func (s *Server) shutdown(ctx context.Context) error {
+	s.logger.Info("shutting down Echo server")
 
-			p.Logger.Info("Echo server shutdown completed")
-			return nil
-		},
-	})
+	// Create shutdown context with timeout
+	shutdownCtx, cancel := context.WithTimeout(ctx, s.Config.Shutdown.Timeout)
+	defer cancel()
+
+	// Shutdown does not wait for hijacked WebSocket connections
+	err := s.Echo.Shutdown(shutdownCtx)
+	if err == nil {
+		err = s.Drain.Wait(shutdownCtx)
+	}
+	if err != nil {
+		cutOff := s.Drain.InFlight() + s.Drain.LongLived()
+		if closeErr := s.Echo.Close(); closeErr != nil {
+			s.logger.Error("failed to close Echo server", zap.Error(closeErr))
+		}
+		s.logger.Error("error during server shutdown",
+			zap.Int64("cut_off", cutOff),
+			zap.Int64("in_flight", s.Drain.InFlight()),
+			zap.Int64("long_lived", s.Drain.LongLived()),
+			zap.Error(err),
+		)
+		return fmt.Errorf("failed to drain Echo server %s, %d requests cut off: %w", s.Name, cutOff, err)
+	}
 
-	return e, nil
+	s.logger.Info("Echo server shutdown completed", zap.Int64("cut_off", 0))
+	return nil
 }
@@ -0,0 +1,133 @@
+package FxEcho
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Route metadata keys used in generated OpenAPI documents
+const (
+	MetaSummary     = "openapi.summary"
+	MetaDescription = "openapi.description"
+	MetaTags        = "openapi.tags"
+)
+
+// OpenAPIInfo describes the API in generated OpenAPI documents
+type OpenAPIInfo struct {
+	Title       string
+	Description string
+}
+
+// OpenAPI serves an OpenAPI 3 document per version of a versioned group
+// at <prefix>/openapi/<version>.json
+func (gb *GroupBuilder) OpenAPI(info OpenAPIInfo) *GroupBuilder {
+	gb.openAPI = &info
+	return gb
+}
+
+// registerOpenAPI mounts the per-version OpenAPI documents
+func registerOpenAPI(group *echo.Group, info OpenAPIInfo, strategy VersionStrategy, versions []*VersionBuilder) {
+	for _, v := range versions {
+		docPath := "/openapi/" + v.name + ".json"
+		group.GET(docPath, func(c echo.Context) error {
+			// The group base URL is the matched route path without the document
+			base := strings.TrimSuffix(c.Path(), docPath)
+			return c.JSON(http.StatusOK, openAPIDocument(base, info, strategy, v))
+		})
+	}
+}
+
+// openAPIDocument builds the OpenAPI document of a single version
+func openAPIDocument(base string, info OpenAPIInfo, strategy VersionStrategy, version *VersionBuilder) map[string]any {
+	if strategy.kind == versionByPath {
+		base += "/" + version.name
+	}
+
+	paths := make(map[string]map[string]any)
+	for _, route := range version.routes {
+		path, params := openAPIPath(route.Path())
+		if strategy.kind == versionByHeader {
+			params = append(params, map[string]any{
+				"name":     strategy.header,
+				"in":       "header",
+				"required": false,
+				"schema":   map[string]any{"type": "string", "enum": []string{version.name}},
+			})
+		}
+
+		operation := map[string]any{
+			"responses": map[string]any{
+				"default": map[string]any{"description": "Response"},
+			},
+		}
+		if route.Name() != "" {
+			operation["operationId"] = route.Name()
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if version.deprecation != nil {
+			operation["deprecated"] = true
+		}
+		meta := route.Metadata()
+		for key, field := range map[string]string{MetaSummary: "summary", MetaDescription: "description", MetaTags: "tags"} {
+			if v, ok := meta[key]; ok {
+				operation[field] = v
+			}
+		}
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(route.Method())] = operation
+	}
+
+	title := info.Title
+	if title == "" {
+		title = "API"
+	}
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   title,
+			"version": version.name,
+		},
+		"servers": []map[string]any{{"url": base}},
+		"paths":   paths,
+	}
+	if info.Description != "" {
+		doc["info"].(map[string]any)["description"] = info.Description
+	}
+	return doc
+}
+
+// openAPIPath converts an Echo path into an OpenAPI path template
+// and its path parameters
+func openAPIPath(path string) (string, []map[string]any) {
+	params := make([]map[string]any, 0)
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		switch {
+		case strings.HasPrefix(s, ":"):
+			name := s[1:]
+			segments[i] = "{" + name + "}"
+			params = append(params, map[string]any{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		case s == "*":
+			segments[i] = "{wildcard}"
+			params = append(params, map[string]any{
+				"name":     "wildcard",
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
@@ -0,0 +1,100 @@
+package FxEcho
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/UTOL-s/module/fxGorm/query"
+	"github.com/labstack/echo/v4"
+)
+
+// filterParam matches filter[field] and filter[field][op]
+var filterParam = regexp.MustCompile(`^filter\[([^\[\]]+)\](?:\[([a-z]+)\])?$`)
+
+// ParseListQuery parses the list parameters of a request into a repository
+// query:
+//
+//	?page=2&limit=50                  offset pagination
+//	?cursor=                          keyset pagination, from the start
+//	?cursor=<next_cursor>&limit=50    keyset pagination, next page
+//	?sort=-created_at,name            descending with a leading "-"
+//	?filter[status]=active            equality
+//	?filter[age][gte]=18              eq, ne, gt, gte, lt, lte, like, in, null
+//
+// Fields are checked against the whitelist of the repository, which
+// reports unknown ones as query.ErrInvalidQuery, answered with 400.
+func ParseListQuery(c echo.Context) (query.Query, error) {
+	params := c.QueryParams()
+	var q query.Query
+
+	for _, name := range []string{"page", "limit"} {
+		raw := params.Get(name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 1 {
+			return q, NewBadRequestError(name + " must be a positive integer")
+		}
+		if name == "page" {
+			q.Page = value
+		} else {
+			q.Limit = value
+		}
+	}
+
+	if _, ok := params["cursor"]; ok {
+		if q.Page != 0 {
+			return q, NewBadRequestError("page and cursor cannot be combined")
+		}
+		q.Keyset = true
+		q.Cursor = params.Get("cursor")
+	}
+
+	if raw := params.Get("sort"); raw != "" {
+		for _, field := range strings.Split(raw, ",") {
+			field = strings.TrimSpace(field)
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimLeft(field, "+-")
+			if field == "" {
+				return q, NewBadRequestError("invalid sort " + raw)
+			}
+			q.Sort = append(q.Sort, query.Sort{Field: field, Desc: desc})
+		}
+	}
+
+	// Sorted so that filters apply in a stable order
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		if !strings.HasPrefix(name, "filter") {
+			continue
+		}
+		match := filterParam.FindStringSubmatch(name)
+		if match == nil {
+			return q, NewBadRequestError("invalid filter " + name)
+		}
+		op := query.OpEq
+		if match[2] != "" {
+			op = query.FilterOp(match[2])
+		}
+		for _, value := range params[name] {
+			q.Filters = append(q.Filters, query.Filter{Field: match[1], Op: op, Value: value})
+		}
+	}
+	return q, nil
+}
+
+// NewQueryErrorMapper maps query.ErrInvalidQuery to 400 Bad Request. The
+// FxEcho module registers it.
+func NewQueryErrorMapper() ErrorMapperIf {
+	return ErrorMapperFunc(func(err error) *Error {
+		if errors.Is(err, query.ErrInvalidQuery) {
+			return NewError(http.StatusBadRequest, "invalid_query", err.Error()).Wrap(err)
+		}
+		return nil
+	})
+}
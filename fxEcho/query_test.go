@@ -0,0 +1,128 @@
+package FxEcho
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	fxgorm "github.com/UTOL-s/module/fxGorm"
+	"github.com/UTOL-s/module/fxGorm/query"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type listedUser struct {
+	ID     uint   `json:"id"`
+	Name   string `json:"name"`
+	Age    int    `json:"age"`
+	Status string `json:"status"`
+}
+
+func parseQuery(t *testing.T, rawQuery string) (query.Query, error) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/users?"+rawQuery, nil)
+	return ParseListQuery(echo.New().NewContext(req, httptest.NewRecorder()))
+}
+
+func TestParseListQuery(t *testing.T) {
+	q, err := parseQuery(t, "page=2&limit=50&sort=-created_at,%2Bname&filter[status]=active&filter[age][gte]=18&filter[age][lt]=65")
+	require.NoError(t, err)
+	assert.Equal(t, 2, q.Page)
+	assert.Equal(t, 50, q.Limit)
+	assert.False(t, q.Keyset)
+	assert.Equal(t, []query.Sort{{Field: "created_at", Desc: true}, {Field: "name"}}, q.Sort)
+	assert.ElementsMatch(t, []query.Filter{
+		{Field: "status", Op: query.OpEq, Value: "active"},
+		{Field: "age", Op: query.OpGte, Value: "18"},
+		{Field: "age", Op: query.OpLt, Value: "65"},
+	}, q.Filters)
+
+	q, err = parseQuery(t, "cursor=")
+	require.NoError(t, err)
+	assert.True(t, q.Keyset)
+	assert.Empty(t, q.Cursor)
+
+	q, err = parseQuery(t, "cursor=abc&limit=10")
+	require.NoError(t, err)
+	assert.True(t, q.Keyset)
+	assert.Equal(t, "abc", q.Cursor)
+
+	for _, rawQuery := range []string{"page=0", "limit=ten", "page=2&cursor=abc", "sort=-", "filter=x", "filter[a][b][c]=1", "filters[a]=1"} {
+		_, err := parseQuery(t, rawQuery)
+		var appErr *Error
+		if assert.ErrorAs(t, err, &appErr, rawQuery) {
+			assert.Equal(t, http.StatusBadRequest, appErr.Status, rawQuery)
+		}
+	}
+}
+
+func TestParseListQueryWithRepository(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&listedUser{}))
+	for i := 1; i <= 5; i++ {
+		status := "active"
+		if i == 3 {
+			status = "banned"
+		}
+		require.NoError(t, db.Create(&listedUser{Name: fmt.Sprintf("user %d", i), Age: 15 + i*5, Status: status}).Error)
+	}
+
+	repo := fxgorm.NewRepository[listedUser](
+		fxgorm.NewTxManagerWithConfig(db, fxgorm.TxConfig{}),
+		fxgorm.RepositoryConfig{Fields: []string{"name", "age", "status"}},
+	)
+	e := echo.New()
+	e.HTTPErrorHandler = NewErrorHandler(ErrorHandlerParams{Logger: zap.NewNop(), Mappers: []ErrorMapperIf{NewQueryErrorMapper()}}).Handle
+	e.GET("/users", func(c echo.Context) error {
+		q, err := ParseListQuery(c)
+		if err != nil {
+			return err
+		}
+		page, err := repo.List(c.Request().Context(), q)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, page)
+	})
+
+	get := func(rawQuery string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users?"+rawQuery, nil))
+		return rec
+	}
+
+	rec := get("filter[status]=active&filter[age][gte]=25&sort=-age&limit=2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var page fxgorm.Page[listedUser]
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.EqualValues(t, 3, page.Total)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, "user 5", page.Items[0].Name)
+	assert.Equal(t, "user 4", page.Items[1].Name)
+
+	rec = get("cursor=&limit=3&sort=name")
+	require.Equal(t, http.StatusOK, rec.Code)
+	page = fxgorm.Page[listedUser]{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.NotEmpty(t, page.NextCursor)
+	rec = get("sort=name&cursor=" + page.NextCursor)
+	require.Equal(t, http.StatusOK, rec.Code)
+	page = fxgorm.Page[listedUser]{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	assert.Len(t, page.Items, 2)
+	assert.Empty(t, page.NextCursor)
+
+	rec = get("sort=password")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid_query")
+	assert.Contains(t, rec.Body.String(), "unknown field password")
+}
@@ -0,0 +1,323 @@
+package FxEcho
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// RateLimitAlgorithm selects how requests are counted
+type RateLimitAlgorithm string
+
+const (
+	TokenBucket   RateLimitAlgorithm = "token_bucket"
+	SlidingWindow RateLimitAlgorithm = "sliding_window"
+)
+
+// Rate limit response headers
+const (
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderRateLimitReset     = "X-RateLimit-Reset"
+)
+
+// RateLimit describes an allowance of Requests per Window
+type RateLimit struct {
+	Algorithm RateLimitAlgorithm
+	Requests  int
+	Window    time.Duration
+	// Burst is the token bucket capacity, defaulting to Requests
+	Burst int
+}
+
+// Validate reports limits that cannot be enforced
+func (l RateLimit) Validate() error {
+	if l.Requests <= 0 || l.Window <= 0 {
+		return fmt.Errorf("invalid rate limit: %d requests per %s", l.Requests, l.Window)
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("invalid rate limit burst: %d", l.Burst)
+	}
+	switch l.Algorithm {
+	case TokenBucket, SlidingWindow:
+		return nil
+	default:
+		return fmt.Errorf("unsupported rate limit algorithm: %s", l.Algorithm)
+	}
+}
+
+// RateLimitResult is the outcome of a single rate limit check
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitStore records request counts per key. Implementations backed by
+// Redis or the database must apply the check atomically. Limits are
+// validated by the middleware before they reach the store.
+type RateLimitStore interface {
+	Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// RateLimitKeyFunc extracts the client key a request is counted against
+type RateLimitKeyFunc func(c echo.Context) (string, error)
+
+// KeyByIP counts requests per client IP
+func KeyByIP() RateLimitKeyFunc {
+	return func(c echo.Context) (string, error) {
+		return "ip:" + clientIP(c), nil
+	}
+}
+
+// clientIP returns the address of the connection, or the IP reported by
+// proxies when the Echo IPExtractor is configured to trust them. Echo's
+// RealIP alone would trust forwarded headers sent by any client.
+func clientIP(c echo.Context) string {
+	if c.Echo().IPExtractor != nil {
+		return c.RealIP()
+	}
+	address := c.Request().RemoteAddr
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+// KeyByHeader counts requests per value of the given header,
+// falling back to the client IP when the header is missing
+func KeyByHeader(name string) RateLimitKeyFunc {
+	return func(c echo.Context) (string, error) {
+		if v := c.Request().Header.Get(name); v != "" {
+			return "header:" + v, nil
+		}
+		return "ip:" + clientIP(c), nil
+	}
+}
+
+// KeyByContextValue counts requests per value stored on the echo context
+// under key, such as an authenticated user ID
+func KeyByContextValue(key string) RateLimitKeyFunc {
+	return func(c echo.Context) (string, error) {
+		if v := c.Get(key); v != nil {
+			return "user:" + fmt.Sprint(v), nil
+		}
+		return "ip:" + clientIP(c), nil
+	}
+}
+
+// RateLimitConfig configures the rate limit middleware
+type RateLimitConfig struct {
+	Limit   RateLimit
+	Store   RateLimitStore
+	KeyFunc RateLimitKeyFunc
+	Skipper middleware.Skipper
+	// Scope separates counters of different routes or groups sharing a store
+	Scope string
+	// FailOpen lets requests through when the store returns an error
+	FailOpen bool
+}
+
+// RateLimitMiddleware returns a middleware enforcing the configured limit.
+// It panics on an invalid limit, so that misconfigurations fail at startup.
+func RateLimitMiddleware(config RateLimitConfig) echo.MiddlewareFunc {
+	if config.Store == nil {
+		config.Store = NewMemoryRateLimitStore()
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = KeyByIP()
+	}
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.Limit.Algorithm == "" {
+		config.Limit.Algorithm = TokenBucket
+	}
+	if config.Limit.Window == 0 {
+		config.Limit.Window = time.Second
+	}
+	if err := config.Limit.Validate(); err != nil {
+		panic("echo: rate limit middleware: " + err.Error())
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			key, err := config.KeyFunc(c)
+			if err != nil {
+				return err
+			}
+			if config.Scope != "" {
+				key = config.Scope + "|" + key
+			}
+
+			result, err := config.Store.Allow(c.Request().Context(), key, config.Limit)
+			if err != nil {
+				if config.FailOpen {
+					return next(c)
+				}
+				return fmt.Errorf("rate limit store: %w", err)
+			}
+
+			header := c.Response().Header()
+			header.Set(HeaderRateLimitLimit, strconv.Itoa(result.Limit))
+			header.Set(HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+			header.Set(HeaderRateLimitReset, strconv.Itoa(ceilSeconds(result.ResetAfter)))
+
+			if !result.Allowed {
+				header.Set(echo.HeaderRetryAfter, strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				return NewError(http.StatusTooManyRequests, "rate_limited", "rate limit exceeded")
+			}
+			return next(c)
+		}
+	}
+}
+
+// MemoryRateLimitStore is an in-process RateLimitStore
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucketState
+	windows   map[string]*windowState
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucketState struct {
+	tokens  float64
+	updated time.Time
+	expires time.Time
+}
+
+type windowState struct {
+	start    time.Time
+	current  int
+	previous int
+	expires  time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]*bucketState),
+		windows: make(map[string]*windowState),
+		now:     time.Now,
+	}
+}
+
+// Allow implements RateLimitStore
+func (s *MemoryRateLimitStore) Allow(_ context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now, limit.Window)
+
+	switch limit.Algorithm {
+	case SlidingWindow:
+		return s.allowWindow(now, key, limit), nil
+	case TokenBucket, "":
+		return s.allowBucket(now, key, limit), nil
+	default:
+		return RateLimitResult{}, fmt.Errorf("unsupported rate limit algorithm: %s", limit.Algorithm)
+	}
+}
+
+func (s *MemoryRateLimitStore) allowBucket(now time.Time, key string, limit RateLimit) RateLimitResult {
+	capacity := float64(limit.Burst)
+	if capacity <= 0 {
+		capacity = float64(limit.Requests)
+	}
+	rate := float64(limit.Requests) / limit.Window.Seconds()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucketState{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	result := RateLimitResult{Limit: int(capacity)}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	result.Remaining = int(b.tokens)
+	result.ResetAfter = time.Duration((capacity - b.tokens) / rate * float64(time.Second))
+	b.expires = now.Add(result.ResetAfter)
+	return result
+}
+
+func (s *MemoryRateLimitStore) allowWindow(now time.Time, key string, limit RateLimit) RateLimitResult {
+	w, ok := s.windows[key]
+	if !ok {
+		w = &windowState{start: now.Truncate(limit.Window)}
+		s.windows[key] = w
+	}
+
+	current := now.Truncate(limit.Window)
+	if elapsed := current.Sub(w.start); elapsed >= limit.Window {
+		if elapsed == limit.Window {
+			w.previous = w.current
+		} else {
+			w.previous = 0
+		}
+		w.current = 0
+		w.start = current
+	}
+
+	// Weight the previous window by how much of it still overlaps
+	overlap := 1 - float64(now.Sub(w.start))/float64(limit.Window)
+	estimated := float64(w.previous)*overlap + float64(w.current)
+
+	result := RateLimitResult{Limit: limit.Requests}
+	resetAfter := w.start.Add(limit.Window).Sub(now)
+	if estimated+1 <= float64(limit.Requests) {
+		w.current++
+		estimated++
+		result.Allowed = true
+	} else {
+		result.RetryAfter = resetAfter
+	}
+	result.Remaining = max(0, limit.Requests-int(math.Ceil(estimated)))
+	result.ResetAfter = resetAfter
+	w.expires = w.start.Add(2 * limit.Window)
+	return result
+}
+
+// sweep drops expired counters at most once per window
+func (s *MemoryRateLimitStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.lastSweep) < window {
+		return
+	}
+	s.lastSweep = now
+	for k, b := range s.buckets {
+		if now.After(b.expires) {
+			delete(s.buckets, k)
+		}
+	}
+	for k, w := range s.windows {
+		if now.After(w.expires) {
+			delete(s.windows, k)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
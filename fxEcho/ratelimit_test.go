@@ -0,0 +1,158 @@
+package FxEcho
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestMemoryRateLimitStoreTokenBucket(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	limit := RateLimit{Algorithm: TokenBucket, Requests: 2, Window: time.Second}
+
+	for i := 0; i < 2; i++ {
+		result, err := store.Allow(context.Background(), "client", limit)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+	}
+
+	result, err := store.Allow(context.Background(), "client", limit)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	now = now.Add(500 * time.Millisecond)
+	result, err = store.Allow(context.Background(), "client", limit)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	result, err = store.Allow(context.Background(), "other", limit)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
+
+func TestMemoryRateLimitStoreSlidingWindow(t *testing.T) {
+	now := time.Unix(1699999980, 0)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	limit := RateLimit{Algorithm: SlidingWindow, Requests: 4, Window: time.Minute}
+
+	for i := 0; i < 4; i++ {
+		result, _ := store.Allow(context.Background(), "client", limit)
+		assert.True(t, result.Allowed)
+	}
+	result, _ := store.Allow(context.Background(), "client", limit)
+	assert.False(t, result.Allowed)
+
+	// Halfway through the next window half of the previous count still applies
+	now = now.Add(90 * time.Second)
+	result, _ = store.Allow(context.Background(), "client", limit)
+	assert.True(t, result.Allowed)
+	result, _ = store.Allow(context.Background(), "client", limit)
+	assert.True(t, result.Allowed)
+	result, _ = store.Allow(context.Background(), "client", limit)
+	assert.False(t, result.Allowed)
+}
+
+func TestRateLimitRouteBuilder(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = NewErrorHandler(ErrorHandlerParams{Logger: zap.NewNop()}).Handle
+
+	route := GET("/limited", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	}).RateLimit(RateLimitConfig{
+		Limit:   RateLimit{Requests: 1, Window: time.Minute},
+		KeyFunc: KeyByHeader("X-API-Key"),
+	}).Build()
+	e.Add(route.Method(), route.Path(), route.Handle)
+
+	do := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("a")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "0", rec.Header().Get(HeaderRateLimitRemaining))
+
+	rec = do("a")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get(echo.HeaderRetryAfter))
+	assert.Contains(t, rec.Body.String(), "rate_limited")
+
+	rec = do("b")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestRateLimitGroupBuilder(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = NewErrorHandler(ErrorHandlerParams{Logger: zap.NewNop()}).Handle
+	group := NewGroup("/api").
+		RateLimit(RateLimitConfig{Limit: RateLimit{Algorithm: SlidingWindow, Requests: 2, Window: time.Minute}}).
+		AddRoute(GET("/a", func(c echo.Context) error { return c.NoContent(http.StatusOK) }).Build()).
+		AddRoute(GET("/b", func(c echo.Context) error { return c.NoContent(http.StatusOK) }).Build()).
+		Build()
+	group.Register(e.Group(group.Prefix()))
+
+	codes := make([]int, 0, 3)
+	for _, path := range []string{"/api/a", "/api/b", "/api/a"} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		codes = append(codes, rec.Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+}
+
+func TestRateLimitMiddlewareInvalidLimit(t *testing.T) {
+	for _, limit := range []RateLimit{
+		{Requests: 0},
+		{Requests: 10, Window: -time.Second},
+		{Requests: 10, Burst: -1},
+		{Requests: 10, Algorithm: "leaky_bucket"},
+	} {
+		assert.Panics(t, func() { RateLimitMiddleware(RateLimitConfig{Limit: limit}) }, "%+v", limit)
+	}
+	assert.NotPanics(t, func() { RateLimitMiddleware(RateLimitConfig{Limit: RateLimit{Requests: 10}}) })
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = NewErrorHandler(ErrorHandlerParams{Logger: zap.NewNop()}).Handle
+	route := GET("/limited", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}).RateLimit(RateLimitConfig{Limit: RateLimit{Requests: 1, Window: time.Minute}}).Build()
+	e.Add(route.Method(), route.Path(), route.Handle)
+
+	do := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+		req.RemoteAddr = "192.0.2.1:4000"
+		req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		req.Header.Set(echo.HeaderXRealIP, forwardedFor)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, do("10.0.0.1"))
+	// Rotating the header does not reset the limit of the connection
+	assert.Equal(t, http.StatusTooManyRequests, do("10.0.0.2"))
+
+	// Forwarded headers count once the app trusts its proxies
+	_, proxies, _ := net.ParseCIDR("192.0.2.0/24")
+	e.IPExtractor = echo.ExtractIPFromXFFHeader(echo.TrustIPRange(proxies))
+	assert.Equal(t, http.StatusOK, do("10.0.0.3"))
+}
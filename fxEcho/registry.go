@@ -1,7 +1,12 @@
 package FxEcho
 
 import (
+	"maps"
+	"slices"
+	"time"
+
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	"go.uber.org/fx"
 )
 
@@ -9,21 +14,48 @@ import (
 type RouteRegistryIf interface {
 	Method() string
 	Path() string
+	// Handle runs the route middlewares followed by the handler
 	Handle(ctx echo.Context) error
+	Name() string
+	Middlewares() []echo.MiddlewareFunc
+	Metadata() map[string]any
+	// Server names the server the route is mounted on; empty means default
+	Server() string
 }
 
 // GroupRegistryIf defines the interface for route group registration
 type GroupRegistryIf interface {
 	Prefix() string
 	Register(g *echo.Group)
+	// Server names the server the group is mounted on; empty means default
+	Server() string
 }
 
 // MiddlewareRegistryIf defines the interface for middleware registration
 type MiddlewareRegistryIf interface {
 	Priority() int
 	Middleware() echo.MiddlewareFunc
+	// Server names the server the middleware applies to; empty means all
+	Server() string
 }
 
+// RegistryDefaults implements the optional methods of RouteRegistryIf,
+// GroupRegistryIf and MiddlewareRegistryIf. Custom implementations embed
+// it and keep only the methods they had before those were added.
+type RegistryDefaults struct{}
+
+// Name returns no route name
+func (RegistryDefaults) Name() string { return "" }
+
+// Middlewares returns no route middlewares
+func (RegistryDefaults) Middlewares() []echo.MiddlewareFunc { return nil }
+
+// Metadata returns no route metadata
+func (RegistryDefaults) Metadata() map[string]any { return nil }
+
+// Server mounts on the default server, or applies to all servers
+func (RegistryDefaults) Server() string { return "" }
+
 // AsRoute annotates the given constructor to state that
 // it provides a route to the "routes" group.
 func AsRoute(f any) any {
@@ -52,11 +84,55 @@ func AsMiddleware(f any) any {
 	)
 }
 
+// NewMiddleware wraps a middleware with its priority for AsMiddleware.
+// Middlewares with a higher priority run first.
+func NewMiddleware(priority int, m echo.MiddlewareFunc) MiddlewareRegistryIf {
+	return &middlewareRegistry{
+		priority:   priority,
+		middleware: m,
+	}
+}
+
+// NewServerMiddleware wraps a middleware applied to a single named server
+func NewServerMiddleware(server string, priority int, m echo.MiddlewareFunc) MiddlewareRegistryIf {
+	return &middlewareRegistry{
+		server:     server,
+		priority:   priority,
+		middleware: m,
+	}
+}
+
+// middlewareRegistry implements MiddlewareRegistryIf
+type middlewareRegistry struct {
+	server     string
+	priority   int
+	middleware echo.MiddlewareFunc
+}
+
+func (m *middlewareRegistry) Priority() int {
+	return m.priority
+}
+
+func (m *middlewareRegistry) Middleware() echo.MiddlewareFunc {
+	return m.middleware
+}
+
+func (m *middlewareRegistry) Server() string {
+	return m.server
+}
+
 // RouteBuilder provides a fluent interface for building routes
 type RouteBuilder struct {
-	method string
-	path   string
-	handle echo.HandlerFunc
+	method     string
+	path       string
+	name       string
+	server     string
+	handle     echo.HandlerFunc
+	middleware []echo.MiddlewareFunc
+	// cache runs after all other middlewares, so authentication and
+	// authorization happen before a cached response is served
+	cache echo.MiddlewareFunc
+	meta  map[string]any
 }
 
 // NewRoute creates a new route builder
@@ -65,6 +141,7 @@ func NewRoute(method, path string, handle echo.HandlerFunc) *RouteBuilder {
 		method: method,
 		path:   path,
 		handle: handle,
+		meta:   make(map[string]any),
 	}
 }
 
@@ -93,20 +170,116 @@ func PATCH(path string, handle echo.HandlerFunc) *RouteBuilder {
 	return NewRoute("PATCH", path, handle)
 }
 
+// Use adds middleware to the route, run after group and global middlewares
+func (rb *RouteBuilder) Use(middleware ...echo.MiddlewareFunc) *RouteBuilder {
+	rb.middleware = append(rb.middleware, middleware...)
+	return rb
+}
+
+// Name names the route for reverse URL generation with URLFor
+func (rb *RouteBuilder) Name(name string) *RouteBuilder {
+	rb.name = name
+	return rb
+}
+
+// Server mounts the route on the named server configured under
+// servers.<name> instead of the default server
+func (rb *RouteBuilder) Server(name string) *RouteBuilder {
+	rb.server = name
+	return rb
+}
+
+// Meta attaches an arbitrary metadata value to the route
+func (rb *RouteBuilder) Meta(key string, value any) *RouteBuilder {
+	rb.meta[key] = value
+	return rb
+}
+
+// Timeout sets the handler deadline of the route, replacing the server
+// and group defaults
+func (rb *RouteBuilder) Timeout(timeout time.Duration) *RouteBuilder {
+	rb.meta[MetaTimeout] = timeout
+	return rb.Use(contextTimeout(timeout))
+}
+
+// BodyLimit rejects request bodies larger than limit, e.g. "2M" or "512K"
+func (rb *RouteBuilder) BodyLimit(limit string) *RouteBuilder {
+	rb.meta[MetaBodyLimit] = limit
+	return rb.Use(middleware.BodyLimit(limit))
+}
+
+// RateLimit limits requests to this route. Counters are scoped to the
+// route unless config.Scope is set.
+func (rb *RouteBuilder) RateLimit(config RateLimitConfig) *RouteBuilder {
+	if config.Scope == "" {
+		config.Scope = rb.method + " " + rb.path
+	}
+	return rb.Use(RateLimitMiddleware(config))
+}
+
+// Cache caches successful responses of the route and answers
+// conditional requests. Entries are scoped to the route unless
+// config.Scope is set. The cache runs after the other route middlewares
+// whatever the order they are added in.
+func (rb *RouteBuilder) Cache(config CacheConfig) *RouteBuilder {
+	if config.Scope == "" {
+		config.Scope = rb.method + " " + rb.path
+	}
+	rb.cache = CacheMiddleware(config)
+	return rb
+}
+
+// Idempotent replays the stored response when the route is retried with
+// the same Idempotency-Key
+func (rb *RouteBuilder) Idempotent(config IdempotencyConfig) *RouteBuilder {
+	return rb.Use(IdempotencyMiddleware(config))
+}
+
+// RequireScopes restricts the route to principals holding all scopes
+func (rb *RouteBuilder) RequireScopes(scopes ...string) *RouteBuilder {
+	rb.meta[MetaScopes] = scopes
+	return rb.Use(RequireScopes(scopes...))
+}
+
+// RequireRole restricts the route to principals holding any of the roles
+func (rb *RouteBuilder) RequireRole(roles ...string) *RouteBuilder {
+	rb.meta[MetaRoles] = roles
+	return rb.Use(RequireRole(roles...))
+}
+
 // Build returns the route registry interface
 func (rb *RouteBuilder) Build() RouteRegistryIf {
+	meta := maps.Clone(rb.meta)
+	middlewares := slices.Clone(rb.middleware)
+	if rb.cache != nil {
+		middlewares = append(middlewares, rb.cache)
+	}
+	chain := append([]echo.MiddlewareFunc{routeMetadata(meta)}, middlewares...)
+
+	handle := rb.handle
+	for i := len(chain) - 1; i >= 0; i-- {
+		handle = chain[i](handle)
+	}
 	return &routeRegistry{
-		method: rb.method,
-		path:   rb.path,
-		handle: rb.handle,
+		method:     rb.method,
+		path:       rb.path,
+		name:       rb.name,
+		server:     rb.server,
+		handle:     handle,
+		middleware: middlewares,
+		meta:       meta,
 	}
 }
 
 // routeRegistry implements RouteRegistryIf
 type routeRegistry struct {
-	method string
-	path   string
-	handle echo.HandlerFunc
+	method     string
+	path       string
+	name       string
+	server     string
+	handle     echo.HandlerFunc
+	middleware []echo.MiddlewareFunc
+	meta       map[string]any
 }
 
 func (r *routeRegistry) Method() string {
@@ -121,12 +294,33 @@ func (r *routeRegistry) Handle(ctx echo.Context) error {
 	return r.handle(ctx)
 }
 
+func (r *routeRegistry) Name() string {
+	return r.name
+}
+
+func (r *routeRegistry) Middlewares() []echo.MiddlewareFunc {
+	return r.middleware
+}
+
+func (r *routeRegistry) Metadata() map[string]any {
+	return r.meta
+}
+
+func (r *routeRegistry) Server() string {
+	return r.server
+}
+
 // GroupBuilder provides a fluent interface for building route groups
 type GroupBuilder struct {
 	prefix     string
+	server     string
 	routes     []RouteRegistryIf
 	children   []GroupRegistryIf
 	middleware []echo.MiddlewareFunc
+	cache      echo.MiddlewareFunc
+	versioning *VersionStrategy
+	versions   []*VersionBuilder
+	openAPI    *OpenAPIInfo
 }
 
 // NewGroup creates a new group builder
@@ -157,28 +351,122 @@ func (gb *GroupBuilder) Use(middleware ...echo.MiddlewareFunc) *GroupBuilder {
 	return gb
 }
 
+// Server mounts the group on the named server configured under
+// servers.<name> instead of the default server
+func (gb *GroupBuilder) Server(name string) *GroupBuilder {
+	gb.server = name
+	return gb
+}
+
+// RateLimit limits requests to all routes of the group. Counters are
+// shared by the group unless config.Scope is set.
+func (gb *GroupBuilder) RateLimit(config RateLimitConfig) *GroupBuilder {
+	if config.Scope == "" {
+		config.Scope = gb.prefix
+	}
+	return gb.Use(RateLimitMiddleware(config))
+}
+
+// Timeout sets the handler deadline of the group routes, replacing the
+// server default; route timeouts take precedence
+func (gb *GroupBuilder) Timeout(timeout time.Duration) *GroupBuilder {
+	return gb.Use(contextTimeout(timeout))
+}
+
+// Cache caches successful responses of all routes of the group.
+// Entries are keyed by request path within the group scope. The cache
+// runs after the other group middlewares but before route middlewares,
+// so Build panics when a route of the group requires roles or scopes.
+func (gb *GroupBuilder) Cache(config CacheConfig) *GroupBuilder {
+	if config.Scope == "" {
+		config.Scope = gb.prefix
+	}
+	gb.cache = CacheMiddleware(config)
+	return gb
+}
+
+// Idempotent honors Idempotency-Key on the unsafe routes of the group
+func (gb *GroupBuilder) Idempotent(config IdempotencyConfig) *GroupBuilder {
+	return gb.Use(IdempotencyMiddleware(config))
+}
+
+// RequireScopes restricts the group to principals holding all scopes
+func (gb *GroupBuilder) RequireScopes(scopes ...string) *GroupBuilder {
+	return gb.Use(RequireScopes(scopes...))
+}
+
+// RequireRole restricts the group to principals holding any of the roles
+func (gb *GroupBuilder) RequireRole(roles ...string) *GroupBuilder {
+	return gb.Use(RequireRole(roles...))
+}
+
 // Build returns the group registry interface
 func (gb *GroupBuilder) Build() GroupRegistryIf {
+	middlewares := slices.Clone(gb.middleware)
+	if gb.cache != nil {
+		if route := gb.protectedRoute(); route != nil {
+			panic("echo: group " + gb.prefix + " caches responses before route " +
+				route.Method() + " " + route.Path() + " checks roles or scopes; cache the route instead")
+		}
+		middlewares = append(middlewares, gb.cache)
+	}
 	return &groupRegistry{
 		prefix:     gb.prefix,
+		server:     gb.server,
 		routes:     gb.routes,
 		children:   gb.children,
-		middleware: gb.middleware,
+		middleware: middlewares,
+		versioning: gb.versioning,
+		versions:   gb.versions,
+		openAPI:    gb.openAPI,
+	}
+}
+
+// protectedRoute returns a route of the group, its versions or its child
+// groups that requires roles or scopes, if any
+func (gb *GroupBuilder) protectedRoute() RouteRegistryIf {
+	group := &groupRegistry{routes: gb.routes, children: gb.children, versions: gb.versions}
+	for _, route := range group.allRoutes() {
+		meta := route.Metadata()
+		if _, ok := meta[MetaRoles]; ok {
+			return route
+		}
+		if _, ok := meta[MetaScopes]; ok {
+			return route
+		}
 	}
+	return nil
 }
 
 // groupRegistry implements GroupRegistryIf
 type groupRegistry struct {
 	prefix     string
+	server     string
 	routes     []RouteRegistryIf
 	children   []GroupRegistryIf
 	middleware []echo.MiddlewareFunc
+	versioning *VersionStrategy
+	versions   []*VersionBuilder
+	openAPI    *OpenAPIInfo
+	// aliases maps the names of versioned routes sharing an Echo route to
+	// the name Echo knows it by, filled in by Register
+	aliases map[string]string
+}
+
+// routeAliaser is implemented by groups naming routes that Echo cannot
+// keep, see registerVersions
+type routeAliaser interface {
+	routeAliases() map[string]string
 }
 
 func (g *groupRegistry) Prefix() string {
 	return g.prefix
 }
 
+func (g *groupRegistry) Server() string {
+	return g.server
+}
+
 func (g *groupRegistry) Register(group *echo.Group) {
 	// Apply middleware to the group
 	for _, m := range g.middleware {
@@ -187,12 +475,47 @@ func (g *groupRegistry) Register(group *echo.Group) {
 
 	// Register routes in this group
 	for _, route := range g.routes {
-		group.Add(route.Method(), route.Path(), route.Handle)
+		addRoute(group.Add, route)
+	}
+
+	// Register API versions
+	if g.versioning != nil {
+		g.aliases = registerVersions(group, *g.versioning, g.versions)
+		if g.openAPI != nil {
+			registerOpenAPI(group, *g.openAPI, *g.versioning, g.versions)
+		}
 	}
 
 	// Register child groups
 	for _, child := range g.children {
 		childGroup := group.Group(child.Prefix())
 		child.Register(childGroup)
+		if aliaser, ok := child.(routeAliaser); ok {
+			for alias, name := range aliaser.routeAliases() {
+				if g.aliases == nil {
+					g.aliases = make(map[string]string)
+				}
+				g.aliases[alias] = name
+			}
+		}
 	}
 }
+
+// allRoutes returns the routes of the group, its versions and its child
+// groups
+func (g *groupRegistry) allRoutes() []RouteRegistryIf {
+	routes := slices.Clone(g.routes)
+	for _, v := range g.versions {
+		routes = append(routes, v.routes...)
+	}
+	for _, child := range g.children {
+		if c, ok := child.(*groupRegistry); ok {
+			routes = append(routes, c.allRoutes()...)
+		}
+	}
+	return routes
+}
+
+func (g *groupRegistry) routeAliases() map[string]string {
+	return g.aliases
+}
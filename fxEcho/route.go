@@ -0,0 +1,63 @@
+package FxEcho
+
+import (
+	"fmt"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Metadata keys set by RouteBuilder options
+const (
+	MetaTimeout   = "fxecho.timeout"
+	MetaBodyLimit = "fxecho.body_limit"
+	MetaScopes    = "fxecho.scopes"
+	MetaRoles     = "fxecho.roles"
+)
+
+// routeMetaContextKey is the echo context key holding the route metadata
+const routeMetaContextKey = "fxecho.route_meta"
+
+// routeAdder matches both (*echo.Echo).Add and (*echo.Group).Add
+type routeAdder func(method, path string, handler echo.HandlerFunc, middleware ...echo.MiddlewareFunc) *echo.Route
+
+// addRoute registers a route and applies its name
+func addRoute(add routeAdder, route RouteRegistryIf) *echo.Route {
+	r := add(route.Method(), route.Path(), route.Handle)
+	if name := route.Name(); name != "" {
+		r.Name = name
+	}
+	return r
+}
+
+// RouteMeta returns the metadata value of the matched route
+func RouteMeta(c echo.Context, key string) (any, bool) {
+	meta, ok := c.Get(routeMetaContextKey).(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	v, ok := meta[key]
+	return v, ok
+}
+
+// URLFor builds the URL of the route registered under name, substituting
+// path parameters in order. Versions sharing a route under header or
+// Accept versioning are known to Echo by the first name only; use
+// RouteTable.URLFor to resolve the others.
+func URLFor(e *echo.Echo, name string, params ...any) (string, error) {
+	for _, r := range e.Routes() {
+		if r.Name == name {
+			return e.Reverse(r.Name, params...), nil
+		}
+	}
+	return "", fmt.Errorf("route %q not found", name)
+}
+
+// routeMetadata exposes the route metadata to handlers and middlewares
+func routeMetadata(meta map[string]any) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(routeMetaContextKey, meta)
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package FxEcho
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func headerMiddleware(value string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Add("X-Trace", value)
+			return next(c)
+		}
+	}
+}
+
+func TestRouteBuilderOptions(t *testing.T) {
+	route := GET("/reports/:id", func(c echo.Context) error {
+		_, hasDeadline := c.Request().Context().Deadline()
+		owner, _ := RouteMeta(c, "owner")
+		return c.JSON(http.StatusOK, map[string]any{"deadline": hasDeadline, "owner": owner})
+	}).
+		Name("report").
+		Use(headerMiddleware("first"), headerMiddleware("second")).
+		Timeout(time.Second).
+		Meta("owner", "reporting").
+		Build()
+
+	assert.Equal(t, "report", route.Name())
+	assert.Len(t, route.Middlewares(), 3)
+	assert.Equal(t, "reporting", route.Metadata()["owner"])
+	assert.Equal(t, time.Second, route.Metadata()[MetaTimeout])
+
+	e := echo.New()
+	addRoute(e.Add, route)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reports/7", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"first", "second"}, rec.Header().Values("X-Trace"))
+	assert.JSONEq(t, `{"deadline":true,"owner":"reporting"}`, rec.Body.String())
+}
+
+func TestRouteBuilderBodyLimit(t *testing.T) {
+	e := echo.New()
+	addRoute(e.Add, POST("/upload", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}).BodyLimit("1K").Build())
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("x", 2048))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("small")))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestURLFor(t *testing.T) {
+	var e *echo.Echo
+
+	app := fxtest.New(t,
+		fx.Provide(
+			newTestConfig,
+			func() *zap.Logger { return zap.NewNop() },
+			AsRoute(func() RouteRegistryIf {
+				return GET("/hello", exampleHandler).Name("hello").Build()
+			}),
+			AsGroup(func() GroupRegistryIf {
+				return NewGroup("/api").
+					AddGroup(NewGroup("/v1").
+						AddRoute(GET("/users/:id", exampleHandler).Name("users.show").Build()).
+						Build()).
+					Build()
+			}),
+		),
+		FxEcho,
+		fx.Populate(&e),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	url, err := URLFor(e, "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "/hello", url)
+
+	url, err = URLFor(e, "users.show", 42)
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/v1/users/42", url)
+
+	_, err = URLFor(e, "missing")
+	assert.Error(t, err)
+}
+
+// legacyRoute implements only the methods RouteRegistryIf had originally
+type legacyRoute struct {
+	RegistryDefaults
+}
+
+func (legacyRoute) Method() string { return http.MethodGet }
+func (legacyRoute) Path() string   { return "/legacy" }
+func (legacyRoute) Handle(c echo.Context) error {
+	return c.String(http.StatusOK, "legacy")
+}
+
+func TestRegistryDefaults(t *testing.T) {
+	var e *echo.Echo
+	app := fxtest.New(t,
+		fx.Provide(
+			newTestConfig,
+			func() *zap.Logger { return zap.NewNop() },
+			AsRoute(func() RouteRegistryIf { return legacyRoute{} }),
+		),
+		FxEcho,
+		fx.Populate(&e),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/legacy", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "legacy", rec.Body.String())
+}
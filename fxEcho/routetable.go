@@ -0,0 +1,181 @@
+package FxEcho
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Route conflict policies for server.routes.on_conflict
+const (
+	RouteConflictError = "error"
+	RouteConflictWarn  = "warn"
+)
+
+// RouteInfo describes a route mounted on the Echo server
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Name   string `json:"name,omitempty"`
+}
+
+func (r RouteInfo) String() string {
+	return r.Method + " " + r.Path
+}
+
+// RouteConflict records a method and path registered more than once.
+// The last registration wins in the Echo router.
+type RouteConflict struct {
+	Shadowed RouteInfo `json:"shadowed"`
+	Active   RouteInfo `json:"active"`
+}
+
+func (c RouteConflict) String() string {
+	return fmt.Sprintf("%s is shadowed by %s", c.Shadowed, c.Active)
+}
+
+// RouteTable records the routes mounted by NewEcho
+type RouteTable struct {
+	mu        sync.RWMutex
+	routes    map[string]RouteInfo
+	handlers  map[string]string
+	conflicts []RouteConflict
+	// aliases maps additional route names to the name known to Echo
+	aliases map[string]string
+	echo    *echo.Echo
+}
+
+// NewRouteTable creates an empty route table
+func NewRouteTable() *RouteTable {
+	return &RouteTable{
+		routes:   make(map[string]RouteInfo),
+		handlers: make(map[string]string),
+		aliases:  make(map[string]string),
+	}
+}
+
+// URLFor builds the URL of the named route like the package URLFor, also
+// resolving the names of versions that share a route
+func (t *RouteTable) URLFor(name string, params ...any) (string, error) {
+	t.mu.RLock()
+	e := t.echo
+	if alias, ok := t.aliases[name]; ok {
+		name = alias
+	}
+	t.mu.RUnlock()
+	if e == nil {
+		return "", fmt.Errorf("route %q not found", name)
+	}
+	return URLFor(e, name, params...)
+}
+
+// mount attaches the table to the Echo server whose routes it records
+func (t *RouteTable) mount(e *echo.Echo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.echo = e
+}
+
+// addAliases records the route names of a group that Echo cannot keep
+func (t *RouteTable) addAliases(group GroupRegistryIf) {
+	aliaser, ok := group.(routeAliaser)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for alias, name := range aliaser.routeAliases() {
+		t.aliases[alias] = name
+	}
+}
+
+// Routes returns the mounted routes sorted by path and method
+func (t *RouteTable) Routes() []RouteInfo {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	routes := make([]RouteInfo, 0, len(t.routes))
+	for _, r := range t.routes {
+		routes = append(routes, r)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// Conflicts returns the duplicate registrations detected so far
+func (t *RouteTable) Conflicts() []RouteConflict {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]RouteConflict(nil), t.conflicts...)
+}
+
+// Lookup returns the route registered for method and path
+func (t *RouteTable) Lookup(method, path string) (RouteInfo, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	r, ok := t.routes[routeKey(method, path)]
+	return r, ok
+}
+
+// record adds a route, tracking conflicts with earlier registrations
+func (t *RouteTable) record(route echo.Route) {
+	// Group middlewares register catch-all not-found routes per group
+	if route.Method == echo.RouteNotFound {
+		return
+	}
+
+	info := RouteInfo{Method: route.Method, Path: route.Path}
+	key := routeKey(route.Method, route.Path)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if existing, ok := t.routes[key]; ok {
+		t.conflicts = append(t.conflicts, RouteConflict{Shadowed: existing, Active: info})
+	}
+	t.routes[key] = info
+	// Echo names routes after their handler until a name is assigned
+	t.handlers[key] = route.Name
+}
+
+// syncNames copies names assigned after registration from the Echo router
+func (t *RouteTable) syncNames(routes []*echo.Route) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, route := range routes {
+		key := routeKey(route.Method, route.Path)
+		info, ok := t.routes[key]
+		if !ok || route.Name == t.handlers[key] {
+			continue
+		}
+		info.Name = route.Name
+		t.routes[key] = info
+	}
+}
+
+// Handler serves the route table as JSON
+func (t *RouteTable) Handler(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]any{
+		"routes":    t.Routes(),
+		"conflicts": t.Conflicts(),
+	})
+}
+
+// routeKey normalizes parameter names so /users/:id and /users/:uid collide
+func routeKey(method, path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = ":"
+		}
+	}
+	return method + " " + strings.Join(segments, "/")
+}
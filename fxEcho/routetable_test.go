@@ -0,0 +1,137 @@
+package FxEcho
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func newDuplicateRoutes() fx.Option {
+	return fx.Provide(
+		AsRoute(func() RouteRegistryIf {
+			return GET("/users/:id", exampleHandler).Build()
+		}),
+		AsGroup(func() GroupRegistryIf {
+			return NewGroup("/users").
+				AddRoute(GET("/:uid", apiHandler).Build()).
+				Build()
+		}),
+	)
+}
+
+func TestRouteTableDetectsConflicts(t *testing.T) {
+	app := fx.New(
+		fx.NopLogger,
+		fx.Provide(newTestConfig, newTestLogger),
+		newDuplicateRoutes(),
+		FxEcho,
+	)
+
+	assert.Error(t, app.Err())
+	assert.Contains(t, app.Err().Error(), "GET /users/:uid is shadowed by GET /users/:id")
+}
+
+func TestRouteTableWarnsOnConflicts(t *testing.T) {
+	viper.Set("server.routes.on_conflict", RouteConflictWarn)
+	defer viper.Reset()
+
+	var table *RouteTable
+	app := fxtest.New(t,
+		fx.Provide(newTestConfig, newTestLogger),
+		newDuplicateRoutes(),
+		FxEcho,
+		fx.Populate(&table),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	assert.Len(t, table.Conflicts(), 1)
+}
+
+func TestRouteTableEndpoint(t *testing.T) {
+	viper.Set("server.routes.path", "/admin/routes")
+	defer viper.Reset()
+
+	var e *echo.Echo
+	var table *RouteTable
+	app := fxtest.New(t,
+		fx.Provide(
+			newTestConfig,
+			func() *zap.Logger { return zap.NewNop() },
+			AsRoute(func() RouteRegistryIf {
+				return GET("/health", func(c echo.Context) error {
+					return c.String(http.StatusOK, "custom")
+				}).Name("health").Build()
+			}),
+			AsGroup(func() GroupRegistryIf {
+				return NewGroup("/api").
+					Use(customMiddleware()).
+					AddRoute(GET("/users", exampleHandler).Build()).
+					Build()
+			}),
+		),
+		FxEcho,
+		fx.Populate(&e, &table),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	// The application health route replaces the built-in one
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, "custom", rec.Body.String())
+	assert.Empty(t, table.Conflicts())
+
+	health, ok := table.Lookup(http.MethodGet, "/health")
+	assert.True(t, ok)
+	assert.Equal(t, "health", health.Name)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/routes", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Routes []RouteInfo `json:"routes"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, []RouteInfo{
+		{Method: http.MethodGet, Path: "/admin/routes"},
+		{Method: http.MethodGet, Path: "/api/users"},
+		{Method: http.MethodGet, Path: "/health", Name: "health"},
+		{Method: http.MethodGet, Path: "/ready"},
+	}, body.Routes)
+}
+
+func TestRouteTableEndpointRestricted(t *testing.T) {
+	viper.Set("server.routes.path", "/internal/routes")
+	viper.Set("server.routes.allow", []string{"10.0.0.0/8"})
+	defer viper.Reset()
+
+	var e *echo.Echo
+	app := fxtest.New(t,
+		fx.Provide(newTestConfig, func() *zap.Logger { return zap.NewNop() }),
+		FxEcho,
+		fx.Populate(&e),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	get := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/internal/routes", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(echo.HeaderXForwardedFor, "10.1.1.1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusForbidden, get("192.0.2.1:4000"))
+	assert.Equal(t, http.StatusOK, get("10.1.2.3:4000"))
+}
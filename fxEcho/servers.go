@@ -0,0 +1,176 @@
+package FxEcho
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// DefaultServer names the server configured under server.*
+const DefaultServer = "default"
+
+// Server is an Echo server managed by FxEcho
+type Server struct {
+	Name   string
+	Echo   *echo.Echo
+	Config *ServerConfig
+	Routes *RouteTable
+	Drain  *Drain
+
+	logger *zap.Logger
+}
+
+// Servers holds the default server and the named servers configured
+// under servers.<name>, e.g. an internal admin server
+type Servers struct {
+	servers  map[string]*Server
+	names    []string
+	timeouts *prometheus.CounterVec
+}
+
+// Get returns the server with the given name
+func (s *Servers) Get(name string) (*Server, bool) {
+	server, ok := s.servers[name]
+	return server, ok
+}
+
+// Names returns the server names, the default server first
+func (s *Servers) Names() []string {
+	return append([]string(nil), s.names...)
+}
+
+// NewServers creates the default server and the named servers. Routes,
+// groups and middlewares are mounted on the server they target; each
+// server starts with its own lifecycle hook and all of them drain together
+// on stop.
+func NewServers(p EchoParams) (*Servers, error) {
+	defaultConfig, err := NewServerConfig(p.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create server config: %w", err)
+	}
+
+	configs := map[string]*ServerConfig{DefaultServer: defaultConfig}
+	names := []string{DefaultServer}
+	named, _ := p.Config.Accessor.Get("servers").(map[string]interface{})
+	namedServers := make([]string, 0, len(named))
+	for name := range named {
+		if p.Config.Accessor.IsSet("servers." + name) {
+			namedServers = append(namedServers, name)
+		}
+	}
+	sort.Strings(namedServers)
+	for _, name := range namedServers {
+		if name == DefaultServer {
+			return nil, fmt.Errorf("servers.%s is reserved, configure the default server under server", DefaultServer)
+		}
+		serverConfig, err := newServerConfig(p.Config.Accessor, "servers."+name, defaultConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create server config: %w", err)
+		}
+		configs[name] = serverConfig
+		names = append(names, name)
+	}
+
+	if err := checkTargets(p, configs); err != nil {
+		return nil, err
+	}
+
+	servers := &Servers{servers: make(map[string]*Server, len(names)), names: names, timeouts: newRequestTimeouts()}
+	for _, name := range names {
+		table := p.RouteTable
+		if name != DefaultServer {
+			table = NewRouteTable()
+		}
+		server, err := newServer(p, name, configs[name], table, servers)
+		if err != nil {
+			return nil, err
+		}
+		servers.servers[name] = server
+	}
+
+	registerer := p.Registerer
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	if err := registerer.Register(servers.timeouts); err != nil {
+		return nil, fmt.Errorf("failed to register request timeout metrics: %w", err)
+	}
+	p.Lifecycle.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			registerer.Unregister(servers.timeouts)
+			return nil
+		},
+	})
+	p.Lifecycle.Append(fx.Hook{OnStop: servers.stop})
+	return servers, nil
+}
+
+// stop drains every server at once: all of them fail readiness, the
+// longest drain delay passes once, then they shut down concurrently
+func (s *Servers) stop(ctx context.Context) error {
+	var delay time.Duration
+	for _, name := range s.names {
+		server := s.servers[name]
+		// Fail readiness first so load balancers stop routing traffic
+		server.logger.Info("draining Echo server",
+			zap.Duration("drain_delay", server.Config.Shutdown.DrainDelay),
+			zap.Int64("in_flight", server.Drain.InFlight()),
+			zap.Int64("long_lived", server.Drain.LongLived()),
+		)
+		server.Drain.Start()
+		delay = max(delay, server.Config.Shutdown.DrainDelay)
+	}
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+	}
+
+	errs := make([]error, len(s.names))
+	var wg sync.WaitGroup
+	for i, name := range s.names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.servers[name].shutdown(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// targetServer resolves an empty server name to the default server
+func targetServer(name string) string {
+	if name == "" {
+		return DefaultServer
+	}
+	return name
+}
+
+// checkTargets rejects routes, groups and middlewares targeting a server
+// that is not configured
+func checkTargets(p EchoParams, configs map[string]*ServerConfig) error {
+	for _, route := range p.Routes {
+		if _, ok := configs[targetServer(route.Server())]; !ok {
+			return fmt.Errorf("route %s %s targets unknown server %q", route.Method(), route.Path(), route.Server())
+		}
+	}
+	for _, group := range p.Groups {
+		if _, ok := configs[targetServer(group.Server())]; !ok {
+			return fmt.Errorf("group %s targets unknown server %q", group.Prefix(), group.Server())
+		}
+	}
+	for _, m := range p.Registered {
+		if _, ok := configs[targetServer(m.Server())]; !ok {
+			return fmt.Errorf("middleware targets unknown server %q", m.Server())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package FxEcho
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+func serve(e *echo.Echo, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestNamedServers(t *testing.T) {
+	viper.Set("server.listen", false)
+	viper.Set("servers.admin.port", "9090")
+	viper.Set("servers.admin.routes.path", "/routes")
+	defer viper.Reset()
+
+	adminOnly := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Set("X-Admin", "true")
+			return next(c)
+		}
+	}
+
+	var servers *Servers
+	var e *echo.Echo
+	app := fxtest.New(t,
+		fx.Provide(
+			newTestConfig,
+			newTestLogger,
+			AsRoute(func() RouteRegistryIf {
+				return GET("/users", exampleHandler).Build()
+			}),
+			AsRoute(func() RouteRegistryIf {
+				return GET("/metrics", exampleHandler).Server("admin").Build()
+			}),
+			AsGroup(func() GroupRegistryIf {
+				return NewGroup("/debug").Server("admin").
+					AddRoute(GET("/vars", apiHandler).Build()).
+					Build()
+			}),
+			AsMiddleware(func() MiddlewareRegistryIf {
+				return NewServerMiddleware("admin", 0, adminOnly)
+			}),
+		),
+		FxEcho,
+		fx.Populate(&servers, &e),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	assert.Equal(t, []string{DefaultServer, "admin"}, servers.Names())
+	admin, ok := servers.Get("admin")
+	assert.True(t, ok)
+	assert.Equal(t, "0.0.0.0:9090", admin.Echo.Server.Addr)
+	assert.False(t, admin.Config.Listen)
+
+	assert.Equal(t, http.StatusOK, serve(e, "/users").Code)
+	assert.Equal(t, http.StatusNotFound, serve(e, "/metrics").Code)
+	assert.Empty(t, serve(e, "/health").Header().Get("X-Admin"))
+
+	assert.Equal(t, http.StatusOK, serve(admin.Echo, "/metrics").Code)
+	assert.Equal(t, http.StatusOK, serve(admin.Echo, "/debug/vars").Code)
+	assert.Equal(t, http.StatusNotFound, serve(admin.Echo, "/users").Code)
+	assert.Equal(t, "true", serve(admin.Echo, "/health").Header().Get("X-Admin"))
+
+	_, ok = admin.Routes.Lookup(http.MethodGet, "/metrics")
+	assert.True(t, ok)
+	_, ok = admin.Routes.Lookup(http.MethodGet, "/users")
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusOK, serve(admin.Echo, "/routes").Code)
+}
+
+func TestNamedServersRejectUnknownTarget(t *testing.T) {
+	app := fx.New(
+		fx.NopLogger,
+		fx.Provide(
+			newTestConfig,
+			newTestLogger,
+			AsRoute(func() RouteRegistryIf {
+				return GET("/metrics", exampleHandler).Server("internal").Build()
+			}),
+		),
+		FxEcho,
+	)
+
+	assert.Error(t, app.Err())
+	assert.Contains(t, app.Err().Error(), `route GET /metrics targets unknown server "internal"`)
+}
+
+func TestNamedServersRequirePort(t *testing.T) {
+	viper.Set("servers.admin.host", "127.0.0.1")
+	defer viper.Reset()
+
+	app := fx.New(fx.NopLogger, fx.Provide(newTestConfig, newTestLogger), FxEcho)
+
+	assert.Error(t, app.Err())
+	assert.Contains(t, app.Err().Error(), "servers.admin.port is required")
+}
@@ -0,0 +1,228 @@
+package FxEcho
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Cache-Control values of static files
+const (
+	cacheImmutable  = "public, max-age=31536000, immutable"
+	cacheRevalidate = "no-cache"
+)
+
+// defaultHashedName matches fingerprinted names such as app.3f2a9c1b.js
+var defaultHashedName = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[^./]+$`)
+
+// precompressed lists the encodings served from sibling files, preferred first
+var precompressed = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// StaticConfig configures static file serving
+type StaticConfig struct {
+	// Index is served for directories, "index.html" by default
+	Index string
+	// SPA serves the index for unknown paths without a file extension so
+	// client-side routes resolve
+	SPA bool
+	// MaxAge lets clients cache files that are not fingerprinted; zero
+	// makes them revalidate with the ETag on every request
+	MaxAge time.Duration
+	// HashedName matches fingerprinted file names, which are cached for a
+	// year as immutable. Names with 8 or more hex digits before the
+	// extension match by default.
+	HashedName *regexp.Regexp
+}
+
+// Static returns a group serving files from fsys under prefix, e.g. an
+// embed.FS or os.DirFS. Use fs.Sub to serve a subdirectory of an embed.FS.
+// Files with a .br or .gz sibling are served compressed to clients that
+// accept it, and every response carries an ETag derived from its content.
+func Static(prefix string, fsys fs.FS, config StaticConfig) *GroupBuilder {
+	if config.Index == "" {
+		config.Index = "index.html"
+	}
+	if config.HashedName == nil {
+		config.HashedName = defaultHashedName
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	s := &staticFiles{fsys: fsys, config: config}
+	group := NewGroup(prefix).
+		AddRoute(GET("/*", s.serve).Build()).
+		AddRoute(NewRoute(http.MethodHead, "/*", s.serve).Build())
+	if prefix != "" {
+		// Relative asset URLs of the index resolve below the trailing slash
+		group.AddRoute(GET("", func(c echo.Context) error {
+			return c.Redirect(http.StatusMovedPermanently, prefix+"/")
+		}).Build())
+	}
+	return group
+}
+
+// staticFiles serves a file system, remembering the ETag of each file
+type staticFiles struct {
+	fsys   fs.FS
+	config StaticConfig
+	etags  sync.Map
+}
+
+func (s *staticFiles) serve(c echo.Context) error {
+	name, err := url.PathUnescape(c.Param("*"))
+	if err != nil {
+		return NewBadRequestError("invalid path")
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+
+	resolved, err := s.resolve(name)
+	fallback := false
+	if errors.Is(err, fs.ErrNotExist) && s.config.SPA && path.Ext(name) == "" {
+		resolved, err = s.resolve(s.config.Index)
+		fallback = true
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewNotFoundError("file not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open static file %s: %w", name, err)
+	}
+
+	cacheControl := cacheRevalidate
+	switch {
+	case fallback || resolved == s.config.Index || strings.HasSuffix(resolved, "/"+s.config.Index):
+	case s.config.HashedName.MatchString(resolved):
+		cacheControl = cacheImmutable
+	case s.config.MaxAge > 0:
+		cacheControl = fmt.Sprintf("public, max-age=%d", ceilSeconds(s.config.MaxAge))
+	}
+	return s.serveFile(c, resolved, cacheControl)
+}
+
+// resolve maps a cleaned path to a file, using the index for directories
+func (s *staticFiles) resolve(name string) (string, error) {
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return name, nil
+	}
+	index := path.Join(name, s.config.Index)
+	info, err = fs.Stat(s.fsys, index)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fs.ErrNotExist
+	}
+	return index, nil
+}
+
+// serveFile writes a file or its precompressed variant, answering range
+// and conditional requests
+func (s *staticFiles) serveFile(c echo.Context, name, cacheControl string) error {
+	header := c.Response().Header()
+	header.Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+	header.Set(echo.HeaderCacheControl, cacheControl)
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		header.Set(echo.HeaderContentType, contentType)
+	}
+
+	served := name
+	accepted := acceptedEncodings(c.Request().Header.Get(echo.HeaderAcceptEncoding))
+	for _, variant := range precompressed {
+		if !accepted[variant.encoding] {
+			continue
+		}
+		if info, err := fs.Stat(s.fsys, name+variant.extension); err == nil && !info.IsDir() {
+			served = name + variant.extension
+			header.Set(echo.HeaderContentEncoding, variant.encoding)
+			break
+		}
+	}
+
+	file, err := s.fsys.Open(served)
+	if err != nil {
+		return fmt.Errorf("failed to open static file %s: %w", served, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat static file %s: %w", served, err)
+	}
+
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		body, err := io.ReadAll(file)
+		if err != nil {
+			return fmt.Errorf("failed to read static file %s: %w", served, err)
+		}
+		content = bytes.NewReader(body)
+	}
+	etag, err := s.etag(served, info, content)
+	if err != nil {
+		return err
+	}
+	header.Set(HeaderETag, etag)
+
+	http.ServeContent(c.Response(), c.Request(), name, info.ModTime(), content)
+	return nil
+}
+
+// etag returns the content hash of a file, computed once per version
+func (s *staticFiles) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	key := name + "|" + strconv.FormatInt(info.Size(), 10) + "|" + info.ModTime().String()
+	if etag, ok := s.etags.Load(key); ok {
+		return etag.(string), nil
+	}
+
+	body, err := io.ReadAll(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to read static file %s: %w", name, err)
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to rewind static file %s: %w", name, err)
+	}
+	etag := etagFor(body, false)
+	s.etags.Store(key, etag)
+	return etag, nil
+}
+
+// acceptedEncodings parses Accept-Encoding, ignoring encodings with q=0
+func acceptedEncodings(header string) map[string]bool {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		encoding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		if encoding != "" {
+			accepted[strings.ToLower(encoding)] = true
+		}
+	}
+	return accepted
+}
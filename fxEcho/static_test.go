@@ -0,0 +1,107 @@
+package FxEcho
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func newStaticEcho(config StaticConfig) *echo.Echo {
+	files := fstest.MapFS{
+		"index.html":           {Data: []byte("<html>app</html>")},
+		"app.3f2a9c1b.js":      {Data: []byte("console.log('app')")},
+		"app.3f2a9c1b.js.br":   {Data: []byte("brotli")},
+		"app.3f2a9c1b.js.gz":   {Data: []byte("gzip")},
+		"robots.txt":           {Data: []byte("User-agent: *")},
+		"docs/index.html":      {Data: []byte("<html>docs</html>")},
+		"images/logo.svg":      {Data: []byte("<svg/>")},
+		"images/empty/.keep":   {Data: []byte{}},
+		"images/empty/nothing": {Data: []byte{}},
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = NewErrorHandler(ErrorHandlerParams{Logger: zap.NewNop()}).Handle
+	group := Static("/admin", files, config).Build()
+	group.Register(e.Group(group.Prefix()))
+	return e
+}
+
+func TestStatic(t *testing.T) {
+	e := newStaticEcho(StaticConfig{MaxAge: time.Hour})
+
+	rec := get(e, "/admin/")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<html>app</html>", rec.Body.String())
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, "no-cache", rec.Header().Get(echo.HeaderCacheControl))
+
+	rec = get(e, "/admin")
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "/admin/", rec.Header().Get(echo.HeaderLocation))
+
+	assert.Equal(t, "<html>docs</html>", get(e, "/admin/docs/").Body.String())
+	assert.Equal(t, "public, max-age=3600", get(e, "/admin/robots.txt").Header().Get(echo.HeaderCacheControl))
+	assert.Equal(t, http.StatusNotFound, get(e, "/admin/missing").Code)
+	assert.Equal(t, http.StatusNotFound, get(e, "/admin/images/empty/").Code)
+	assert.Equal(t, http.StatusNotFound, get(e, "/admin/../secret").Code)
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	e := newStaticEcho(StaticConfig{})
+
+	rec := get(e, "/admin/app.3f2a9c1b.js", echo.HeaderAcceptEncoding, "gzip, br")
+	assert.Equal(t, "brotli", rec.Body.String())
+	assert.Equal(t, "br", rec.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, "text/javascript; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, echo.HeaderAcceptEncoding, rec.Header().Get(echo.HeaderVary))
+	assert.Equal(t, "public, max-age=31536000, immutable", rec.Header().Get(echo.HeaderCacheControl))
+
+	rec = get(e, "/admin/app.3f2a9c1b.js", echo.HeaderAcceptEncoding, "gzip, br;q=0")
+	assert.Equal(t, "gzip", rec.Body.String())
+	assert.Equal(t, "gzip", rec.Header().Get(echo.HeaderContentEncoding))
+
+	rec = get(e, "/admin/app.3f2a9c1b.js")
+	assert.Equal(t, "console.log('app')", rec.Body.String())
+	assert.Empty(t, rec.Header().Get(echo.HeaderContentEncoding))
+}
+
+func TestStaticConditional(t *testing.T) {
+	e := newStaticEcho(StaticConfig{})
+
+	rec := get(e, "/admin/robots.txt")
+	etag := rec.Header().Get(HeaderETag)
+	assert.NotEmpty(t, etag)
+
+	rec = get(e, "/admin/robots.txt", HeaderIfNoneMatch, etag)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	rec = get(e, "/admin/robots.txt", "Range", "bytes=0-9")
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "User-agent", rec.Body.String())
+
+	req := httptest.NewRequest(http.MethodHead, "/admin/robots.txt", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, "13", rec.Header().Get(echo.HeaderContentLength))
+}
+
+func TestStaticSPA(t *testing.T) {
+	e := newStaticEcho(StaticConfig{SPA: true})
+
+	rec := get(e, "/admin/users/42")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<html>app</html>", rec.Body.String())
+	assert.Equal(t, "no-cache", rec.Header().Get(echo.HeaderCacheControl))
+
+	// Missing assets are not answered with the index
+	assert.Equal(t, http.StatusNotFound, get(e, "/admin/missing.js").Code)
+}
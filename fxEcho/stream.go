@@ -0,0 +1,618 @@
+package FxEcho
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	fxConfig "github.com/UTOL-s/module/fxConfig"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/fx"
+)
+
+// Route metadata key holding the stream type of WS and SSE routes
+const MetaStream = "fxecho.stream"
+
+// Stream types stored under MetaStream
+const (
+	StreamWebSocket = "websocket"
+	StreamSSE       = "sse"
+)
+
+var (
+	// ErrConnClosed is returned when using a closed stream connection
+	ErrConnClosed = errors.New("stream connection closed")
+	// ErrSlowConsumer is returned when a connection's send buffer is full
+	ErrSlowConsumer = errors.New("stream connection send buffer full")
+	// errGoingAway closes connections when the server drains
+	errGoingAway = errors.New("server shutting down")
+)
+
+// HubConfig holds stream connection limits and keepalive settings
+type HubConfig struct {
+	// SendBuffer is the number of queued outbound messages per connection
+	SendBuffer int `mapstructure:"send_buffer"`
+	// DropWhenFull drops messages for slow consumers instead of closing them
+	DropWhenFull bool `mapstructure:"drop_when_full"`
+	// PingInterval is how often WebSocket pings and SSE comments are sent
+	PingInterval time.Duration `mapstructure:"ping_interval"`
+	// PongTimeout closes WebSocket connections without a pong in time
+	PongTimeout time.Duration `mapstructure:"pong_timeout"`
+	// WriteTimeout bounds a single write to a connection
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	// MaxMessageSize limits inbound WebSocket messages in bytes
+	MaxMessageSize int64 `mapstructure:"max_message_size"`
+	// CheckOrigin validates WebSocket origins; same origin only when nil
+	CheckOrigin func(r *http.Request) bool `mapstructure:"-"`
+}
+
+// SetDefaults fills unset limits
+func (c *HubConfig) SetDefaults() {
+	if c.SendBuffer <= 0 {
+		c.SendBuffer = 64
+	}
+	if c.PingInterval <= 0 {
+		c.PingInterval = 30 * time.Second
+	}
+	if c.PongTimeout <= 0 {
+		c.PongTimeout = 2 * c.PingInterval
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = 10 * time.Second
+	}
+	if c.MaxMessageSize <= 0 {
+		c.MaxMessageSize = 64 * 1024
+	}
+}
+
+// Message is a message sent to or received from a stream connection
+type Message struct {
+	// Event names the SSE event; ignored for WebSocket
+	Event string
+	// ID sets the SSE event id; ignored for WebSocket
+	ID   string
+	Data []byte
+}
+
+// TextMessage creates a message from a string
+func TextMessage(data string) Message {
+	return Message{Data: []byte(data)}
+}
+
+// JSONMessage creates a message with v encoded as JSON
+func JSONMessage(event string, v any) (Message, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to encode message: %w", err)
+	}
+	return Message{Event: event, Data: data}, nil
+}
+
+// StreamHandler serves a stream connection after it joined the hub. The
+// connection closes when the handler returns; handlers should return once
+// conn.Done() is closed.
+type StreamHandler func(conn *Conn) error
+
+// Hub tracks stream connections and broadcasts messages to them
+type Hub struct {
+	config   HubConfig
+	upgrader websocket.Upgrader
+	nextID   atomic.Uint64
+
+	mu     sync.RWMutex
+	conns  map[*Conn]struct{}
+	rooms  map[string]map[*Conn]struct{}
+	closed bool
+}
+
+// NewHub creates a stream hub
+func NewHub(config HubConfig) *Hub {
+	config.SetDefaults()
+	return &Hub{
+		config: config,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: config.CheckOrigin,
+		},
+		conns: make(map[*Conn]struct{}),
+		rooms: make(map[string]map[*Conn]struct{}),
+	}
+}
+
+// HubParams holds the dependencies of the module stream hub
+type HubParams struct {
+	fx.In
+	Config    *fxConfig.Config
+	Lifecycle fx.Lifecycle
+}
+
+// NewStreamHub creates the module stream hub from server.streams config.
+// Connections left open at shutdown are closed.
+func NewStreamHub(p HubParams) *Hub {
+	accessor := p.Config.Accessor
+	hub := NewHub(HubConfig{
+		SendBuffer:     accessor.Int("server.streams.send_buffer"),
+		DropWhenFull:   accessor.Bool("server.streams.drop_when_full"),
+		PingInterval:   time.Duration(accessor.Int("server.streams.ping_interval")) * time.Second,
+		PongTimeout:    time.Duration(accessor.Int("server.streams.pong_timeout")) * time.Second,
+		WriteTimeout:   time.Duration(accessor.Int("server.streams.write_timeout")) * time.Second,
+		MaxMessageSize: int64(accessor.Int("server.streams.max_message_size")),
+	})
+	p.Lifecycle.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			hub.Close()
+			return nil
+		},
+	})
+	return hub
+}
+
+// Count returns the number of open connections
+func (h *Hub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.conns)
+}
+
+// RoomCount returns the number of connections in a room
+func (h *Hub) RoomCount(room string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.rooms[room])
+}
+
+// Broadcast sends msg to every connection and returns how many queued it
+func (h *Hub) Broadcast(msg Message) int {
+	h.mu.RLock()
+	targets := make([]*Conn, 0, len(h.conns))
+	for conn := range h.conns {
+		targets = append(targets, conn)
+	}
+	h.mu.RUnlock()
+	return sendAll(targets, msg)
+}
+
+// BroadcastTo sends msg to the connections in room
+func (h *Hub) BroadcastTo(room string, msg Message) int {
+	h.mu.RLock()
+	targets := make([]*Conn, 0, len(h.rooms[room]))
+	for conn := range h.rooms[room] {
+		targets = append(targets, conn)
+	}
+	h.mu.RUnlock()
+	return sendAll(targets, msg)
+}
+
+// Close closes every connection and rejects new ones
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	conns := make([]*Conn, 0, len(h.conns))
+	for conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	h.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.closeWith(errGoingAway)
+	}
+}
+
+func sendAll(conns []*Conn, msg Message) int {
+	sent := 0
+	for _, conn := range conns {
+		if conn.Send(msg) == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+func (h *Hub) add(conn *Conn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false
+	}
+	h.conns[conn] = struct{}{}
+	return true
+}
+
+func (h *Hub) remove(conn *Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns, conn)
+	for room := range conn.rooms {
+		h.leave(conn, room)
+	}
+}
+
+func (h *Hub) leave(conn *Conn, room string) {
+	delete(conn.rooms, room)
+	if members := h.rooms[room]; members != nil {
+		delete(members, conn)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+// Conn is a WebSocket or SSE connection
+type Conn struct {
+	id       string
+	hub      *Hub
+	ctx      echo.Context
+	send     chan Message
+	incoming chan Message
+	done     chan struct{}
+	// finished is closed when the handler returns; the writer then sends
+	// the queued messages before the connection closes
+	finished chan struct{}
+	once     sync.Once
+	err      error
+	// rooms is guarded by hub.mu
+	rooms map[string]struct{}
+}
+
+func newConn(hub *Hub, c echo.Context) *Conn {
+	return &Conn{
+		id:       strconv.FormatUint(hub.nextID.Add(1), 10),
+		hub:      hub,
+		ctx:      c,
+		send:     make(chan Message, hub.config.SendBuffer),
+		incoming: make(chan Message, hub.config.SendBuffer),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+		rooms:    make(map[string]struct{}),
+	}
+}
+
+// ID returns the connection id, unique within its hub
+func (c *Conn) ID() string {
+	return c.id
+}
+
+// Context returns the Echo context of the request that opened the stream
+func (c *Conn) Context() echo.Context {
+	return c.ctx
+}
+
+// Hub returns the hub the connection belongs to
+func (c *Conn) Hub() *Hub {
+	return c.hub
+}
+
+// Done is closed when the connection closes
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection closed, nil while open or on normal close
+func (c *Conn) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Join adds the connection to a room
+func (c *Conn) Join(room string) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	if _, ok := c.hub.conns[c]; !ok {
+		return
+	}
+	c.rooms[room] = struct{}{}
+	if c.hub.rooms[room] == nil {
+		c.hub.rooms[room] = make(map[*Conn]struct{})
+	}
+	c.hub.rooms[room][c] = struct{}{}
+}
+
+// Leave removes the connection from a room
+func (c *Conn) Leave(room string) {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	c.hub.leave(c, room)
+}
+
+// Send queues msg without blocking. When the send buffer is full the
+// connection is closed as a slow consumer, or the message is dropped
+// with DropWhenFull.
+func (c *Conn) Send(msg Message) error {
+	select {
+	case <-c.done:
+		return ErrConnClosed
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+		return nil
+	case <-c.done:
+		return ErrConnClosed
+	default:
+		if !c.hub.config.DropWhenFull {
+			c.closeWith(ErrSlowConsumer)
+		}
+		return ErrSlowConsumer
+	}
+}
+
+// Receive returns the next message sent by a WebSocket client. It returns
+// ErrConnClosed once the connection closes; SSE connections never receive.
+func (c *Conn) Receive() (Message, error) {
+	select {
+	case msg := <-c.incoming:
+		return msg, nil
+	case <-c.done:
+		return Message{}, ErrConnClosed
+	}
+}
+
+// Close closes the connection
+func (c *Conn) Close() {
+	c.closeWith(nil)
+}
+
+func (c *Conn) closeWith(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+}
+
+// serve runs handler on conn until it returns or the connection closes
+func (h *Hub) serve(c echo.Context, conn *Conn, handler StreamHandler, writeLoop func() error) error {
+	MarkLongLived(c)
+
+	if !h.add(conn) {
+		return NewError(http.StatusServiceUnavailable, "unavailable", "server shutting down")
+	}
+	defer h.remove(conn)
+
+	// Close on client disconnect, server drain and hub close. The Echo
+	// context is reused once the handler returns, so it is not read here.
+	draining := Draining(c)
+	requestDone := c.Request().Context().Done()
+	go func() {
+		select {
+		case <-requestDone:
+			conn.Close()
+		case <-draining:
+			conn.closeWith(errGoingAway)
+		case <-conn.done:
+		}
+	}()
+
+	written := make(chan error, 1)
+	go func() { written <- writeLoop() }()
+
+	err := handler(conn)
+	close(conn.finished)
+	writeErr := <-written
+	conn.Close()
+	if err == nil {
+		err = writeErr
+	}
+	return err
+}
+
+// flush takes the next message queued when the handler returned; ok is
+// false once the queue is empty or the connection was aborted
+func (c *Conn) flush() (Message, bool) {
+	select {
+	case <-c.done:
+		return Message{}, false
+	default:
+	}
+	select {
+	case msg := <-c.send:
+		return msg, true
+	default:
+		return Message{}, false
+	}
+}
+
+// WS creates a GET route upgrading requests to WebSocket connections
+// served by handler and tracked by hub
+func WS(path string, hub *Hub, handler StreamHandler) *RouteBuilder {
+	return GET(path, func(c echo.Context) error {
+		clearTimeout(c)
+		ws, err := hub.upgrader.Upgrade(c.Response(), c.Request(), nil)
+		if err != nil {
+			// The upgrader already wrote the error response
+			return nil
+		}
+		defer ws.Close()
+
+		conn := newConn(hub, c)
+		go conn.readLoop(ws)
+		err = hub.serve(c, conn, handler, func() error {
+			return conn.writeWebSocket(ws)
+		})
+		if err != nil {
+			c.Logger().Error(err)
+		}
+		// The connection is hijacked, nothing can be written anymore
+		return nil
+	}).Meta(MetaStream, StreamWebSocket)
+}
+
+// SSE creates a GET route streaming Server-Sent Events to connections
+// served by handler and tracked by hub
+func SSE(path string, hub *Hub, handler StreamHandler) *RouteBuilder {
+	return GET(path, func(c echo.Context) error {
+		clearTimeout(c)
+		res := c.Response()
+		// Streams outlive the server write timeout
+		if err := http.NewResponseController(res.Writer).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return fmt.Errorf("failed to clear write deadline: %w", err)
+		}
+
+		header := res.Header()
+		header.Set(echo.HeaderContentType, "text/event-stream")
+		header.Set(echo.HeaderCacheControl, "no-cache")
+		header.Set(echo.HeaderConnection, "keep-alive")
+		header.Set("X-Accel-Buffering", "no")
+		res.WriteHeader(http.StatusOK)
+		res.Flush()
+
+		conn := newConn(hub, c)
+		return hub.serve(c, conn, handler, func() error {
+			return conn.writeSSE(res)
+		})
+	}).Meta(MetaStream, StreamSSE)
+}
+
+// readLoop delivers WebSocket messages to Receive and handles pongs
+func (c *Conn) readLoop(ws *websocket.Conn) {
+	config := c.hub.config
+	ws.SetReadLimit(config.MaxMessageSize)
+	_ = ws.SetReadDeadline(time.Now().Add(config.PongTimeout))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(config.PongTimeout))
+	})
+
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			c.Close()
+			return
+		}
+		select {
+		case c.incoming <- Message{Data: data}:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// writeWebSocket writes queued messages and pings until the connection
+// closes, then sends a close frame
+func (c *Conn) writeWebSocket(ws *websocket.Conn) error {
+	config := c.hub.config
+	ticker := time.NewTicker(config.PingInterval)
+	defer ticker.Stop()
+
+	write := func(msg Message) bool {
+		_ = ws.SetWriteDeadline(time.Now().Add(config.WriteTimeout))
+		if err := ws.WriteMessage(websocket.TextMessage, msg.Data); err != nil {
+			c.Close()
+			return false
+		}
+		return true
+	}
+	closeFrame := func() {
+		code, text := websocket.CloseNormalClosure, ""
+		switch c.err {
+		case errGoingAway:
+			code, text = websocket.CloseGoingAway, c.err.Error()
+		case ErrSlowConsumer:
+			code, text = websocket.ClosePolicyViolation, "slow consumer"
+		}
+		_ = ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(config.WriteTimeout))
+	}
+
+	for {
+		select {
+		case msg := <-c.send:
+			if !write(msg) {
+				return nil
+			}
+		case <-ticker.C:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(config.WriteTimeout)); err != nil {
+				c.Close()
+				return nil
+			}
+		case <-c.finished:
+			for msg, ok := c.flush(); ok; msg, ok = c.flush() {
+				if !write(msg) {
+					return nil
+				}
+			}
+			c.Close()
+			closeFrame()
+			return nil
+		case <-c.done:
+			closeFrame()
+			return nil
+		}
+	}
+}
+
+// writeSSE writes queued messages as events and comments as keepalive
+// until the connection closes
+func (c *Conn) writeSSE(res *echo.Response) error {
+	config := c.hub.config
+	controller := http.NewResponseController(res.Writer)
+	ticker := time.NewTicker(config.PingInterval)
+	defer ticker.Stop()
+
+	write := func(payload string) bool {
+		_ = controller.SetWriteDeadline(time.Now().Add(config.WriteTimeout))
+		if _, err := res.Write([]byte(payload)); err != nil {
+			c.Close()
+			return false
+		}
+		res.Flush()
+		return true
+	}
+
+	for {
+		select {
+		case msg := <-c.send:
+			if !write(formatEvent(msg)) {
+				return nil
+			}
+		case <-ticker.C:
+			if !write(": ping\n\n") {
+				return nil
+			}
+		case <-c.finished:
+			for msg, ok := c.flush(); ok; msg, ok = c.flush() {
+				if !write(formatEvent(msg)) {
+					return nil
+				}
+			}
+			return nil
+		case <-c.done:
+			return nil
+		}
+	}
+}
+
+// formatEvent encodes msg in the text/event-stream format. Line breaks
+// are removed from the id and event name so they cannot inject fields, and
+// every line of the data gets its own data field.
+func formatEvent(msg Message) string {
+	var b strings.Builder
+	if id := eventFieldReplacer.Replace(msg.ID); id != "" {
+		b.WriteString("id: " + id + "\n")
+	}
+	if event := eventFieldReplacer.Replace(msg.Event); event != "" {
+		b.WriteString("event: " + event + "\n")
+	}
+	data := eventDataReplacer.Replace(string(msg.Data))
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+var (
+	// eventFieldReplacer strips the line breaks of single-line fields
+	eventFieldReplacer = strings.NewReplacer("\r", "", "\n", "")
+	// eventDataReplacer normalizes CRLF and CR, which also end a line
+	eventDataReplacer = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+)
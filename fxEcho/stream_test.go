@@ -0,0 +1,222 @@
+package FxEcho
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStreamServer(t *testing.T, hub *Hub) (*httptest.Server, *Drain) {
+	drain := NewDrain()
+	e := echo.New()
+	e.Use(drain.track())
+
+	routes := []RouteRegistryIf{
+		WS("/ws/:room", hub, func(conn *Conn) error {
+			conn.Join(conn.Context().Param("room"))
+			for {
+				msg, err := conn.Receive()
+				if err != nil {
+					return nil
+				}
+				hub.BroadcastTo(conn.Context().Param("room"), msg)
+			}
+		}).Build(),
+		SSE("/events", hub, func(conn *Conn) error {
+			conn.Join("news")
+			<-conn.Done()
+			return nil
+		}).Build(),
+	}
+	for _, r := range routes {
+		e.Add(r.Method(), r.Path(), r.Handle)
+	}
+
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return server, drain
+}
+
+func dialWS(t *testing.T, server *httptest.Server, path string) *websocket.Conn {
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func TestWebSocketRooms(t *testing.T) {
+	hub := NewHub(HubConfig{})
+	server, _ := newStreamServer(t, hub)
+
+	alice := dialWS(t, server, "/ws/lobby")
+	bob := dialWS(t, server, "/ws/lobby")
+	carol := dialWS(t, server, "/ws/other")
+	require.Eventually(t, func() bool { return hub.RoomCount("lobby") == 2 && hub.Count() == 3 }, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, alice.WriteMessage(websocket.TextMessage, []byte("hello")))
+	for _, ws := range []*websocket.Conn{alice, bob} {
+		_, data, err := ws.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(data))
+	}
+
+	assert.Equal(t, 3, hub.Broadcast(TextMessage("all")))
+	_, data, err := carol.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "all", string(data))
+
+	carol.Close()
+	require.Eventually(t, func() bool { return hub.Count() == 2 }, time.Second, 5*time.Millisecond)
+}
+
+func TestWebSocketKeepalive(t *testing.T) {
+	hub := NewHub(HubConfig{PingInterval: 20 * time.Millisecond})
+	server, _ := newStreamServer(t, hub)
+
+	ws := dialWS(t, server, "/ws/lobby")
+	pinged := make(chan struct{}, 1)
+	ws.SetPingHandler(func(string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	go func() {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Fatal("no ping received")
+	}
+
+	// Without pongs the server closes the connection after the pong timeout
+	require.Eventually(t, func() bool { return hub.Count() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestWebSocketDrain(t *testing.T) {
+	hub := NewHub(HubConfig{})
+	server, drain := newStreamServer(t, hub)
+
+	ws := dialWS(t, server, "/ws/lobby")
+	require.Eventually(t, func() bool { return drain.LongLived() == 1 }, time.Second, 5*time.Millisecond)
+
+	drain.Start()
+	_, _, err := ws.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+	assert.NoError(t, drain.Wait(t.Context()))
+}
+
+func TestSSEStream(t *testing.T) {
+	hub := NewHub(HubConfig{})
+	server, drain := newStreamServer(t, hub)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+	require.NoError(t, err)
+	req.Header.Set(echo.HeaderAccept, "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get(echo.HeaderContentType))
+
+	require.Eventually(t, func() bool { return hub.RoomCount("news") == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int64(1), drain.LongLived())
+
+	msg, err := JSONMessage("update", map[string]int{"id": 1})
+	require.NoError(t, err)
+	msg.ID = "7"
+	assert.Equal(t, 1, hub.BroadcastTo("news", msg))
+
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 4 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		lines = append(lines, line)
+	}
+	assert.Equal(t, []string{"id: 7\n", "event: update\n", "data: {\"id\":1}\n", "\n"}, lines)
+
+	// Draining ends the stream
+	drain.Start()
+	_, err = reader.ReadString('\n')
+	assert.Error(t, err)
+	assert.NoError(t, drain.Wait(t.Context()))
+}
+
+func TestStreamDeliversLastMessages(t *testing.T) {
+	hub := NewHub(HubConfig{})
+	e := echo.New()
+	for _, r := range []RouteRegistryIf{
+		WS("/ws", hub, func(conn *Conn) error {
+			_ = conn.Send(TextMessage("hello"))
+			return conn.Send(TextMessage("bye"))
+		}).Build(),
+		SSE("/events", hub, func(conn *Conn) error {
+			return conn.Send(TextMessage("bye"))
+		}).Build(),
+	} {
+		e.Add(r.Method(), r.Path(), r.Handle)
+	}
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	// Messages queued right before the handler returns are not dropped
+	for i := 0; i < 50; i++ {
+		ws := dialWS(t, server, "/ws")
+		for _, want := range []string{"hello", "bye"} {
+			_, data, err := ws.ReadMessage()
+			require.NoError(t, err)
+			assert.Equal(t, want, string(data))
+		}
+		_, _, err := ws.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "got %v", err)
+
+		resp, err := http.Get(server.URL + "/events")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, "data: bye\n\n", string(body))
+	}
+}
+
+func TestFormatEventLineBreaks(t *testing.T) {
+	got := formatEvent(Message{
+		ID:    "7\r\ndata: injected",
+		Event: "update\nretry: 1",
+		Data:  []byte("a\r\nb\rc"),
+	})
+	assert.Equal(t, "id: 7data: injected\nevent: updateretry: 1\ndata: a\ndata: b\ndata: c\n\n", got)
+}
+
+func TestConnBackpressure(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	hub := NewHub(HubConfig{SendBuffer: 1})
+	conn := newConn(hub, c)
+	assert.NoError(t, conn.Send(TextMessage("one")))
+	assert.ErrorIs(t, conn.Send(TextMessage("two")), ErrSlowConsumer)
+	assert.ErrorIs(t, conn.Err(), ErrSlowConsumer)
+	assert.ErrorIs(t, conn.Send(TextMessage("three")), ErrConnClosed)
+
+	hub = NewHub(HubConfig{SendBuffer: 1, DropWhenFull: true})
+	conn = newConn(hub, c)
+	assert.NoError(t, conn.Send(TextMessage("one")))
+	assert.ErrorIs(t, conn.Send(TextMessage("two")), ErrSlowConsumer)
+	assert.NoError(t, conn.Err())
+}
@@ -0,0 +1,152 @@
+package FxEcho
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// timeoutContextKey stores the timeout state of a request in the Echo context
+const timeoutContextKey = "fxecho.timeout_state"
+
+// newRequestTimeouts creates the counter of requests whose handler
+// deadline was exceeded, registered by NewServers
+func newRequestTimeouts() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fxecho_request_timeouts_total",
+		Help: "Requests whose handler deadline was exceeded.",
+	}, []string{"server", "method", "route"})
+}
+
+// timeoutState is the deadline configuration of a single request
+type timeoutState struct {
+	// base is the request context before any handler deadline
+	base    context.Context
+	timeout time.Duration
+	start   time.Time
+}
+
+// RequestTimeout returns the handler deadline applied to the request,
+// zero when the request has none
+func RequestTimeout(c echo.Context) time.Duration {
+	if state, ok := c.Get(timeoutContextKey).(*timeoutState); ok {
+		return state.timeout
+	}
+	return 0
+}
+
+// requestTimeout applies the server default handler deadline. It runs
+// before all other middlewares so that they see the deadline too.
+func requestTimeout(timeout time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			state := &timeoutState{base: c.Request().Context(), start: time.Now()}
+			c.Set(timeoutContextKey, state)
+			if timeout > 0 && !isLongLived(c.Request()) {
+				cancel := setTimeout(c, state, timeout)
+				defer cancel()
+			}
+			return next(c)
+		}
+	}
+}
+
+// reportTimeouts turns exceeded deadlines into timeout errors, logged and
+// counted per route. It runs after all other middlewares, before the
+// logger middleware or the error handler write the response.
+func reportTimeouts(server string, status int, logger *zap.Logger, timeouts *prometheus.CounterVec) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+
+			exceeded := errors.Is(c.Request().Context().Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded)
+			if !exceeded || c.Response().Committed {
+				return err
+			}
+
+			var timeout time.Duration
+			start := time.Now()
+			if state, ok := c.Get(timeoutContextKey).(*timeoutState); ok {
+				timeout, start = state.timeout, state.start
+			}
+			logger.Warn("request timed out",
+				zap.String("server", server),
+				zap.String("method", c.Request().Method),
+				zap.String("route", c.Path()),
+				zap.Duration("timeout", timeout),
+				zap.Duration("elapsed", time.Since(start)),
+				zap.Error(err),
+			)
+			timeouts.WithLabelValues(server, c.Request().Method, c.Path()).Inc()
+
+			if err == nil {
+				err = context.DeadlineExceeded
+			}
+			return NewError(status, "timeout", "request timed out").Wrap(err)
+		}
+	}
+}
+
+// contextTimeout replaces the handler deadline of the request. Route and
+// group timeouts may extend the server default as well as shorten it.
+func contextTimeout(timeout time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			state, ok := c.Get(timeoutContextKey).(*timeoutState)
+			if !ok {
+				state = &timeoutState{base: c.Request().Context(), start: time.Now()}
+				c.Set(timeoutContextKey, state)
+			}
+			cancel := setTimeout(c, state, timeout)
+			defer cancel()
+			return next(c)
+		}
+	}
+}
+
+// setTimeout replaces the deadline of the request context
+func setTimeout(c echo.Context, state *timeoutState, timeout time.Duration) context.CancelFunc {
+	ctx, cancel := context.WithTimeout(withoutDeadline(c, state), timeout)
+	state.timeout = timeout
+	c.SetRequest(c.Request().WithContext(ctx))
+	return cancel
+}
+
+// clearTimeout removes the handler deadline, e.g. for streams
+func clearTimeout(c echo.Context) {
+	state, ok := c.Get(timeoutContextKey).(*timeoutState)
+	if !ok {
+		return
+	}
+	state.timeout = 0
+	c.SetRequest(c.Request().WithContext(withoutDeadline(c, state)))
+}
+
+// withoutDeadline returns the request context without the handler
+// deadline: it is canceled with the base context, e.g. on client
+// disconnect, and keeps the values added by middlewares since, such as
+// the principal or a transaction.
+func withoutDeadline(c echo.Context, state *timeoutState) context.Context {
+	return valuesContext{Context: state.base, values: c.Request().Context()}
+}
+
+// valuesContext takes its deadline and cancellation from the embedded
+// context and its values from another
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (v valuesContext) Value(key any) any {
+	return v.values.Value(key)
+}
+
+// validTimeoutStatus reports whether status may answer exceeded deadlines
+func validTimeoutStatus(status int) bool {
+	return status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
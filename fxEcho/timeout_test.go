@@ -0,0 +1,193 @@
+package FxEcho
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// waitForDeadline blocks until the request context is done
+func waitForDeadline(c echo.Context) error {
+	select {
+	case <-c.Request().Context().Done():
+		return c.Request().Context().Err()
+	case <-time.After(time.Second):
+		return c.String(http.StatusOK, "done")
+	}
+}
+
+func newTimeoutEcho(status int, logger *zap.Logger, timeouts *prometheus.CounterVec) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = NewErrorHandler(ErrorHandlerParams{Logger: zap.NewNop()}).Handle
+	e.Use(requestTimeout(20 * time.Millisecond))
+	e.Use(reportTimeouts("test", status, logger, timeouts))
+
+	routes := []RouteRegistryIf{
+		GET("/default", waitForDeadline).Build(),
+		GET("/extended", func(c echo.Context) error {
+			time.Sleep(40 * time.Millisecond)
+			if err := c.Request().Context().Err(); err != nil {
+				return err
+			}
+			return c.String(http.StatusOK, RequestTimeout(c).String())
+		}).Timeout(time.Second).Build(),
+		GET("/ignored", func(c echo.Context) error {
+			time.Sleep(40 * time.Millisecond)
+			return nil
+		}).Build(),
+		GET("/late", func(c echo.Context) error {
+			time.Sleep(40 * time.Millisecond)
+			return c.String(http.StatusOK, "late")
+		}).Build(),
+	}
+	for _, r := range routes {
+		e.Add(r.Method(), r.Path(), r.Handle)
+	}
+
+	group := NewGroup("/group").
+		Timeout(time.Second).
+		AddRoute(GET("/short", waitForDeadline).Timeout(10 * time.Millisecond).Build()).
+		AddRoute(GET("/long", func(c echo.Context) error {
+			return c.String(http.StatusOK, RequestTimeout(c).String())
+		}).Build()).
+		Build()
+	group.Register(e.Group(group.Prefix()))
+	return e
+}
+
+func TestRequestTimeout(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	timeouts := newRequestTimeouts()
+	e := newTimeoutEcho(http.StatusServiceUnavailable, zap.New(core), timeouts)
+
+	rec := serve(e, "/default")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"code":"timeout"`)
+	assert.Equal(t, 1.0, testutil.ToFloat64(timeouts.WithLabelValues("test", http.MethodGet, "/default")))
+
+	entries := logs.FilterMessage("request timed out").All()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "/default", entries[0].ContextMap()["route"])
+	assert.Equal(t, 20*time.Millisecond, entries[0].ContextMap()["timeout"])
+
+	// Route and group timeouts replace the server default
+	rec = serve(e, "/extended")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1s", rec.Body.String())
+	assert.Equal(t, "1s", serve(e, "/group/long").Body.String())
+	assert.Equal(t, http.StatusServiceUnavailable, serve(e, "/group/short").Code)
+
+	// Handlers ignoring the deadline still answer with a timeout
+	assert.Equal(t, http.StatusServiceUnavailable, serve(e, "/ignored").Code)
+
+	// Responses written before the handler returned are kept
+	rec = serve(e, "/late")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "late", rec.Body.String())
+}
+
+func TestRequestTimeoutKeepsContextValues(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = NewErrorHandler(ErrorHandlerParams{Logger: zap.NewNop()}).Handle
+	e.Use(requestTimeout(20 * time.Millisecond))
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			SetPrincipal(c, testPrincipal{subject: "alice"})
+			return next(c)
+		}
+	})
+
+	subject := func(c echo.Context) error {
+		p, ok := PrincipalFromContext(c.Request().Context())
+		if !ok {
+			return NewUnauthorizedError("no principal")
+		}
+		return c.String(http.StatusOK, p.Subject()+" "+RequestTimeout(c).String())
+	}
+	for _, r := range []RouteRegistryIf{
+		GET("/route", subject).Timeout(2 * time.Second).Build(),
+		GET("/cleared", func(c echo.Context) error {
+			clearTimeout(c)
+			if _, ok := c.Request().Context().Deadline(); ok {
+				return NewInternalError("deadline kept")
+			}
+			return subject(c)
+		}).Build(),
+	} {
+		e.Add(r.Method(), r.Path(), r.Handle)
+	}
+
+	rec := serve(e, "/route")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "alice 2s", rec.Body.String())
+	rec = serve(e, "/cleared")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "alice 0s", rec.Body.String())
+}
+
+func TestRequestTimeoutClientCanceled(t *testing.T) {
+	e := newTimeoutEcho(http.StatusGatewayTimeout, zap.NewNop(), newRequestTimeouts())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/default", nil).WithContext(ctx))
+	assert.Equal(t, StatusClientClosedRequest, rec.Code)
+}
+
+func TestRequestTimeoutConfig(t *testing.T) {
+	viper.Set("server.request_timeout", 1)
+	defer viper.Reset()
+
+	config, err := NewServerConfig(newTestConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, config.RequestTimeout)
+	assert.Equal(t, http.StatusGatewayTimeout, config.RequestTimeoutStatus)
+
+	viper.Set("server.request_timeout_status", 500)
+	app := fx.New(fx.NopLogger, fx.Provide(newTestConfig, newTestLogger), FxEcho)
+	assert.Error(t, app.Err())
+	assert.Contains(t, app.Err().Error(), "invalid server.request_timeout_status 500")
+}
+
+func TestRequestTimeoutRegisterer(t *testing.T) {
+	viper.Set("server.listen", false)
+	defer viper.Reset()
+
+	registry := prometheus.NewRegistry()
+	var e *echo.Echo
+	app := fxtest.New(t,
+		fx.Provide(
+			newTestConfig,
+			newTestLogger,
+			AsRoute(func() RouteRegistryIf {
+				return GET("/slow", waitForDeadline).Timeout(10 * time.Millisecond).Build()
+			}),
+		),
+		fx.Supply(fx.Annotate(registry, fx.As(new(prometheus.Registerer)))),
+		FxEcho,
+		fx.Populate(&e),
+	)
+	app.RequireStart()
+
+	assert.Equal(t, http.StatusGatewayTimeout, serve(e, "/slow").Code)
+	n, err := testutil.GatherAndCount(registry, "fxecho_request_timeouts_total")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	app.RequireStop()
+	n, _ = testutil.GatherAndCount(registry)
+	assert.Zero(t, n)
+}
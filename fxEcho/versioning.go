@@ -0,0 +1,276 @@
+package FxEcho
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Version headers set on versioned responses
+const (
+	HeaderAPIVersion  = "X-API-Version"
+	HeaderDeprecation = "Deprecation"
+	HeaderSunset      = "Sunset"
+)
+
+type versionKind int
+
+const (
+	versionByPath versionKind = iota
+	versionByHeader
+	versionByAccept
+)
+
+// VersionStrategy selects how clients request an API version
+type VersionStrategy struct {
+	kind   versionKind
+	header string
+	vendor string
+}
+
+// VersionByPath mounts each version under its own path segment,
+// e.g. /api/v1/users and /api/v2/users
+func VersionByPath() VersionStrategy {
+	return VersionStrategy{kind: versionByPath}
+}
+
+// VersionByHeader selects the version from a request header,
+// e.g. X-API-Version: v2
+func VersionByHeader(name string) VersionStrategy {
+	return VersionStrategy{kind: versionByHeader, header: name}
+}
+
+// VersionByAccept selects the version from a vendor media type in the
+// Accept header, e.g. application/vnd.acme.v2+json or
+// application/vnd.acme+json; version=v2 for vendor "application/vnd.acme"
+func VersionByAccept(vendor string) VersionStrategy {
+	return VersionStrategy{kind: versionByAccept, vendor: vendor}
+}
+
+// requested returns the version asked for by the request, if any
+func (s VersionStrategy) requested(c echo.Context) string {
+	switch s.kind {
+	case versionByHeader:
+		return c.Request().Header.Get(s.header)
+	case versionByAccept:
+		for _, accept := range strings.Split(c.Request().Header.Get(echo.HeaderAccept), ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+			if err != nil {
+				continue
+			}
+			// The structured syntax suffix, e.g. +json, is not part of the version
+			base, _, _ := strings.Cut(mediaType, "+")
+			if base == s.vendor {
+				if v := params["version"]; v != "" {
+					return v
+				}
+				continue
+			}
+			// The version is the whole rest after the vendor and is looked up
+			// exactly, so vnd.acme.v10 and vnd.acmecorp.v1 never match v1
+			if version, ok := strings.CutPrefix(base, s.vendor+"."); ok && version != "" {
+				return version
+			}
+		}
+	}
+	return ""
+}
+
+// varyHeader is the request header responses depend on
+func (s VersionStrategy) varyHeader() string {
+	if s.kind == versionByAccept {
+		return echo.HeaderAccept
+	}
+	return s.header
+}
+
+// Deprecation describes the retirement schedule of an API version
+type Deprecation struct {
+	// Since is when the version was deprecated; zero means "now"
+	Since time.Time
+	// Sunset is when the version stops being served
+	Sunset time.Time
+	// Link points to migration documentation
+	Link string
+}
+
+// VersionBuilder provides a fluent interface for building an API version
+type VersionBuilder struct {
+	name        string
+	routes      []RouteRegistryIf
+	middleware  []echo.MiddlewareFunc
+	deprecation *Deprecation
+	isDefault   bool
+}
+
+// NewVersion creates a new API version builder
+func NewVersion(name string) *VersionBuilder {
+	return &VersionBuilder{
+		name:   name,
+		routes: make([]RouteRegistryIf, 0),
+	}
+}
+
+// AddRoute adds a route to the version
+func (vb *VersionBuilder) AddRoute(route RouteRegistryIf) *VersionBuilder {
+	vb.routes = append(vb.routes, route)
+	return vb
+}
+
+// Use adds middleware to all routes of the version
+func (vb *VersionBuilder) Use(middleware ...echo.MiddlewareFunc) *VersionBuilder {
+	vb.middleware = append(vb.middleware, middleware...)
+	return vb
+}
+
+// Deprecated marks the version as deprecated. Responses carry
+// Deprecation, Sunset and Link headers.
+func (vb *VersionBuilder) Deprecated(deprecation Deprecation) *VersionBuilder {
+	vb.deprecation = &deprecation
+	return vb
+}
+
+// Default serves this version when a header or media type strategy
+// request does not ask for a version. The last added version is the
+// default otherwise.
+func (vb *VersionBuilder) Default() *VersionBuilder {
+	vb.isDefault = true
+	return vb
+}
+
+// Versioned declares the versioning strategy of the group
+func (gb *GroupBuilder) Versioned(strategy VersionStrategy) *GroupBuilder {
+	gb.versioning = &strategy
+	return gb
+}
+
+// AddVersion adds an API version to the group
+func (gb *GroupBuilder) AddVersion(version *VersionBuilder) *GroupBuilder {
+	if gb.versioning == nil {
+		gb.Versioned(VersionByPath())
+	}
+	gb.versions = append(gb.versions, version)
+	return gb
+}
+
+// versionHeaders sets the version and deprecation headers of a response
+func (vb *VersionBuilder) versionHeaders(c echo.Context) {
+	header := c.Response().Header()
+	header.Set(HeaderAPIVersion, vb.name)
+	if vb.deprecation == nil {
+		return
+	}
+	if vb.deprecation.Since.IsZero() {
+		header.Set(HeaderDeprecation, "true")
+	} else {
+		header.Set(HeaderDeprecation, "@"+strconv.FormatInt(vb.deprecation.Since.Unix(), 10))
+	}
+	if !vb.deprecation.Sunset.IsZero() {
+		header.Set(HeaderSunset, vb.deprecation.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if vb.deprecation.Link != "" {
+		header.Add("Link", "<"+vb.deprecation.Link+`>; rel="deprecation"`)
+	}
+}
+
+// handle runs the version middlewares and the route
+func (vb *VersionBuilder) handle(route RouteRegistryIf) echo.HandlerFunc {
+	h := echo.HandlerFunc(route.Handle)
+	for i := len(vb.middleware) - 1; i >= 0; i-- {
+		h = vb.middleware[i](h)
+	}
+	return func(c echo.Context) error {
+		vb.versionHeaders(c)
+		return h(c)
+	}
+}
+
+// registerVersions mounts the group versions according to the strategy.
+// It returns the route names that Echo cannot keep because several
+// versions share a route, mapped to the name Echo knows the route by.
+func registerVersions(group *echo.Group, strategy VersionStrategy, versions []*VersionBuilder) map[string]string {
+	if len(versions) == 0 {
+		return nil
+	}
+
+	if strategy.kind == versionByPath {
+		for _, v := range versions {
+			vg := group.Group("/" + v.name)
+			for _, route := range v.routes {
+				r := vg.Add(route.Method(), route.Path(), v.handle(route))
+				if name := route.Name(); name != "" {
+					r.Name = name
+				}
+			}
+		}
+		return nil
+	}
+
+	defaultVersion := versions[len(versions)-1]
+	byName := make(map[string]*VersionBuilder, len(versions))
+	for _, v := range versions {
+		byName[v.name] = v
+		if v.isDefault {
+			defaultVersion = v
+		}
+	}
+
+	// Every method and path served by any version gets one dispatching route
+	type endpoint struct{ method, path string }
+	order := make([]endpoint, 0)
+	handlers := make(map[endpoint]map[string]echo.HandlerFunc)
+	names := make(map[endpoint][]string)
+	for _, v := range versions {
+		for _, route := range v.routes {
+			key := endpoint{route.Method(), route.Path()}
+			if _, ok := handlers[key]; !ok {
+				handlers[key] = make(map[string]echo.HandlerFunc)
+				order = append(order, key)
+			}
+			handlers[key][v.name] = v.handle(route)
+			if name := route.Name(); name != "" {
+				names[key] = append(names[key], name)
+			}
+		}
+	}
+
+	aliases := make(map[string]string)
+	for _, key := range order {
+		byVersion := handlers[key]
+		r := group.Add(key.method, key.path, func(c echo.Context) error {
+			c.Response().Header().Add(echo.HeaderVary, strategy.varyHeader())
+
+			name := strategy.requested(c)
+			if name == "" {
+				name = defaultVersion.name
+			}
+			if _, ok := byName[name]; !ok {
+				if _, ok := byName["v"+name]; ok {
+					name = "v" + name
+				} else if strategy.kind == versionByAccept {
+					return NewError(http.StatusNotAcceptable, "unsupported_version", "unsupported API version "+name)
+				} else {
+					return NewBadRequestError("unsupported API version " + name)
+				}
+			}
+
+			h, ok := byVersion[name]
+			if !ok {
+				return echo.ErrNotFound
+			}
+			return h(c)
+		})
+		// Echo keeps one name per route, the route table resolves the others
+		if routeNames := names[key]; len(routeNames) > 0 {
+			r.Name = routeNames[0]
+			for _, alias := range routeNames[1:] {
+				aliases[alias] = r.Name
+			}
+		}
+	}
+	return aliases
+}
@@ -0,0 +1,154 @@
+package FxEcho
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var testSunset = time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func textHandler(body string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.String(http.StatusOK, body)
+	}
+}
+
+func newVersionedEcho(strategy VersionStrategy) (*echo.Echo, *RouteTable) {
+	e := echo.New()
+	e.HTTPErrorHandler = NewErrorHandler(ErrorHandlerParams{Logger: zap.NewNop()}).Handle
+
+	group := NewGroup("/api").
+		Versioned(strategy).
+		OpenAPI(OpenAPIInfo{Title: "Users API"}).
+		AddVersion(NewVersion("v1").
+			Deprecated(Deprecation{Sunset: testSunset, Link: "https://example.com/migrate"}).
+			AddRoute(GET("/users/:id", textHandler("v1 user")).Name("v1.users.show").Build()).
+			AddRoute(GET("/legacy", textHandler("legacy")).Build())).
+		AddVersion(NewVersion("v2").
+			AddRoute(GET("/users/:id", textHandler("v2 user")).Name("v2.users.show").Meta(MetaSummary, "Show a user").Build())).
+		Build()
+	group.Register(e.Group(group.Prefix()))
+	table := NewRouteTable()
+	table.mount(e)
+	table.addAliases(group)
+	return e, table
+}
+
+func get(e *echo.Echo, path string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestVersionByPath(t *testing.T) {
+	e, _ := newVersionedEcho(VersionByPath())
+
+	rec := get(e, "/api/v1/users/1")
+	assert.Equal(t, "v1 user", rec.Body.String())
+	assert.Equal(t, "v1", rec.Header().Get(HeaderAPIVersion))
+	assert.Equal(t, "true", rec.Header().Get(HeaderDeprecation))
+	assert.Equal(t, "Tue, 01 Jan 2030 00:00:00 GMT", rec.Header().Get(HeaderSunset))
+	assert.Equal(t, `<https://example.com/migrate>; rel="deprecation"`, rec.Header().Get("Link"))
+
+	rec = get(e, "/api/v2/users/1")
+	assert.Equal(t, "v2 user", rec.Body.String())
+	assert.Empty(t, rec.Header().Get(HeaderDeprecation))
+
+	assert.Equal(t, http.StatusNotFound, get(e, "/api/v2/legacy").Code)
+
+	url, err := URLFor(e, "v1.users.show", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/v1/users/5", url)
+}
+
+func TestVersionByHeader(t *testing.T) {
+	e, table := newVersionedEcho(VersionByHeader("X-API-Version"))
+
+	assert.Equal(t, "v1 user", get(e, "/api/users/1", "X-API-Version", "v1").Body.String())
+	assert.Equal(t, "v1 user", get(e, "/api/users/1", "X-API-Version", "1").Body.String())
+
+	rec := get(e, "/api/users/1")
+	assert.Equal(t, "v2 user", rec.Body.String())
+	assert.Equal(t, "X-API-Version", rec.Header().Get(echo.HeaderVary))
+
+	assert.Equal(t, http.StatusNotFound, get(e, "/api/legacy").Code)
+	assert.Equal(t, "legacy", get(e, "/api/legacy", "X-API-Version", "v1").Body.String())
+	assert.Equal(t, http.StatusBadRequest, get(e, "/api/users/1", "X-API-Version", "v9").Code)
+
+	for _, name := range []string{"v1.users.show", "v2.users.show"} {
+		url, err := table.URLFor(name, 5)
+		assert.NoError(t, err)
+		assert.Equal(t, "/api/users/5", url)
+	}
+	// Echo only knows the shared route by the first name
+	_, err := URLFor(e, "v2.users.show", 5)
+	assert.Error(t, err)
+
+	// Aliases stay with the server they were registered on
+	_, pathTable := newVersionedEcho(VersionByPath())
+	url, err := pathTable.URLFor("v2.users.show", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/v2/users/5", url)
+}
+
+func TestVersionByAccept(t *testing.T) {
+	e, _ := newVersionedEcho(VersionByAccept("application/vnd.acme"))
+
+	assert.Equal(t, "v1 user", get(e, "/api/users/1", echo.HeaderAccept, "application/vnd.acme.v1+json").Body.String())
+	assert.Equal(t, "v1 user", get(e, "/api/users/1", echo.HeaderAccept, "application/vnd.acme+json; version=v1").Body.String())
+	assert.Equal(t, "v2 user", get(e, "/api/users/1", echo.HeaderAccept, "application/json").Body.String())
+	assert.Equal(t, http.StatusNotAcceptable, get(e, "/api/users/1", echo.HeaderAccept, "application/vnd.acme.v3+json").Code)
+
+	// The version token is matched exactly
+	assert.Equal(t, http.StatusNotAcceptable, get(e, "/api/users/1", echo.HeaderAccept, "application/vnd.acme.v10+json").Code)
+	assert.Equal(t, http.StatusNotAcceptable, get(e, "/api/users/1", echo.HeaderAccept, "application/vnd.acme.v1.5+json").Code)
+	assert.Equal(t, "v2 user", get(e, "/api/users/1", echo.HeaderAccept, "application/vnd.acmex+json; version=v1").Body.String())
+	assert.Equal(t, "v2 user", get(e, "/api/users/1", echo.HeaderAccept, "application/vnd.acmex.v1+json").Body.String())
+
+	url, err := URLFor(e, "v1.users.show", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/users/5", url)
+}
+
+func TestVersionOpenAPI(t *testing.T) {
+	e, _ := newVersionedEcho(VersionByPath())
+
+	rec := get(e, "/api/openapi/v1.json")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var doc struct {
+		Info    map[string]string   `json:"info"`
+		Servers []map[string]string `json:"servers"`
+		Paths   map[string]map[string]struct {
+			OperationID string           `json:"operationId"`
+			Summary     string           `json:"summary"`
+			Deprecated  bool             `json:"deprecated"`
+			Parameters  []map[string]any `json:"parameters"`
+		} `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, "Users API", doc.Info["title"])
+	assert.Equal(t, "v1", doc.Info["version"])
+	assert.Equal(t, "/api/v1", doc.Servers[0]["url"])
+	assert.Len(t, doc.Paths, 2)
+	show := doc.Paths["/users/{id}"]["get"]
+	assert.Equal(t, "v1.users.show", show.OperationID)
+	assert.True(t, show.Deprecated)
+	assert.Equal(t, "id", show.Parameters[0]["name"])
+
+	rec = get(e, "/api/openapi/v2.json")
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, "Show a user", doc.Paths["/users/{id}"]["get"].Summary)
+	assert.False(t, doc.Paths["/users/{id}"]["get"].Deprecated)
+}
@@ -0,0 +1,80 @@
+// Command migrate applies the SQL migrations of the database configured in
+// ./configs/config.yaml.
+//
+//	migrate [-dir migrations] up|down|redo|status
+//	migrate [-dir migrations] create <name>
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	fxconfig "github.com/UTOL-s/module/fxConfig"
+	fxgorm "github.com/UTOL-s/module/fxGorm"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	dir := flag.String("dir", "", "migrations directory, database.migrations.dir by default")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: migrate [-dir migrations] up|down|redo|status|create <name>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	config, err := fxconfig.NewConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	migrations, err := fxgorm.NewMigrationConfig(config.Accessor)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if *dir != "" {
+		migrations.Dir = *dir
+	}
+	if migrations.Dir == "" {
+		migrations.Dir = "migrations"
+	}
+
+	if flag.Arg(0) == "create" {
+		if flag.NArg() != 2 {
+			return fmt.Errorf("usage: migrate create <name>")
+		}
+		up, down, err := fxgorm.CreateMigration(migrations.Dir, flag.Arg(1))
+		if err != nil {
+			return err
+		}
+		fmt.Println("created", up)
+		fmt.Println("created", down)
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	dm := fxgorm.NewDatabaseManager(fxgorm.NewGormConfig(config))
+	if err := dm.Connect(ctx); err != nil {
+		return err
+	}
+	defer dm.Close()
+
+	m, err := fxgorm.NewMigrator(dm.GetDB(), os.DirFS(migrations.Dir), migrations)
+	if err != nil {
+		return err
+	}
+	return fxgorm.RunMigrationCLI(ctx, m, flag.Arg(0), os.Stdout)
+}
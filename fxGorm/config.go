@@ -1,7 +1,9 @@
 package fxgorm
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	fxconfig "github.com/UTOL-s/module/fxConfig"
@@ -10,34 +12,133 @@ import (
 
 // NewGormConfig creates a new GORM configuration from the main config
 func NewGormConfig(config *fxconfig.Config) *GormConfig {
-	return &GormConfig{
+	gormConfig := newGormConfig(config.Accessor, "database")
+	gormConfig.Database.Host = config.Database.Host
+	gormConfig.Database.Port = config.Database.Port
+	gormConfig.Database.User = config.Database.User
+	gormConfig.Database.Password = config.Database.Password
+	gormConfig.Database.DBName = config.Database.DBName
+	gormConfig.Database.SSLMode = config.Database.SSLMode
+	return gormConfig
+}
+
+// NewNamedGormConfig creates the configuration of the named database
+// configured under databases.<name>
+func NewNamedGormConfig(accessor *fxconfig.Accessor, name string) *GormConfig {
+	gormConfig := newGormConfig(accessor, "databases."+name)
+	gormConfig.Database.Host = accessor.String("databases." + name + ".host")
+	gormConfig.Database.Port = accessor.Int("databases." + name + ".port")
+	gormConfig.Database.User = accessor.String("databases." + name + ".user")
+	gormConfig.Database.Password = accessor.String("databases." + name + ".password")
+	gormConfig.Database.DBName = accessor.String("databases." + name + ".dbname")
+	gormConfig.Database.SSLMode = accessor.String("databases." + name + ".sslmode")
+	return gormConfig
+}
+
+// newGormConfig reads the settings under prefix except the connection
+// settings, which the default database takes from the typed config
+func newGormConfig(accessor *fxconfig.Accessor, prefix string) *GormConfig {
+	var durationErrs []error
+	d := func(key string, unit time.Duration) time.Duration {
+		value, err := readDuration(accessor, key, unit)
+		if err != nil {
+			durationErrs = append(durationErrs, err)
+		}
+		return value
+	}
+	gormConfig := &GormConfig{
 		Database: DatabaseConfig{
-			Type:      DatabaseType(config.Accessor.String("database.type")),
-			Host:      config.Database.Host,
-			Port:      config.Database.Port,
-			User:      config.Database.User,
-			Password:  config.Database.Password,
-			DBName:    config.Database.DBName,
-			SSLMode:   config.Database.SSLMode,
-			Charset:   config.Accessor.String("database.charset"),
-			ParseTime: config.Accessor.Bool("database.parse_time"),
-			Loc:       config.Accessor.String("database.loc"),
-			File:      config.Accessor.String("database.file"),
+			Type:            DatabaseType(accessor.String(prefix + ".type")),
+			DSN:             accessor.String(prefix + ".dsn"),
+			SSLRootCert:     accessor.String(prefix + ".sslrootcert"),
+			SSLCert:         accessor.String(prefix + ".sslcert"),
+			SSLKey:          accessor.String(prefix + ".sslkey"),
+			ConnectTimeout:  d(prefix+".connect_timeout", time.Second),
+			ApplicationName: accessor.String(prefix + ".application_name"),
+			SearchPath:      accessor.String(prefix + ".search_path"),
+			Charset:         accessor.String(prefix + ".charset"),
+			ParseTime:       accessor.Bool(prefix + ".parse_time"),
+			Loc:             accessor.String(prefix + ".loc"),
+			File:            accessor.String(prefix + ".file"),
 		},
 		Pool: PoolConfig{
-			MaxIdleConns:    config.Accessor.Int("database.pool.max_idle_conns"),
-			MaxOpenConns:    config.Accessor.Int("database.pool.max_open_conns"),
-			ConnMaxLifetime: time.Duration(config.Accessor.Int("database.pool.conn_max_lifetime")) * time.Second,
-			ConnMaxIdleTime: time.Duration(config.Accessor.Int("database.pool.conn_max_idle_time")) * time.Second,
+			MaxIdleConns:    accessor.Int(prefix + ".pool.max_idle_conns"),
+			MaxOpenConns:    accessor.Int(prefix + ".pool.max_open_conns"),
+			ConnMaxLifetime: d(prefix+".pool.conn_max_lifetime", time.Second),
+			ConnMaxIdleTime: d(prefix+".pool.conn_max_idle_time", time.Second),
 		},
 		Log: LogConfig{
-			Level:                     logger.LogLevel(config.Accessor.Int("database.log.level")),
-			SlowThreshold:             time.Duration(config.Accessor.Int("database.log.slow_threshold")) * time.Millisecond,
-			Colorful:                  config.Accessor.Bool("database.log.colorful"),
-			IgnoreRecordNotFoundError: config.Accessor.Bool("database.log.ignore_record_not_found_error"),
+			Level:                     logger.LogLevel(accessor.Int(prefix + ".log.level")),
+			SlowThreshold:             d(prefix+".log.slow_threshold", time.Millisecond),
+			Colorful:                  accessor.Bool(prefix + ".log.colorful"),
+			IgnoreRecordNotFoundError: accessor.Bool(prefix + ".log.ignore_record_not_found_error"),
+			LogParams:                 accessor.Bool(prefix + ".log.log_params"),
+			Sampling: SamplingConfig{
+				Initial:    accessor.Int(prefix + ".log.sampling.initial"),
+				Thereafter: accessor.Int(prefix + ".log.sampling.thereafter"),
+			},
+		},
+		Replication: ReplicaConfig{
+			Policy:              accessor.String(prefix + ".replica_policy"),
+			HealthCheckInterval: d(prefix+".replica_health_interval", time.Second),
+			PrimaryTables:       accessor.StringSlice(prefix + ".primary_tables"),
+		},
+		Retry: RetryConfig{
+			MaxAttempts:         accessor.Int(prefix + ".retry.max_attempts"),
+			InitialInterval:     d(prefix+".retry.initial_interval", time.Millisecond),
+			MaxInterval:         d(prefix+".retry.max_interval", time.Millisecond),
+			Multiplier:          accessor.Float64(prefix + ".retry.multiplier"),
+			HealthCheckInterval: d(prefix+".retry.health_interval", time.Second),
+		},
+		Tx: TxConfig{
+			Isolation:     accessor.String(prefix + ".tx.isolation"),
+			MaxRetries:    accessor.Int(prefix + ".tx.max_retries"),
+			RetryInterval: d(prefix+".tx.retry_interval", time.Millisecond),
 		},
-		Debug: config.Accessor.Bool("database.debug"),
+		Debug: accessor.Bool(prefix + ".debug"),
 	}
+	gormConfig.durationErr = errors.Join(durationErrs...)
+	if accessor.IsSet(prefix + ".params") {
+		gormConfig.paramsErr = accessor.UnmarshalKey(prefix+".params", &gormConfig.Database.Params)
+	}
+	if accessor.IsSet(prefix + ".replicas") {
+		gormConfig.replicasErr = accessor.UnmarshalKey(prefix+".replicas", &gormConfig.Replication.Replicas)
+	}
+	return gormConfig
+}
+
+// readDuration reads a duration such as "500ms" or "15s". Bare numbers
+// keep the unit the setting had before, e.g. seconds for health intervals.
+func readDuration(accessor *fxconfig.Accessor, key string, unit time.Duration) (time.Duration, error) {
+	var number float64
+	switch value := accessor.Get(key).(type) {
+	case nil:
+		return 0, nil
+	case time.Duration:
+		return value, nil
+	case string:
+		if value == "" {
+			return 0, nil
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			return duration, nil
+		}
+		number = n
+	case int:
+		number = float64(value)
+	case int64:
+		number = float64(value)
+	case float64:
+		number = value
+	default:
+		return 0, fmt.Errorf("invalid %s: %v is not a duration", key, value)
+	}
+	return time.Duration(number * float64(unit)), nil
 }
 
 // SetDefaults sets default values for unconfigured settings
@@ -60,6 +161,27 @@ func (gc *GormConfig) SetDefaults() {
 	if gc.Pool.ConnMaxIdleTime == 0 {
 		gc.Pool.ConnMaxIdleTime = time.Minute * 10
 	}
+	if gc.Replication.Policy == "" {
+		gc.Replication.Policy = ReplicaPolicyRoundRobin
+	}
+	if gc.Replication.HealthCheckInterval == 0 {
+		gc.Replication.HealthCheckInterval = 10 * time.Second
+	}
+	if gc.Retry.MaxAttempts == 0 {
+		gc.Retry.MaxAttempts = 10
+	}
+	if gc.Retry.InitialInterval == 0 {
+		gc.Retry.InitialInterval = 500 * time.Millisecond
+	}
+	if gc.Retry.MaxInterval == 0 {
+		gc.Retry.MaxInterval = 10 * time.Second
+	}
+	if gc.Retry.Multiplier == 0 {
+		gc.Retry.Multiplier = 2
+	}
+	if gc.Retry.HealthCheckInterval == 0 {
+		gc.Retry.HealthCheckInterval = 15 * time.Second
+	}
 }
 
 // Validate validates the configuration
@@ -68,8 +190,37 @@ func (gc *GormConfig) Validate() error {
 		gc.Database.Type = PostgreSQL // Default to PostgreSQL
 	}
 
+	if gc.paramsErr != nil {
+		return fmt.Errorf("invalid params: %w", gc.paramsErr)
+	}
+	if gc.durationErr != nil {
+		return gc.durationErr
+	}
+	// A negative interval would make the tickers and backoff panic
+	for _, interval := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"connect_timeout", gc.Database.ConnectTimeout},
+		{"pool.conn_max_lifetime", gc.Pool.ConnMaxLifetime},
+		{"pool.conn_max_idle_time", gc.Pool.ConnMaxIdleTime},
+		{"log.slow_threshold", gc.Log.SlowThreshold},
+		{"replica_health_interval", gc.Replication.HealthCheckInterval},
+		{"retry.initial_interval", gc.Retry.InitialInterval},
+		{"retry.max_interval", gc.Retry.MaxInterval},
+		{"retry.health_interval", gc.Retry.HealthCheckInterval},
+		{"tx.retry_interval", gc.Tx.RetryInterval},
+	} {
+		if interval.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", interval.name, interval.value)
+		}
+	}
+
 	switch gc.Database.Type {
 	case PostgreSQL, MySQL, SQLServer:
+		if gc.Database.DSN != "" {
+			break
+		}
 		if gc.Database.Host == "" {
 			return fmt.Errorf("host is required for %s database", gc.Database.Type)
 		}
@@ -80,12 +231,25 @@ func (gc *GormConfig) Validate() error {
 			return fmt.Errorf("dbname is required for %s database", gc.Database.Type)
 		}
 	case SQLite:
-		if gc.Database.File == "" {
+		if gc.Database.File == "" && gc.Database.DSN == "" {
 			return fmt.Errorf("file path is required for SQLite database")
 		}
 	default:
 		return fmt.Errorf("unsupported database type: %s", gc.Database.Type)
 	}
 
+	if _, err := parseIsolation(gc.Tx.Isolation); err != nil {
+		return err
+	}
+
+	if gc.replicasErr != nil {
+		return fmt.Errorf("invalid replicas: %w", gc.replicasErr)
+	}
+	switch gc.Replication.Policy {
+	case "", ReplicaPolicyRoundRobin, ReplicaPolicyRandom:
+	default:
+		return fmt.Errorf("unsupported replica policy: %s", gc.Replication.Policy)
+	}
+
 	return nil
 }
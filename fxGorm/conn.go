@@ -0,0 +1,237 @@
+package fxgorm
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// newManagedDB returns the database handed out by the manager. It is built
+// once and runs every statement on the connection Connect opened, so it
+// can be injected before the app starts; until then its queries,
+// transactions and migrations fail with ErrNotConnected.
+func newManagedDB(dm *DatabaseManager) *gorm.DB {
+	conn := &managedConn{dm: dm, disconnected: newDisconnectedDB()}
+	db, err := gorm.Open(managedDialector{conn: conn, pool: &managedPool{conn: conn}}, &gorm.Config{
+		Logger:               &connectionLogger{Interface: logger.Discard},
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		// Initialize cannot fail
+		panic(err)
+	}
+	return db
+}
+
+// connectionLogger stands in for the logger of the connection, which logs
+// the statements. LogMode, e.g. from db.Debug(), applies to that logger.
+type connectionLogger struct {
+	logger.Interface
+	level *logger.LogLevel
+}
+
+// LogMode implements logger.Interface
+func (l *connectionLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &connectionLogger{Interface: l.Interface, level: &level}
+}
+
+// managedConn resolves the connection of the manager
+type managedConn struct {
+	dm           *DatabaseManager
+	disconnected *gorm.DB
+}
+
+// current returns the connection opened by Connect, or the placeholder
+// failing with ErrNotConnected before
+func (c *managedConn) current() *gorm.DB {
+	if conn := c.dm.conn.Load(); conn != nil {
+		return conn
+	}
+	return c.disconnected
+}
+
+// managedDialector forwards to the dialector of the current connection
+type managedDialector struct {
+	conn *managedConn
+	pool *managedPool
+}
+
+func (d managedDialector) dialector() gorm.Dialector {
+	return d.conn.current().Dialector
+}
+
+func (d managedDialector) Name() string {
+	return d.dialector().Name()
+}
+
+// Initialize replaces the statement callbacks with ones running the
+// statement on the connection, which has the callbacks of its driver
+func (d managedDialector) Initialize(db *gorm.DB) error {
+	db.ConnPool = d.pool
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Register("gorm:create", d.forward(func(tx *gorm.DB) { tx.Callback().Create().Execute(tx) })),
+		callbacks.Query().Register("gorm:query", d.forward(func(tx *gorm.DB) { tx.Callback().Query().Execute(tx) })),
+		callbacks.Update().Register("gorm:update", d.forward(func(tx *gorm.DB) { tx.Callback().Update().Execute(tx) })),
+		callbacks.Delete().Register("gorm:delete", d.forward(func(tx *gorm.DB) { tx.Callback().Delete().Execute(tx) })),
+		callbacks.Row().Register("gorm:row", d.forward(func(tx *gorm.DB) { tx.Callback().Row().Execute(tx) })),
+		callbacks.Raw().Register("gorm:raw", d.forward(func(tx *gorm.DB) { tx.Callback().Raw().Execute(tx) })),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forward returns a callback running the statement of db with execute on
+// the connection, keeping the session settings of db
+func (d managedDialector) forward(execute func(tx *gorm.DB)) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		conn := d.conn.current()
+
+		// Session options only differ from the defaults when they are set
+		config := *conn.Config
+		config.SkipDefaultTransaction = config.SkipDefaultTransaction || db.SkipDefaultTransaction
+		config.FullSaveAssociations = config.FullSaveAssociations || db.FullSaveAssociations
+		config.AllowGlobalUpdate = config.AllowGlobalUpdate || db.AllowGlobalUpdate
+		config.PropagateUnscoped = config.PropagateUnscoped || db.PropagateUnscoped
+		config.DisableNestedTransaction = config.DisableNestedTransaction || db.DisableNestedTransaction
+		config.DryRun = config.DryRun || db.DryRun
+		config.QueryFields = config.QueryFields || db.QueryFields
+		if db.CreateBatchSize > 0 {
+			config.CreateBatchSize = db.CreateBatchSize
+		}
+		if db.NowFunc != nil {
+			config.NowFunc = db.NowFunc
+		}
+		switch l := db.Logger.(type) {
+		case *connectionLogger:
+			if l.level != nil {
+				config.Logger = config.Logger.LogMode(*l.level)
+			}
+		default:
+			config.Logger = db.Logger
+		}
+
+		stmt := db.Statement
+		tx := &gorm.DB{Config: &config, Statement: stmt, Error: db.Error}
+		pool := stmt.ConnPool
+		// Transactions and dedicated connections keep their pool
+		if pool == gorm.ConnPool(d.pool) {
+			stmt.ConnPool = conn.Statement.ConnPool
+		}
+		stmt.DB = tx
+		defer func() {
+			stmt.DB = db
+			stmt.ConnPool = pool
+		}()
+
+		execute(tx)
+		db.Error = tx.Error
+		db.RowsAffected = tx.RowsAffected
+	}
+}
+
+func (d managedDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return d.dialector().Migrator(db)
+}
+
+func (d managedDialector) DataTypeOf(field *schema.Field) string {
+	return d.dialector().DataTypeOf(field)
+}
+
+func (d managedDialector) DefaultValueOf(field *schema.Field) clause.Expression {
+	return d.dialector().DefaultValueOf(field)
+}
+
+func (d managedDialector) BindVarTo(writer clause.Writer, stmt *gorm.Statement, v interface{}) {
+	d.dialector().BindVarTo(writer, stmt, v)
+}
+
+func (d managedDialector) QuoteTo(writer clause.Writer, str string) {
+	d.dialector().QuoteTo(writer, str)
+}
+
+func (d managedDialector) Explain(sql string, vars ...interface{}) string {
+	return d.dialector().Explain(sql, vars...)
+}
+
+// SavePoint implements gorm.SavePointerDialectorInterface for nested
+// transactions
+func (d managedDialector) SavePoint(tx *gorm.DB, name string) error {
+	savePointer, ok := d.dialector().(gorm.SavePointerDialectorInterface)
+	if !ok {
+		return gorm.ErrUnsupportedDriver
+	}
+	return savePointer.SavePoint(tx, name)
+}
+
+// RollbackTo implements gorm.SavePointerDialectorInterface
+func (d managedDialector) RollbackTo(tx *gorm.DB, name string) error {
+	savePointer, ok := d.dialector().(gorm.SavePointerDialectorInterface)
+	if !ok {
+		return gorm.ErrUnsupportedDriver
+	}
+	return savePointer.RollbackTo(tx, name)
+}
+
+// Translate implements gorm.ErrorTranslator
+func (d managedDialector) Translate(err error) error {
+	if translator, ok := d.dialector().(gorm.ErrorTranslator); ok {
+		return translator.Translate(err)
+	}
+	return err
+}
+
+// managedPool forwards to the connection pool of the current connection
+type managedPool struct {
+	conn *managedConn
+}
+
+func (p *managedPool) pool() gorm.ConnPool {
+	return p.conn.current().ConnPool
+}
+
+func (p *managedPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.pool().PrepareContext(ctx, query)
+}
+
+func (p *managedPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.pool().ExecContext(ctx, query, args...)
+}
+
+func (p *managedPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.pool().QueryContext(ctx, query, args...)
+}
+
+func (p *managedPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.pool().QueryRowContext(ctx, query, args...)
+}
+
+// BeginTx implements gorm.ConnPoolBeginner, starting the transaction on
+// the connection
+func (p *managedPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	switch beginner := p.pool().(type) {
+	case gorm.TxBeginner:
+		tx, err := beginner.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return tx, nil
+	case gorm.ConnPoolBeginner:
+		return beginner.BeginTx(ctx, opts)
+	default:
+		return nil, gorm.ErrInvalidTransaction
+	}
+}
+
+// GetDBConn implements gorm.GetDBConnector, so db.DB() returns the pool
+// of the connection
+func (p *managedPool) GetDBConn() (*sql.DB, error) {
+	return p.conn.current().DB()
+}
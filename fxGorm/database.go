@@ -1,98 +1,151 @@
 package fxgorm
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"strings"
+	"time"
 
+	"github.com/UTOL-s/module/fxGorm/dsn"
+	"go.uber.org/zap"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 // buildDSN constructs the database connection string based on the database type
 func (gc *GormConfig) buildDSN() (string, error) {
+	if gc.Database.DSN != "" {
+		return gc.Database.DSN, nil
+	}
+
 	switch gc.Database.Type {
 	case PostgreSQL:
-		return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
-			gc.Database.Host, gc.Database.User, gc.Database.Password,
-			gc.Database.DBName, gc.Database.Port, gc.Database.SSLMode), nil
+		return dsn.Postgres(gc.Database.dsnOptions()), nil
 	case MySQL:
-		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", gc.Database.User, gc.Database.Password,
-			gc.Database.Host, gc.Database.Port, gc.Database.DBName)
-		if gc.Database.Charset != "" {
-			dsn += "?charset=" + gc.Database.Charset
-		}
-		if gc.Database.ParseTime {
-			if gc.Database.Charset != "" {
-				dsn += "&parseTime=true"
-			} else {
-				dsn += "?parseTime=true"
-			}
-		}
-		if gc.Database.Loc != "" {
-			if strings.Contains(dsn, "?") {
-				dsn += "&loc=" + gc.Database.Loc
-			} else {
-				dsn += "?loc=" + gc.Database.Loc
-			}
-		}
-		return dsn, nil
+		return dsn.MySQL(gc.Database.dsnOptions())
 	case SQLite:
 		if gc.Database.File == "" {
 			return "", fmt.Errorf("SQLite database file path is required")
 		}
-		return gc.Database.File, nil
+		return dsn.SQLite(gc.Database.File, gc.Database.Params), nil
 	case SQLServer:
-		return fmt.Sprintf("sqlserver://%s:%s@%s:%d?database=%s",
-			gc.Database.User, gc.Database.Password,
-			gc.Database.Host, gc.Database.Port, gc.Database.DBName), nil
+		return dsn.SQLServer(gc.Database.dsnOptions()), nil
 	default:
 		return "", fmt.Errorf("unsupported database type: %s", gc.Database.Type)
 	}
 }
 
-// openDatabase opens a database connection based on the configuration
-func (gc *GormConfig) openDatabase() (*gorm.DB, error) {
+// dsnOptions returns the connection settings for the DSN builder
+func (dc DatabaseConfig) dsnOptions() dsn.Options {
+	return dsn.Options{
+		Host:            dc.Host,
+		Port:            dc.Port,
+		User:            dc.User,
+		Password:        dc.Password,
+		DBName:          dc.DBName,
+		SSLMode:         dc.SSLMode,
+		SSLRootCert:     dc.SSLRootCert,
+		SSLCert:         dc.SSLCert,
+		SSLKey:          dc.SSLKey,
+		ConnectTimeout:  dc.ConnectTimeout,
+		ApplicationName: dc.ApplicationName,
+		SearchPath:      dc.SearchPath,
+		Charset:         dc.Charset,
+		ParseTime:       dc.ParseTime,
+		Loc:             dc.Loc,
+		Params:          dc.Params,
+	}
+}
+
+// dialector returns the GORM dialector of the configured database.
+// Replicas skip queries that need the server to be reachable.
+func (gc *GormConfig) dialector(replica bool) (gorm.Dialector, error) {
 	dsn, err := gc.buildDSN()
 	if err != nil {
 		return nil, err
 	}
 
-	var dialector gorm.Dialector
-
 	switch gc.Database.Type {
 	case PostgreSQL:
-		dialector = postgres.Open(dsn)
+		return postgres.Open(dsn), nil
 	case MySQL:
-		dialector = mysql.Open(dsn)
+		return mysql.New(mysql.Config{DSN: dsn, SkipInitializeWithVersion: replica}), nil
 	case SQLite:
-		dialector = sqlite.Open(dsn)
+		return sqlite.Open(dsn), nil
 	case SQLServer:
-		dialector = sqlserver.Open(dsn)
+		return sqlserver.Open(dsn), nil
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", gc.Database.Type)
 	}
+}
+
+// openDatabase opens a database connection based on the configuration
+func (gc *GormConfig) openDatabase(log *zap.Logger) (*gorm.DB, error) {
+	dialector, err := gc.dialector(false)
+	if err != nil {
+		return nil, err
+	}
 
 	return gorm.Open(dialector, &gorm.Config{
-		Logger: logger.New(
-			log.New(log.Writer(), "\r\n", log.LstdFlags),
-			logger.Config{
-				SlowThreshold:             gc.Log.SlowThreshold,
-				LogLevel:                  gc.Log.Level,
-				IgnoreRecordNotFoundError: gc.Log.IgnoreRecordNotFoundError,
-				Colorful:                  gc.Log.Colorful,
-			},
-		),
+		Logger: NewZapLogger(log, gc.Log),
 		DryRun: gc.Debug,
+		// Connect pings with the caller's context instead
+		DisableAutomaticPing: true,
 	})
 }
 
-// Connect establishes a database connection with validation
-func (dm *DatabaseManager) Connect() error {
+// openDatabaseContext opens the database, giving up when ctx is done.
+// Dialectors may query the server while opening without a context.
+func (gc *GormConfig) openDatabaseContext(ctx context.Context, log *zap.Logger) (*gorm.DB, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		db  *gorm.DB
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		db, err := gc.openDatabase(log)
+		done <- result{db: db, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.db, r.err
+	case <-ctx.Done():
+		// Close the connection once the abandoned open completes
+		go func() {
+			if r := <-done; r.err == nil {
+				_ = closeDatabase(r.db)
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// closeDatabase closes the connection pool of db
+func closeDatabase(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// Connect establishes a database connection with validation, retrying
+// with backoff while the database is unreachable. It returns when ctx is
+// done, e.g. when the fx start timeout expires.
+func (dm *DatabaseManager) Connect(ctx context.Context) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if dm.connected {
+		return nil
+	}
+
 	// Validate configuration
 	if err := dm.config.Validate(); err != nil {
 		return fmt.Errorf("configuration validation failed: %w", err)
@@ -101,44 +154,190 @@ func (dm *DatabaseManager) Connect() error {
 	// Set defaults
 	dm.config.SetDefaults()
 
+	host := replicaHost(dm.config.Database)
+	retry := dm.config.Retry
+	var db *gorm.DB
+	var replicas *replicaSet
+	for attempt := 1; ; attempt++ {
+		dm.stats.connectAttempts.Add(1)
+		var err error
+		db, replicas, err = dm.dial(ctx)
+		if err == nil {
+			break
+		}
+		dm.stats.fail(err)
+		if ctx.Err() != nil {
+			return err
+		}
+		if attempt >= retry.MaxAttempts {
+			if attempt == 1 {
+				return err
+			}
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		wait := retry.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return fmt.Errorf("giving up after %d attempts before the start timeout: %w", attempt, err)
+		}
+		dm.logger.Warn("database connection attempt failed",
+			zap.String("host", host),
+			zap.Int("attempt", attempt),
+			zap.Duration("retry_in", wait),
+			zap.Error(err))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+	}
+
+	// Unreachable replicas do not fail startup, reads use the primary
+	if replicas != nil {
+		replicas.check(ctx)
+		replicas.start(dm.config.Replication.HealthCheckInterval)
+	}
+
+	// The instance handed out by GetDB runs its statements on db from now on
+	dm.conn.Store(db)
+	dm.replicas = replicas
+	dm.stats.healthy.Store(true)
+	if sqlDB, err := db.DB(); err == nil {
+		dm.monitor = &connectionMonitor{
+			logger: dm.logger.With(zap.String("host", host)),
+			ping:   sqlDB.PingContext,
+			retry:  retry,
+			stats:  &dm.stats,
+		}
+		dm.monitor.start()
+	}
+	dm.connected = true
+	return nil
+}
+
+// dial opens the database and its replicas and pings the primary
+func (dm *DatabaseManager) dial(ctx context.Context) (*gorm.DB, *replicaSet, error) {
 	// Open database connection
-	db, err := dm.config.openDatabase()
+	db, err := dm.config.openDatabaseContext(ctx, dm.logger)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return nil, nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Configure connection pool
 	if err := dm.config.configureConnectionPool(db); err != nil {
-		return fmt.Errorf("failed to configure connection pool: %w", err)
+		_ = closeDatabase(db)
+		return nil, nil, fmt.Errorf("failed to configure connection pool: %w", err)
+	}
+
+	// Route reads to the replicas, each with the pool settings of the primary
+	var replicas *replicaSet
+	if len(dm.config.Replication.Replicas) > 0 {
+		replicas, err = dm.config.openReplicas(db)
+		if err != nil {
+			_ = closeDatabase(db)
+			return nil, nil, fmt.Errorf("failed to open replicas: %w", err)
+		}
+		replicas.resolver.
+			SetMaxIdleConns(dm.config.Pool.MaxIdleConns).
+			SetMaxOpenConns(dm.config.Pool.MaxOpenConns).
+			SetConnMaxLifetime(dm.config.Pool.ConnMaxLifetime).
+			SetConnMaxIdleTime(dm.config.Pool.ConnMaxIdleTime)
+		if len(dm.primary) > 0 {
+			replicas.usePrimary(dm.primary...)
+		}
 	}
 
 	// Test the connection
 	sqlDB, err := db.DB()
 	if err != nil {
-		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+		return nil, nil, fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		_ = sqlDB.Close()
+		if replicas != nil {
+			_ = replicas.close()
+		}
+		return nil, nil, fmt.Errorf("failed to ping database: %w", err)
 	}
+	return db, replicas, nil
+}
+
+// ConnectionStats returns the connection attempts, losses and reconnects
+// of the database
+func (dm *DatabaseManager) ConnectionStats() ConnectionStats {
+	return dm.stats.snapshot()
+}
 
-	if err := sqlDB.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+// UsePrimary reads the given models or tables from the primary instead
+// of the replicas, e.g. when they must read their own writes
+func (dm *DatabaseManager) UsePrimary(tables ...interface{}) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.primary = append(dm.primary, tables...)
+	if dm.replicas != nil {
+		dm.replicas.usePrimary(tables...)
 	}
+}
 
-	dm.db = db
-	return nil
+// ReplicaStatus returns the health of each read replica as of the last check
+func (dm *DatabaseManager) ReplicaStatus() []ReplicaStatus {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	if dm.replicas == nil {
+		return nil
+	}
+	return dm.replicas.status()
 }
 
-// GetDB returns the database instance
+// GetDB returns the database instance, usable once Connect succeeded
 func (dm *DatabaseManager) GetDB() *gorm.DB {
 	return dm.db
 }
 
+// Connected reports whether the database is connected
+func (dm *DatabaseManager) Connected() bool {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	return dm.connected
+}
+
+// Ping checks that the database is connected and reachable, e.g. for
+// health checks
+func (dm *DatabaseManager) Ping(ctx context.Context) error {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	if !dm.connected {
+		return ErrNotConnected
+	}
+	sqlDB, err := dm.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
 // Close closes the database connection
 func (dm *DatabaseManager) Close() error {
-	if dm.db != nil {
-		sqlDB, err := dm.db.DB()
-		if err != nil {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if !dm.connected {
+		return nil
+	}
+	dm.connected = false
+	if dm.monitor != nil {
+		dm.monitor.close()
+		dm.monitor = nil
+	}
+	dm.stats.healthy.Store(false)
+	if dm.replicas != nil {
+		if err := dm.replicas.close(); err != nil {
 			return err
 		}
-		return sqlDB.Close()
+		dm.replicas = nil
+	}
+	if err := closeDatabase(dm.conn.Load()); err != nil {
+		return fmt.Errorf("failed to close database: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,91 @@
+package fxgorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/migrator"
+	"gorm.io/gorm/schema"
+)
+
+// ErrNotConnected is returned by queries run before the database connects,
+// e.g. from constructors before the app starts
+var ErrNotConnected = errors.New("database not connected")
+
+// newDisconnectedDB returns the connection the managed database uses until
+// Connect opens one. Every query, transaction and migration fails with
+// ErrNotConnected instead of panicking on a zero gorm.DB.
+func newDisconnectedDB() *gorm.DB {
+	pool := sql.OpenDB(disconnectedConnector{})
+	db, err := gorm.Open(disconnectedDialector{pool: pool}, &gorm.Config{
+		Logger:               logger.Discard,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		// Initialize cannot fail
+		panic(err)
+	}
+	return db
+}
+
+// disconnectedConnector fails every connection of the placeholder pool
+type disconnectedConnector struct{}
+
+func (disconnectedConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, ErrNotConnected
+}
+
+func (disconnectedConnector) Driver() driver.Driver {
+	return disconnectedDriver{}
+}
+
+type disconnectedDriver struct{}
+
+func (disconnectedDriver) Open(string) (driver.Conn, error) {
+	return nil, ErrNotConnected
+}
+
+// disconnectedDialector builds statements for the placeholder pool
+type disconnectedDialector struct {
+	pool *sql.DB
+}
+
+func (disconnectedDialector) Name() string {
+	return "disconnected"
+}
+
+func (d disconnectedDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	db.ConnPool = d.pool
+	return nil
+}
+
+func (d disconnectedDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return migrator.Migrator{Config: migrator.Config{DB: db, Dialector: d}}
+}
+
+func (disconnectedDialector) DataTypeOf(*schema.Field) string {
+	return ""
+}
+
+func (disconnectedDialector) DefaultValueOf(*schema.Field) clause.Expression {
+	return clause.Expr{SQL: "DEFAULT"}
+}
+
+func (disconnectedDialector) BindVarTo(writer clause.Writer, _ *gorm.Statement, _ interface{}) {
+	writer.WriteByte('?')
+}
+
+func (disconnectedDialector) QuoteTo(writer clause.Writer, str string) {
+	writer.WriteString(str)
+}
+
+func (disconnectedDialector) Explain(sql string, vars ...interface{}) string {
+	return logger.ExplainSQL(sql, nil, `'`, vars...)
+}
@@ -0,0 +1,303 @@
+// Package dsn builds the connection strings of the supported databases,
+// escaping every value the way its driver expects.
+package dsn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Options describes a database connection. Empty values are left out of
+// the connection string so that the driver defaults apply.
+type Options struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	DBName   string
+
+	// SSLMode is the PostgreSQL sslmode: disable, require, verify-ca or
+	// verify-full. MySQL and SQL Server map it to their own settings.
+	SSLMode string
+	// SSLRootCert is the CA file verifying the server
+	SSLRootCert string
+	// SSLCert and SSLKey are the client certificate files
+	SSLCert string
+	SSLKey  string
+
+	ConnectTimeout  time.Duration
+	ApplicationName string
+	// SearchPath is the PostgreSQL schema search path
+	SearchPath string
+
+	// Charset, ParseTime and Loc are MySQL settings
+	Charset   string
+	ParseTime bool
+	Loc       string
+
+	// Params are passed to the driver as is and take precedence over the
+	// settings above
+	Params map[string]string
+}
+
+// Postgres returns a keyword/value connection string, quoting values
+// with spaces, quotes or backslashes
+func Postgres(o Options) string {
+	var b strings.Builder
+	add := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key + "=" + quotePostgres(value))
+	}
+
+	add("host", o.Host)
+	add("user", o.User)
+	add("password", o.Password)
+	add("dbname", o.DBName)
+	if o.Port != 0 {
+		add("port", strconv.Itoa(o.Port))
+	}
+	add("sslmode", o.SSLMode)
+	add("sslrootcert", o.SSLRootCert)
+	add("sslcert", o.SSLCert)
+	add("sslkey", o.SSLKey)
+	if o.ConnectTimeout > 0 {
+		add("connect_timeout", strconv.Itoa(seconds(o.ConnectTimeout)))
+	}
+	add("search_path", o.SearchPath)
+	add("application_name", o.ApplicationName)
+	for _, key := range slices.Sorted(maps.Keys(o.Params)) {
+		add(key, o.Params[key])
+	}
+	return b.String()
+}
+
+// quotePostgres quotes a keyword/value connection string value when needed
+func quotePostgres(value string) string {
+	if !strings.ContainsAny(value, " \t\n\r\f\v'\\") {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// MySQL returns a go-sql-driver/mysql connection string. The sslmode maps
+// to the tls parameter, and TLS files register a TLS config with the driver
+// unless sslmode is disable.
+func MySQL(o Options) (string, error) {
+	params := url.Values{}
+	if o.Charset != "" {
+		params.Set("charset", o.Charset)
+	}
+	if o.ParseTime {
+		params.Set("parseTime", "true")
+	}
+	if o.Loc != "" {
+		params.Set("loc", o.Loc)
+	}
+	if o.ConnectTimeout > 0 {
+		params.Set("timeout", o.ConnectTimeout.String())
+	}
+	if o.ApplicationName != "" {
+		params.Set("connectionAttributes", "program_name:"+o.ApplicationName)
+	}
+
+	if o.SSLMode != "disable" && (o.SSLRootCert != "" || o.SSLCert != "") {
+		config, err := tlsConfig(o)
+		if err != nil {
+			return "", err
+		}
+		name := "fxgorm-" + hostPort(o.Host, o.Port)
+		if err := mysql.RegisterTLSConfig(name, config); err != nil {
+			return "", fmt.Errorf("failed to register TLS config: %w", err)
+		}
+		params.Set("tls", name)
+	} else {
+		switch o.SSLMode {
+		case "":
+		case "disable":
+			params.Set("tls", "false")
+		case "require":
+			params.Set("tls", "skip-verify")
+		case "verify-ca", "verify-full":
+			params.Set("tls", "true")
+		default:
+			params.Set("tls", o.SSLMode)
+		}
+	}
+	for key, value := range o.Params {
+		params.Set(key, value)
+	}
+
+	// The driver does not format connection attributes, they are appended
+	attributes := params.Get("connectionAttributes")
+	params.Del("connectionAttributes")
+
+	config := mysql.NewConfig()
+	config.User = o.User
+	config.Passwd = o.Password
+	config.Net = "tcp"
+	config.Addr = hostPort(o.Host, o.Port)
+	config.DBName = o.DBName
+	dsn := config.FormatDSN()
+	if len(params) > 0 {
+		// Parsed back so that the driver validates and normalizes the params
+		parsed, err := mysql.ParseDSN(dsn + "?" + params.Encode())
+		if err != nil {
+			return "", fmt.Errorf("invalid MySQL params: %w", err)
+		}
+		dsn = parsed.FormatDSN()
+	}
+	if attributes != "" {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		dsn += separator + "connectionAttributes=" + url.QueryEscape(attributes)
+	}
+	return dsn, nil
+}
+
+// SQLServer returns a sqlserver:// URL. The sslmode maps to encrypt and the
+// root certificate to certificate; client certificates are not supported.
+func SQLServer(o Options) string {
+	query := url.Values{}
+	if o.DBName != "" {
+		query.Set("database", o.DBName)
+	}
+	switch o.SSLMode {
+	case "":
+	case "require":
+		query.Set("encrypt", "true")
+		query.Set("TrustServerCertificate", "true")
+	case "verify-ca", "verify-full":
+		query.Set("encrypt", "true")
+	default:
+		query.Set("encrypt", o.SSLMode)
+	}
+	if o.SSLRootCert != "" {
+		query.Set("certificate", o.SSLRootCert)
+	}
+	if o.ConnectTimeout > 0 {
+		query.Set("connection timeout", strconv.Itoa(seconds(o.ConnectTimeout)))
+	}
+	if o.ApplicationName != "" {
+		query.Set("app name", o.ApplicationName)
+	}
+	for key, value := range o.Params {
+		query.Set(key, value)
+	}
+
+	u := url.URL{
+		Scheme:   "sqlserver",
+		Host:     hostPort(o.Host, o.Port),
+		RawQuery: query.Encode(),
+	}
+	if o.Password != "" {
+		u.User = url.UserPassword(o.User, o.Password)
+	} else if o.User != "" {
+		u.User = url.User(o.User)
+	}
+	return u.String()
+}
+
+// SQLite returns the database file with the params as a query string,
+// e.g. test.db?_busy_timeout=5000
+func SQLite(file string, params map[string]string) string {
+	if len(params) == 0 {
+		return file
+	}
+	query := url.Values{}
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	return file + "?" + query.Encode()
+}
+
+// tlsConfig loads the TLS files of o. require skips the verification of
+// the server, verify-ca verifies its certificate but not the host name.
+func tlsConfig(o Options) (*tls.Config, error) {
+	config := &tls.Config{ServerName: o.Host}
+	if o.SSLRootCert != "" {
+		pem, err := os.ReadFile(o.SSLRootCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sslrootcert: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in sslrootcert %s", o.SSLRootCert)
+		}
+	}
+	if o.SSLCert != "" {
+		cert, err := tls.LoadX509KeyPair(o.SSLCert, o.SSLKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sslcert: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	switch o.SSLMode {
+	case "require":
+		config.InsecureSkipVerify = true
+	case "verify-ca":
+		// The default verification checks the host name, so the chain is
+		// verified in VerifyPeerCertificate instead
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = verifyChain(config.RootCAs)
+	}
+	return config, nil
+}
+
+// verifyChain returns a VerifyPeerCertificate verifying the certificate of
+// the server against roots, or the system roots when nil, regardless of
+// its host name
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("the server sent no certificate")
+		}
+		intermediates := x509.NewCertPool()
+		var leaf *x509.Certificate
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("failed to parse server certificate: %w", err)
+			}
+			if i == 0 {
+				leaf = cert
+			} else {
+				intermediates.AddCert(cert)
+			}
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+			return fmt.Errorf("failed to verify server certificate: %w", err)
+		}
+		return nil
+	}
+}
+
+func hostPort(host string, port int) string {
+	if port == 0 {
+		return host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// seconds rounds d up to whole seconds, the unit of connect timeouts
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
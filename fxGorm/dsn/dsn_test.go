@@ -0,0 +1,244 @@
+package dsn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// TestPostgres tests keyword/value quoting and the optional settings
+func TestPostgres(t *testing.T) {
+	got := Postgres(Options{
+		Host:            "localhost",
+		Port:            5432,
+		User:            "postgres",
+		Password:        `p@ss word's\`,
+		DBName:          "app",
+		SSLMode:         "verify-full",
+		SSLRootCert:     "/etc/ssl/ca.pem",
+		ConnectTimeout:  1500 * time.Millisecond,
+		ApplicationName: "api",
+		SearchPath:      "tenant,public",
+		Params:          map[string]string{"statement_timeout": "5000", "options": "-c geqo=off"},
+	})
+	want := `host=localhost user=postgres password='p@ss word\'s\\' dbname=app port=5432 sslmode=verify-full ` +
+		`sslrootcert=/etc/ssl/ca.pem connect_timeout=2 search_path=tenant,public application_name=api ` +
+		`options='-c geqo=off' statement_timeout=5000`
+	if got != want {
+		t.Errorf("Postgres() =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := Postgres(Options{Host: "db", User: "app", DBName: "app"}); got != "host=db user=app dbname=app" {
+		t.Errorf("empty settings should be left out, got %q", got)
+	}
+}
+
+// TestMySQL tests that the driver reads back every setting
+func TestMySQL(t *testing.T) {
+	got, err := MySQL(Options{
+		Host:            "db.internal",
+		Port:            3306,
+		User:            "root",
+		Password:        "p@ss:w/rd?",
+		DBName:          "app",
+		SSLMode:         "require",
+		ConnectTimeout:  5 * time.Second,
+		ApplicationName: "api",
+		Charset:         "utf8mb4",
+		ParseTime:       true,
+		Loc:             "Europe/Paris",
+		Params:          map[string]string{"multiStatements": "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := mysql.ParseDSN(got)
+	if err != nil {
+		t.Fatalf("ParseDSN(%q) failed: %v", got, err)
+	}
+	if config.Passwd != "p@ss:w/rd?" || config.User != "root" || config.Addr != "db.internal:3306" || config.DBName != "app" {
+		t.Errorf("credentials not preserved in %q", got)
+	}
+	if !config.ParseTime || config.Loc.String() != "Europe/Paris" || config.Timeout != 5*time.Second ||
+		!config.MultiStatements || config.TLSConfig != "skip-verify" || config.ConnectionAttributes != "program_name:api" {
+		t.Errorf("settings not preserved in %q", got)
+	}
+	if !strings.Contains(got, "charset=utf8mb4") {
+		t.Errorf("charset missing from %q", got)
+	}
+
+	if _, err := MySQL(Options{Host: "db", Loc: "Nowhere/Invalid"}); err == nil {
+		t.Error("an unknown location should fail")
+	}
+}
+
+// TestSQLServer tests URL escaping of the credentials and params
+func TestSQLServer(t *testing.T) {
+	got := SQLServer(Options{
+		Host:            "db",
+		Port:            1433,
+		User:            "sa",
+		Password:        "p@ss word/#",
+		DBName:          "app",
+		SSLMode:         "require",
+		ConnectTimeout:  10 * time.Second,
+		ApplicationName: "api",
+		Params:          map[string]string{"log": "1"},
+	})
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, _ := u.User.Password()
+	if u.Scheme != "sqlserver" || u.Host != "db:1433" || u.User.Username() != "sa" || password != "p@ss word/#" {
+		t.Errorf("credentials not preserved in %q", got)
+	}
+	query := u.Query()
+	if query.Get("database") != "app" || query.Get("encrypt") != "true" || query.Get("TrustServerCertificate") != "true" ||
+		query.Get("connection timeout") != "10" || query.Get("app name") != "api" || query.Get("log") != "1" {
+		t.Errorf("params not preserved in %q", got)
+	}
+}
+
+// TestSQLite tests the params query string
+func TestSQLite(t *testing.T) {
+	if got := SQLite("test.db", nil); got != "test.db" {
+		t.Errorf("SQLite() = %q", got)
+	}
+	if got := SQLite("test.db", map[string]string{"_busy_timeout": "5000", "_fk": "1"}); got != "test.db?_busy_timeout=5000&_fk=1" {
+		t.Errorf("SQLite() = %q", got)
+	}
+}
+
+// TestMySQLTLSFiles tests registering a TLS config from certificate files
+func TestMySQLTLSFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir)
+
+	got, err := MySQL(Options{Host: "db", Port: 3306, User: "root", SSLRootCert: certFile, SSLCert: certFile, SSLKey: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := mysql.ParseDSN(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.TLSConfig != "fxgorm-db:3306" || config.TLS == nil || config.TLS.RootCAs == nil || len(config.TLS.Certificates) != 1 {
+		t.Errorf("the TLS config should be registered, got %q", got)
+	}
+
+	got, err = MySQL(Options{Host: "db", Port: 3306, SSLMode: "disable", SSLRootCert: certFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config, err := mysql.ParseDSN(got); err != nil || config.TLSConfig != "false" {
+		t.Errorf("sslmode disable should turn TLS off despite the files, got %q", got)
+	}
+
+	if _, err := MySQL(Options{Host: "db", SSLRootCert: filepath.Join(dir, "missing.pem")}); err == nil {
+		t.Error("a missing root certificate should fail")
+	}
+	if _, err := MySQL(Options{Host: "db", SSLRootCert: keyFile}); err == nil {
+		t.Error("a root certificate file without certificates should fail")
+	}
+}
+
+// writeCertificate writes a self-signed certificate and its key
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "db"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// TestTLSConfigSSLMode tests how the sslmode verifies the server
+func TestTLSConfigSSLMode(t *testing.T) {
+	certFile, _ := writeCertificate(t, t.TempDir())
+	otherFile, _ := writeCertificate(t, t.TempDir())
+	server, other := readCertificate(t, certFile), readCertificate(t, otherFile)
+
+	config, err := tlsConfig(Options{Host: "db", SSLMode: "verify-full", SSLRootCert: certFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.InsecureSkipVerify || config.VerifyPeerCertificate != nil || config.ServerName != "db" {
+		t.Error("verify-full should use the default verification of the host")
+	}
+
+	config, err = tlsConfig(Options{Host: "db", SSLMode: "require", SSLRootCert: certFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.InsecureSkipVerify || config.VerifyPeerCertificate != nil {
+		t.Error("require should skip the verification")
+	}
+
+	// The certificate has no name matching the host
+	config, err = tlsConfig(Options{Host: "10.0.0.1", SSLMode: "verify-ca", SSLRootCert: certFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.InsecureSkipVerify || config.VerifyPeerCertificate == nil {
+		t.Fatal("verify-ca should verify the certificate itself")
+	}
+	if err := config.VerifyPeerCertificate([][]byte{server}, nil); err != nil {
+		t.Errorf("verify-ca should accept a certificate of the CA for another host: %v", err)
+	}
+	if err := config.VerifyPeerCertificate([][]byte{other}, nil); err == nil {
+		t.Error("verify-ca should reject a certificate of another CA")
+	}
+	if err := config.VerifyPeerCertificate(nil, nil); err == nil {
+		t.Error("verify-ca should reject a server without certificate")
+	}
+}
+
+// readCertificate returns the DER bytes of a certificate file
+func readCertificate(t *testing.T, file string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("no certificate in %s", file)
+	}
+	return block.Bytes
+}
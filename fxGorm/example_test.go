@@ -1,11 +1,16 @@
 package fxgorm
 
 import (
+	"context"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	fxconfig "github.com/UTOL-s/module/fxConfig"
+	"github.com/spf13/viper"
 	"go.uber.org/fx"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 // ExampleGormConfig demonstrates how to create a GORM configuration
@@ -108,3 +113,47 @@ func TestBuildDSN(t *testing.T) {
 		})
 	}
 }
+
+// TestBuildDSNSettings tests escaping, the DSN passthrough and params
+func TestBuildDSNSettings(t *testing.T) {
+	config := &GormConfig{Database: DatabaseConfig{
+		Type:     PostgreSQL,
+		Host:     "localhost",
+		User:     "postgres",
+		Password: "p@ss word",
+		DBName:   "testdb",
+	}}
+	if dsn, _ := config.buildDSN(); !strings.Contains(dsn, "password='p@ss word'") {
+		t.Errorf("the password should be quoted, got %q", dsn)
+	}
+
+	config = &GormConfig{Database: DatabaseConfig{Type: PostgreSQL, DSN: "postgres://app@db/app?sslmode=require"}}
+	if err := config.Validate(); err != nil {
+		t.Errorf("a DSN should replace the connection settings, got %v", err)
+	}
+	if dsn, _ := config.buildDSN(); dsn != "postgres://app@db/app?sslmode=require" {
+		t.Errorf("the DSN should be used as is, got %q", dsn)
+	}
+
+	file := filepath.Join(t.TempDir(), "test.db")
+	viper.Set("database.type", "sqlite")
+	viper.Set("database.file", file)
+	viper.Set("database.log.level", int(logger.Silent))
+	viper.Set("database.params", map[string]interface{}{"_busy_timeout": 5000})
+	defer viper.Reset()
+
+	config = NewGormConfig(newTestConfig())
+	if dsn, _ := config.buildDSN(); dsn != file+"?_busy_timeout=5000" {
+		t.Errorf("params should be added to the DSN, got %q", dsn)
+	}
+	manager := NewDatabaseManager(config)
+	if err := manager.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	manager.Close()
+
+	viper.Set("database.params", "invalid")
+	if err := NewGormConfig(newTestConfig()).Validate(); err == nil || !strings.Contains(err.Error(), "invalid params") {
+		t.Errorf("invalid params should fail validation, got %v", err)
+	}
+}
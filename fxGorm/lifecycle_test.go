@@ -0,0 +1,221 @@
+package fxgorm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	fxconfig "github.com/UTOL-s/module/fxConfig"
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestConfig() *fxconfig.Config {
+	return &fxconfig.Config{Accessor: fxconfig.ConfigAccessor()}
+}
+
+// TestLifecycle tests that FxGorm connects on start and closes on stop
+func TestLifecycle(t *testing.T) {
+	viper.Set("database.type", "sqlite")
+	viper.Set("database.file", filepath.Join(t.TempDir(), "test.db"))
+	viper.Set("database.log.level", int(logger.Silent))
+	defer viper.Reset()
+
+	var db *gorm.DB
+	var manager *DatabaseManager
+	app := fxtest.New(t,
+		fx.Provide(newTestConfig),
+		FxGorm,
+		fx.Populate(&db, &manager),
+	)
+
+	if manager.Connected() {
+		t.Fatal("database should not be connected before start")
+	}
+	if _, err := manager.GetPoolStats(); err == nil {
+		t.Error("GetPoolStats should fail before start")
+	}
+
+	app.RequireStart()
+	if db != manager.GetDB() {
+		t.Error("injected database should be the manager database")
+	}
+	if err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY)").Error; err != nil {
+		t.Fatalf("injected database should be usable after start: %v", err)
+	}
+	if _, err := manager.GetPoolStats(); err != nil {
+		t.Errorf("GetPoolStats should succeed after start: %v", err)
+	}
+	if err := manager.SetPoolConfig(PoolConfig{MaxIdleConns: 1, MaxOpenConns: 2}); err != nil {
+		t.Errorf("SetPoolConfig should succeed after start: %v", err)
+	}
+
+	app.RequireStop()
+	if manager.Connected() {
+		t.Error("database should be closed after stop")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlDB.Ping(); err == nil {
+		t.Error("connection pool should be closed after stop")
+	}
+}
+
+// TestNotConnected tests that queries from constructors fail with
+// ErrNotConnected instead of panicking, and succeed after start
+func TestNotConnected(t *testing.T) {
+	viper.Set("database.type", "sqlite")
+	viper.Set("database.file", filepath.Join(t.TempDir(), "test.db"))
+	viper.Set("database.log.level", int(logger.Silent))
+	defer viper.Reset()
+
+	type item struct{ ID uint }
+	var db *gorm.DB
+	app := fxtest.New(t,
+		fx.Provide(newTestConfig),
+		FxGorm,
+		fx.Invoke(func(db *gorm.DB) {
+			checks := map[string]error{
+				"exec":        db.Exec("SELECT 1").Error,
+				"create":      db.Create(&item{}).Error,
+				"find":        db.Find(&[]item{}).Error,
+				"automigrate": db.AutoMigrate(&item{}),
+				"transaction": db.Transaction(func(tx *gorm.DB) error { return nil }),
+			}
+			var n int
+			checks["row"] = db.Raw("SELECT 1").Row().Scan(&n)
+			for name, err := range checks {
+				if !errors.Is(err, ErrNotConnected) {
+					t.Errorf("%s before start should fail with ErrNotConnected, got %v", name, err)
+				}
+			}
+		}),
+		fx.Populate(&db),
+	)
+
+	app.RequireStart()
+	defer app.RequireStop()
+	if err := db.AutoMigrate(&item{}); err != nil {
+		t.Fatalf("the database should be usable after start: %v", err)
+	}
+	if err := db.Create(&item{}).Error; err != nil {
+		t.Errorf("the database should be usable after start: %v", err)
+	}
+}
+
+// TestConnectHonorsContext tests that Connect gives up when the context is done
+func TestConnectHonorsContext(t *testing.T) {
+	manager := NewDatabaseManager(&GormConfig{
+		Database: DatabaseConfig{
+			Type: SQLite,
+			File: filepath.Join(t.TempDir(), "test.db"),
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := manager.Connect(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Connect() error = %v, want context.Canceled", err)
+	}
+	if manager.Connected() {
+		t.Error("database should not be connected")
+	}
+	if err := manager.Close(); err != nil {
+		t.Errorf("Close() should succeed when not connected: %v", err)
+	}
+}
+
+// TestManagedDB tests that the database handed out before Connect is not
+// replaced by the connection but runs its statements on it, including
+// while Connect runs and after a reconnect
+func TestManagedDB(t *testing.T) {
+	type item struct {
+		ID   uint
+		Name string
+	}
+	manager := NewDatabaseManager(&GormConfig{
+		Database: DatabaseConfig{Type: SQLite, File: filepath.Join(t.TempDir(), "test.db")},
+		Log:      LogConfig{Level: logger.Silent},
+	})
+	db := manager.GetDB()
+	statement := db.Statement
+
+	// Queries racing with Connect fail with ErrNotConnected or succeed
+	done := make(chan struct{})
+	queried := make(chan error, 1)
+	go func() {
+		defer close(queried)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			var n int
+			if err := db.Raw("SELECT 1").Scan(&n).Error; err != nil && !errors.Is(err, ErrNotConnected) {
+				queried <- err
+				return
+			}
+		}
+	}()
+	if err := manager.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(done)
+	if err := <-queried; err != nil {
+		t.Errorf("query during Connect failed: %v", err)
+	}
+
+	if manager.GetDB() != db || db.Statement != statement || db.Statement.DB != db {
+		t.Error("the handed out database should not change on Connect")
+	}
+	if err := db.AutoMigrate(&item{}); err != nil {
+		t.Fatal(err)
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&item{Name: "kept"}).Error; err != nil {
+			return err
+		}
+		// Nested transactions use savepoints of the connection
+		_ = tx.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&item{Name: "rolled back"}).Error; err != nil {
+				return err
+			}
+			return errors.New("roll back")
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	if err := db.Debug().Model(&item{}).Pluck("name", &names).Error; err != nil || len(names) != 1 || names[0] != "kept" {
+		t.Errorf("names = %v, %v; want [kept]", names, err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connDB, _ := manager.conn.Load().DB(); sqlDB != connDB {
+		t.Error("DB() should return the pool of the connection")
+	}
+
+	// The same instance keeps working once the manager reconnects
+	if err := manager.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	var count int64
+	if err := db.Model(&item{}).Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("count after reconnect = %d, %v; want 1", count, err)
+	}
+}
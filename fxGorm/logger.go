@@ -0,0 +1,170 @@
+package fxgorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SamplingConfig limits how many queries are logged per second. Failed
+// and slow queries are never sampled.
+type SamplingConfig struct {
+	// Initial queries are logged each second
+	Initial int `mapstructure:"initial"`
+	// Thereafter every Thereafter-th query is logged in that second
+	Thereafter int `mapstructure:"thereafter"`
+}
+
+// logFieldsKey stores the log fields of a context
+type logFieldsKey struct{}
+
+// WithLogFields returns a context whose queries are logged with the given
+// fields, e.g. the request or trace ID
+func WithLogFields(ctx context.Context, fields ...zap.Field) context.Context {
+	existing, _ := ctx.Value(logFieldsKey{}).([]zap.Field)
+	return context.WithValue(ctx, logFieldsKey{}, append(existing[:len(existing):len(existing)], fields...))
+}
+
+// logFields returns the fields added to ctx by WithLogFields
+func logFields(ctx context.Context) []zap.Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(logFieldsKey{}).([]zap.Field)
+	return fields
+}
+
+// databaseLogger returns the logger of a database, which may be nil
+func databaseLogger(log *zap.Logger, name string) *zap.Logger {
+	if log == nil {
+		return nil
+	}
+	return log.With(zap.String("database", name))
+}
+
+// ZapLogger is a GORM logger writing structured entries to zap. Failed
+// queries are logged at error level, slow ones at warn level and, with
+// the Info level, every query at info level.
+type ZapLogger struct {
+	logger  *zap.Logger
+	sampled *zap.Logger
+	config  LogConfig
+}
+
+// NewZapLogger creates a GORM logger with the level, slow threshold,
+// parameter logging and sampling of config
+func NewZapLogger(log *zap.Logger, config LogConfig) *ZapLogger {
+	if log == nil {
+		log = zap.NewNop()
+	}
+	log = log.WithOptions(zap.WithCaller(false))
+	sampled := log
+	if config.Sampling.Initial > 0 {
+		sampled = log.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewSamplerWithOptions(core, time.Second, config.Sampling.Initial, config.Sampling.Thereafter)
+		}))
+	}
+	return &ZapLogger{logger: log, sampled: sampled, config: config}
+}
+
+// LogMode implements logger.Interface
+func (l *ZapLogger) LogMode(level logger.LogLevel) logger.Interface {
+	clone := *l
+	clone.config.Level = level
+	return &clone
+}
+
+// Info implements logger.Interface
+func (l *ZapLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.config.Level >= logger.Info {
+		l.logger.Info(fmt.Sprintf(msg, data...), l.fields(ctx)...)
+	}
+}
+
+// Warn implements logger.Interface
+func (l *ZapLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.config.Level >= logger.Warn {
+		l.logger.Warn(fmt.Sprintf(msg, data...), l.fields(ctx)...)
+	}
+}
+
+// Error implements logger.Interface
+func (l *ZapLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.config.Level >= logger.Error {
+		l.logger.Error(fmt.Sprintf(msg, data...), l.fields(ctx)...)
+	}
+}
+
+// Trace implements logger.Interface, logging an executed query
+func (l *ZapLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.config.Level <= logger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && l.config.Level >= logger.Error &&
+		!(l.config.IgnoreRecordNotFoundError && errors.Is(err, gorm.ErrRecordNotFound)):
+		l.logger.Error("sql query failed", append(l.queryFields(ctx, elapsed, fc), zap.Error(err))...)
+	case l.config.SlowThreshold > 0 && elapsed > l.config.SlowThreshold && l.config.Level >= logger.Warn:
+		l.logger.Warn("slow sql query", append(l.queryFields(ctx, elapsed, fc), zap.Duration("threshold", l.config.SlowThreshold))...)
+	case l.config.Level >= logger.Info:
+		if entry := l.sampled.Check(zapcore.InfoLevel, "sql query"); entry != nil {
+			entry.Write(l.queryFields(ctx, elapsed, fc)...)
+		}
+	}
+}
+
+// ParamsFilter implements gorm.ParamsFilter, leaving the placeholders in
+// logged queries unless parameters are logged
+func (l *ZapLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.config.LogParams {
+		return sql, params
+	}
+	return sql, nil
+}
+
+// queryFields describes a query
+func (l *ZapLogger) queryFields(ctx context.Context, elapsed time.Duration, fc func() (string, int64)) []zap.Field {
+	sql, rows := fc()
+	fields := []zap.Field{
+		zap.String("sql", sql),
+		zap.Duration("duration", elapsed),
+		zap.String("caller", queryCaller()),
+	}
+	if rows >= 0 {
+		fields = append(fields, zap.Int64("rows", rows))
+	}
+	return append(fields, logFields(ctx)...)
+}
+
+func (l *ZapLogger) fields(ctx context.Context) []zap.Field {
+	return append([]zap.Field{zap.String("caller", queryCaller())}, logFields(ctx)...)
+}
+
+// queryCaller returns the first caller outside GORM and this package,
+// i.e. the application code that ran the query
+func queryCaller() string {
+	pcs := [32]uintptr{}
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs[:])])
+	for {
+		frame, more := frames.Next()
+		internal := strings.HasPrefix(frame.Function, "gorm.io/") ||
+			strings.HasPrefix(frame.Function, "github.com/UTOL-s/module/fxGorm.")
+		if !internal || strings.HasSuffix(frame.File, "_test.go") {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
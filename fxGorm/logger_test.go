@@ -0,0 +1,157 @@
+package fxgorm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type logEntry struct {
+	ID   uint
+	Name string
+}
+
+func newLoggedDB(t *testing.T, config LogConfig) (*gorm.DB, *observer.ObservedLogs) {
+	t.Helper()
+	core, logs := observer.New(zapcore.DebugLevel)
+	manager := NewDatabaseManagerWithLogger(&GormConfig{
+		Database: DatabaseConfig{
+			Type: SQLite,
+			File: filepath.Join(t.TempDir(), "test.db"),
+		},
+		Log: config,
+	}, zap.New(core))
+	if err := manager.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { manager.Close() })
+	db := manager.GetDB()
+	if err := db.Session(&gorm.Session{Logger: logger.Discard}).AutoMigrate(&logEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	logs.TakeAll()
+	return db, logs
+}
+
+// TestZapLoggerQueries tests the fields of logged queries
+func TestZapLoggerQueries(t *testing.T) {
+	db, logs := newLoggedDB(t, LogConfig{Level: logger.Info})
+	ctx := WithLogFields(context.Background(), zap.String("request_id", "req-1"))
+
+	if err := db.WithContext(ctx).Create(&logEntry{Name: "secret-value"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	entries := logs.FilterMessage("sql query").All()
+	if len(entries) != 1 {
+		t.Fatalf("expected one query entry, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if sql := fields["sql"].(string); !strings.Contains(sql, "INSERT") || strings.Contains(sql, "secret-value") {
+		t.Errorf("the query should be logged without parameters, got %q", sql)
+	}
+	if fields["rows"] != int64(1) || fields["request_id"] != "req-1" || fields["database"] != nil {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	if _, ok := fields["duration"]; !ok {
+		t.Error("the duration should be logged")
+	}
+	if caller := fields["caller"].(string); !strings.Contains(caller, "logger_test.go") {
+		t.Errorf("the caller should be the test, got %q", caller)
+	}
+}
+
+// TestZapLoggerParams tests logging parameters when enabled
+func TestZapLoggerParams(t *testing.T) {
+	db, logs := newLoggedDB(t, LogConfig{Level: logger.Info, LogParams: true})
+	if err := db.Create(&logEntry{Name: "visible"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	sql := logs.FilterMessage("sql query").All()[0].ContextMap()["sql"].(string)
+	if !strings.Contains(sql, "visible") {
+		t.Errorf("parameters should be logged, got %q", sql)
+	}
+}
+
+// TestZapLoggerLevels tests errors, slow queries and the level threshold
+func TestZapLoggerLevels(t *testing.T) {
+	db, logs := newLoggedDB(t, LogConfig{Level: logger.Warn, IgnoreRecordNotFoundError: true})
+	var entry logEntry
+	if err := db.First(&entry).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatal(err)
+	}
+	db.Exec("SELECT * FROM missing_table")
+	db.Create(&logEntry{Name: "a"})
+
+	if n := logs.FilterMessage("sql query").Len(); n != 0 {
+		t.Errorf("queries should not be logged at the warn level, got %d", n)
+	}
+	failed := logs.FilterMessage("sql query failed").All()
+	if len(failed) != 1 || failed[0].Level != zapcore.ErrorLevel || !strings.Contains(failed[0].ContextMap()["sql"].(string), "missing_table") {
+		t.Errorf("only the failed query should be logged as an error, got %v", failed)
+	}
+
+	core, slowLogs := observer.New(zapcore.DebugLevel)
+	slow := NewZapLogger(zap.New(core), LogConfig{Level: logger.Warn, SlowThreshold: time.Millisecond})
+	slow.Trace(context.Background(), time.Now().Add(-time.Second), func() (string, int64) { return "SELECT 1", -1 }, nil)
+	entries := slowLogs.FilterMessage("slow sql query").All()
+	if len(entries) != 1 || entries[0].Level != zapcore.WarnLevel {
+		t.Fatalf("the slow query should be logged as a warning, got %v", entries)
+	}
+	if _, ok := entries[0].ContextMap()["rows"]; ok {
+		t.Error("unknown row counts should be omitted")
+	}
+}
+
+// TestZapLoggerSampling tests that sampling limits query entries but not failures
+func TestZapLoggerSampling(t *testing.T) {
+	db, logs := newLoggedDB(t, LogConfig{Level: logger.Info, Sampling: SamplingConfig{Initial: 2}})
+	for range 5 {
+		db.Create(&logEntry{Name: "a"})
+	}
+	db.Exec("SELECT * FROM missing_table")
+	db.Exec("SELECT * FROM missing_table")
+
+	if n := logs.FilterMessage("sql query").Len(); n != 2 {
+		t.Errorf("sampling should keep 2 query entries, got %d", n)
+	}
+	if n := logs.FilterMessage("sql query failed").Len(); n != 2 {
+		t.Errorf("failures should not be sampled, got %d", n)
+	}
+}
+
+// TestZapLoggerInjected tests that FxGorm logs to the injected zap logger
+func TestZapLoggerInjected(t *testing.T) {
+	viper.Set("database.type", "sqlite")
+	viper.Set("database.file", filepath.Join(t.TempDir(), "test.db"))
+	viper.Set("database.log.level", int(logger.Info))
+	defer viper.Reset()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	var db *gorm.DB
+	app := fxtest.New(t,
+		fx.Provide(newTestConfig),
+		fx.Supply(zap.New(core)),
+		FxGorm,
+		fx.Populate(&db),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	db.Exec("SELECT 1")
+	entries := logs.FilterMessage("sql query").All()
+	if len(entries) == 0 || entries[len(entries)-1].ContextMap()["database"] != DefaultDatabase {
+		t.Errorf("queries should be logged with the database name, got %v", entries)
+	}
+}
@@ -0,0 +1,227 @@
+package fxgorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+)
+
+// metricsStartKey stores the start of a statement for the duration histogram
+const metricsStartKey = "fxgorm:metrics_start"
+
+var (
+	poolOpenDesc = prometheus.NewDesc("fxgorm_pool_open_connections",
+		"Established connections, in use or idle.", []string{"database"}, nil)
+	poolInUseDesc = prometheus.NewDesc("fxgorm_pool_in_use_connections",
+		"Connections currently in use.", []string{"database"}, nil)
+	poolIdleDesc = prometheus.NewDesc("fxgorm_pool_idle_connections",
+		"Idle connections.", []string{"database"}, nil)
+	poolMaxOpenDesc = prometheus.NewDesc("fxgorm_pool_max_open_connections",
+		"Maximum number of open connections.", []string{"database"}, nil)
+	poolWaitCountDesc = prometheus.NewDesc("fxgorm_pool_wait_count_total",
+		"Connections waited for because the pool was exhausted.", []string{"database"}, nil)
+	poolWaitDurationDesc = prometheus.NewDesc("fxgorm_pool_wait_duration_seconds_total",
+		"Time spent waiting for a connection.", []string{"database"}, nil)
+	poolClosedDesc = prometheus.NewDesc("fxgorm_pool_closed_connections_total",
+		"Connections closed by the pool, by reason.", []string{"database", "reason"}, nil)
+	connectionUpDesc = prometheus.NewDesc("fxgorm_connection_up",
+		"Whether the last health check of the database succeeded.", []string{"database"}, nil)
+	connectionLossesDesc = prometheus.NewDesc("fxgorm_connection_losses_total",
+		"Health checks that found a healthy connection lost.", []string{"database"}, nil)
+	reconnectsDesc = prometheus.NewDesc("fxgorm_reconnects_total",
+		"Recoveries from lost connections.", []string{"database"}, nil)
+)
+
+// Metrics is a Prometheus collector for the databases of a registry. It
+// publishes the pool and connection statistics of each database and, once
+// installed, the duration of every query by operation and table.
+type Metrics struct {
+	registry      *Registry
+	queryDuration *prometheus.HistogramVec
+	queryErrors   *prometheus.CounterVec
+}
+
+// MetricsParams holds the dependencies of the metrics
+type MetricsParams struct {
+	fx.In
+	Lifecycle  fx.Lifecycle
+	Registry   *Registry
+	Registerer prometheus.Registerer `optional:"true"`
+}
+
+// WithMetrics registers the database metrics with the prometheus.Registerer
+// of the app, or the default registerer when there is none
+var WithMetrics = fx.Options(
+	fx.Provide(NewMetricsWithLifecycle),
+	fx.Invoke(func(*Metrics) {}),
+)
+
+// NewMetrics creates the collector of the databases in registry. Without a
+// registry only the queries of plugins installed by hand are published.
+func NewMetrics(registry *Registry) *Metrics {
+	return &Metrics{
+		registry: registry,
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "fxgorm_query_duration_seconds",
+			Help:    "Duration of database queries by operation and table.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"database", "operation", "table"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "fxgorm_query_errors_total",
+			Help: "Failed database queries by operation and table, not counting record not found.",
+		}, []string{"database", "operation", "table"}),
+	}
+}
+
+// NewMetricsWithLifecycle registers the collector and installs the query
+// callbacks on every database when the app starts, after they connect
+func NewMetricsWithLifecycle(p MetricsParams) (*Metrics, error) {
+	m := NewMetrics(p.Registry)
+	registerer := p.Registerer
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	if err := registerer.Register(m); err != nil {
+		return nil, fmt.Errorf("failed to register database metrics: %w", err)
+	}
+
+	p.Lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			for _, name := range p.Registry.Names() {
+				db, err := p.Registry.Get(name)
+				if err != nil {
+					return err
+				}
+				if err := db.Use(m.Plugin(name)); err != nil {
+					return fmt.Errorf("failed to install metrics on database %s: %w", name, err)
+				}
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			registerer.Unregister(m)
+			return nil
+		},
+	})
+	return m, nil
+}
+
+// Plugin returns a GORM plugin recording the queries of the named
+// database, installed with db.Use
+func (m *Metrics) Plugin(database string) gorm.Plugin {
+	return &queryMetrics{metrics: m, database: database}
+}
+
+// queryMetrics times queries with callbacks around the GORM statements
+type queryMetrics struct {
+	metrics  *Metrics
+	database string
+}
+
+// Name implements gorm.Plugin
+func (q *queryMetrics) Name() string {
+	return "fxgorm:metrics"
+}
+
+// Initialize implements gorm.Plugin, registering the callbacks
+func (q *queryMetrics) Initialize(db *gorm.DB) error {
+	m, database := q.metrics, q.database
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(metricsStartKey, time.Now())
+	}
+	after := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			start, ok := tx.InstanceGet(metricsStartKey)
+			if !ok {
+				return
+			}
+			table := tx.Statement.Table
+			m.queryDuration.WithLabelValues(database, operation, table).Observe(time.Since(start.(time.Time)).Seconds())
+			if err := tx.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				m.queryErrors.WithLabelValues(database, operation, table).Inc()
+			}
+		}
+	}
+
+	type register func(name string, fn func(*gorm.DB)) error
+	callbacks := db.Callback()
+	for _, processor := range []struct {
+		operation     string
+		before, after register
+	}{
+		{"create", callbacks.Create().Before("gorm:create").Register, callbacks.Create().After("gorm:create").Register},
+		{"query", callbacks.Query().Before("gorm:query").Register, callbacks.Query().After("gorm:query").Register},
+		{"update", callbacks.Update().Before("gorm:update").Register, callbacks.Update().After("gorm:update").Register},
+		{"delete", callbacks.Delete().Before("gorm:delete").Register, callbacks.Delete().After("gorm:delete").Register},
+		{"row", callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register},
+		{"raw", callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register},
+	} {
+		if err := processor.before("fxgorm:metrics_before_"+processor.operation, before); err != nil {
+			return fmt.Errorf("failed to register query metrics: %w", err)
+		}
+		if err := processor.after("fxgorm:metrics_after_"+processor.operation, after(processor.operation)); err != nil {
+			return fmt.Errorf("failed to register query metrics: %w", err)
+		}
+	}
+	return nil
+}
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		poolOpenDesc, poolInUseDesc, poolIdleDesc, poolMaxOpenDesc, poolWaitCountDesc,
+		poolWaitDurationDesc, poolClosedDesc, connectionUpDesc, connectionLossesDesc, reconnectsDesc,
+	} {
+		ch <- desc
+	}
+	m.queryDuration.Describe(ch)
+	m.queryErrors.Describe(ch)
+}
+
+// Collect implements prometheus.Collector, reading the pool statistics of
+// the connected databases
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	var names []string
+	if m.registry != nil {
+		names = m.registry.Names()
+	}
+	for _, name := range names {
+		dm, _ := m.registry.Manager(name)
+		stats, err := dm.GetPoolStats()
+		if err != nil {
+			continue
+		}
+
+		gauge := func(desc *prometheus.Desc, value float64, labels ...string) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, append([]string{name}, labels...)...)
+		}
+		counter := func(desc *prometheus.Desc, value float64, labels ...string) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, append([]string{name}, labels...)...)
+		}
+		gauge(poolOpenDesc, float64(stats.OpenConnections))
+		gauge(poolInUseDesc, float64(stats.InUse))
+		gauge(poolIdleDesc, float64(stats.Idle))
+		gauge(poolMaxOpenDesc, float64(stats.MaxOpenConnections))
+		counter(poolWaitCountDesc, float64(stats.WaitCount))
+		counter(poolWaitDurationDesc, stats.WaitDuration.Seconds())
+		counter(poolClosedDesc, float64(stats.MaxIdleClosed), "max_idle")
+		counter(poolClosedDesc, float64(stats.MaxIdleTimeClosed), "max_idle_time")
+		counter(poolClosedDesc, float64(stats.MaxLifetimeClosed), "max_lifetime")
+
+		connection := dm.ConnectionStats()
+		up := 0.0
+		if connection.Healthy {
+			up = 1
+		}
+		gauge(connectionUpDesc, up)
+		counter(connectionLossesDesc, float64(connection.ConnectionLosses))
+		counter(reconnectsDesc, float64(connection.Reconnects))
+	}
+	m.queryDuration.Collect(ch)
+	m.queryErrors.Collect(ch)
+}
@@ -0,0 +1,132 @@
+package fxgorm
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type meteredEntry struct {
+	ID   uint
+	Name string
+}
+
+// TestMetricsQueries tests the query histogram and error counter
+func TestMetricsQueries(t *testing.T) {
+	manager := NewDatabaseManager(&GormConfig{
+		Database: DatabaseConfig{Type: SQLite, File: filepath.Join(t.TempDir(), "test.db")},
+		Log:      LogConfig{Level: logger.Silent},
+	})
+	if err := manager.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	db := manager.GetDB()
+	if err := db.AutoMigrate(&meteredEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	metrics := NewMetrics(nil)
+	if err := db.Use(metrics.Plugin("app")); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&meteredEntry{Name: "a"})
+	db.Create(&meteredEntry{Name: "b"})
+	var entry meteredEntry
+	db.First(&entry)
+	db.Where("name = ?", "missing").First(&entry)
+	db.Exec("SELECT * FROM missing_table")
+
+	if n := testutil.CollectAndCount(metrics.queryDuration); n == 0 {
+		t.Fatal("queries should be observed")
+	}
+	expected := `
+# HELP fxgorm_query_errors_total Failed database queries by operation and table, not counting record not found.
+# TYPE fxgorm_query_errors_total counter
+fxgorm_query_errors_total{database="app",operation="raw",table=""} 1
+`
+	if err := testutil.CollectAndCompare(metrics.queryErrors, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]uint64{}
+	for _, family := range families {
+		if family.GetName() != "fxgorm_query_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			counts[labels["operation"]+" "+labels["table"]] = metric.GetHistogram().GetSampleCount()
+		}
+	}
+	if counts["create metered_entries"] != 2 || counts["query metered_entries"] != 2 || counts["raw "] != 1 || len(counts) != 3 {
+		t.Errorf("unexpected query counts %v", counts)
+	}
+}
+
+// TestMetricsPool tests the pool statistics of FxGorm databases
+func TestMetricsPool(t *testing.T) {
+	dir := t.TempDir()
+	viper.Set("database.type", "sqlite")
+	viper.Set("database.file", filepath.Join(dir, "app.db"))
+	viper.Set("database.pool.max_open_conns", 4)
+	viper.Set("database.log.level", int(logger.Silent))
+	viper.Set("databases.reporting.type", "sqlite")
+	viper.Set("databases.reporting.file", filepath.Join(dir, "reporting.db"))
+	viper.Set("databases.reporting.log.level", int(logger.Silent))
+	defer viper.Reset()
+
+	registry := prometheus.NewRegistry()
+	var db *gorm.DB
+	app := fxtest.New(t,
+		fx.Provide(newTestConfig),
+		fx.Supply(fx.Annotate(registry, fx.As(new(prometheus.Registerer)))),
+		FxGorm,
+		Named("reporting"),
+		WithMetrics,
+		fx.Populate(&db),
+	)
+	app.RequireStart()
+
+	db.Exec("SELECT 1")
+	expected := `
+# HELP fxgorm_pool_max_open_connections Maximum number of open connections.
+# TYPE fxgorm_pool_max_open_connections gauge
+fxgorm_pool_max_open_connections{database="default"} 4
+fxgorm_pool_max_open_connections{database="reporting"} 100
+# HELP fxgorm_connection_up Whether the last health check of the database succeeded.
+# TYPE fxgorm_connection_up gauge
+fxgorm_connection_up{database="default"} 1
+fxgorm_connection_up{database="reporting"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"fxgorm_pool_max_open_connections", "fxgorm_connection_up"); err != nil {
+		t.Error(err)
+	}
+	if n, err := testutil.GatherAndCount(registry, "fxgorm_query_duration_seconds"); err != nil || n == 0 {
+		t.Errorf("queries of FxGorm databases should be observed, got %d, %v", n, err)
+	}
+
+	app.RequireStop()
+	if n, _ := testutil.GatherAndCount(registry); n != 0 {
+		t.Errorf("the metrics should be unregistered on stop, got %d", n)
+	}
+}
@@ -0,0 +1,641 @@
+package fxgorm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	fxconfig "github.com/UTOL-s/module/fxConfig"
+	"go.uber.org/fx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// noTransaction marks SQL migrations that must run outside a transaction,
+// e.g. CREATE INDEX CONCURRENTLY
+const noTransaction = "-- fxgorm:no-transaction"
+
+// migrationFile matches <version>_<name>.up.sql and .down.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_([\w-]+)\.(up|down)\.sql$`)
+
+// MigrationFunc applies or reverts a migration
+type MigrationFunc func(tx *gorm.DB) error
+
+// Migration is a versioned schema change, read from SQL files or written in Go
+type Migration struct {
+	Version int64
+	Name    string
+	Up      MigrationFunc
+	Down    MigrationFunc
+	// NoTransaction runs the migration outside a transaction
+	NoTransaction bool
+
+	// checksum hashes the up SQL to detect edited migrations
+	checksum string
+}
+
+// NewMigration creates a Go migration
+func NewMigration(version int64, name string, up, down MigrationFunc) *Migration {
+	return &Migration{Version: version, Name: name, Up: up, Down: down}
+}
+
+// AsMigration annotates a migration constructor for the "migrations" group
+func AsMigration(f any) any {
+	return fx.Annotate(
+		f,
+		fx.ResultTags(`group:"migrations"`),
+	)
+}
+
+// MigrationConfig holds migration configuration
+type MigrationConfig struct {
+	// Dir holds the SQL files when no file system is provided
+	Dir string `mapstructure:"dir"`
+	// Table records the applied migrations, "schema_migrations" by default
+	Table string `mapstructure:"table"`
+	// OnStart applies pending migrations when the app starts
+	OnStart bool `mapstructure:"on_start"`
+	// LockTimeout is how long to wait for another process migrating
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+}
+
+// MigrationStatus describes a migration and whether it was applied
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	// Modified reports an applied SQL migration whose file changed since
+	Modified bool
+	// Missing reports an applied migration that no longer exists
+	Missing bool
+}
+
+// schemaMigration is a row of the migrations table
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// migrationLock is the row held while migrations run
+type migrationLock struct {
+	ID       int `gorm:"primaryKey;autoIncrement:false"`
+	Owner    string
+	LockedAt time.Time
+}
+
+// Migrator applies and reverts migrations, recording them in a table and
+// holding a lock so only one process migrates at a time: an advisory or
+// application lock of the session on PostgreSQL, MySQL and SQL Server, a
+// lock row on SQLite
+type Migrator struct {
+	db         *gorm.DB
+	config     MigrationConfig
+	migrations []*Migration
+	owner      string
+}
+
+// MigratorParams holds the dependencies of the migrator
+type MigratorParams struct {
+	fx.In
+	Lifecycle  fx.Lifecycle
+	Config     *fxconfig.Config
+	DB         *gorm.DB
+	Source     fs.FS        `name:"migrations" optional:"true"`
+	Migrations []*Migration `group:"migrations"`
+}
+
+// WithMigrations provides the file system holding the SQL migrations,
+// e.g. an embed.FS
+func WithMigrations(fsys fs.FS) fx.Option {
+	return fx.Provide(fx.Annotate(
+		func() fs.FS { return fsys },
+		fx.ResultTags(`name:"migrations"`),
+	))
+}
+
+// NewMigrationConfig reads the migration settings under database.migrations.
+// lock_timeout takes a duration string or a number of seconds.
+func NewMigrationConfig(accessor *fxconfig.Accessor) (MigrationConfig, error) {
+	lockTimeout, err := readDuration(accessor, "database.migrations.lock_timeout", time.Second)
+	if err != nil {
+		return MigrationConfig{}, err
+	}
+	return MigrationConfig{
+		Dir:         accessor.String("database.migrations.dir"),
+		Table:       accessor.String("database.migrations.table"),
+		OnStart:     accessor.Bool("database.migrations.on_start"),
+		LockTimeout: lockTimeout,
+	}, nil
+}
+
+// NewMigratorWithLifecycle creates the migrator of the default database,
+// applying pending migrations on start when database.migrations.on_start is set
+func NewMigratorWithLifecycle(p MigratorParams) (*Migrator, error) {
+	config, err := NewMigrationConfig(p.Config.Accessor)
+	if err != nil {
+		return nil, err
+	}
+	source := p.Source
+	if source == nil && config.Dir != "" {
+		source = os.DirFS(config.Dir)
+	}
+	m, err := NewMigrator(p.DB, source, config, p.Migrations...)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.OnStart {
+		p.Lifecycle.Append(fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				_, err := m.Up(ctx)
+				return err
+			},
+		})
+	}
+	return m, nil
+}
+
+// NewMigrator creates a migrator for the SQL migrations in source, which
+// may be nil, and the given Go migrations
+func NewMigrator(db *gorm.DB, source fs.FS, config MigrationConfig, migrations ...*Migration) (*Migrator, error) {
+	if config.Table == "" {
+		config.Table = "schema_migrations"
+	}
+	if config.LockTimeout == 0 {
+		config.LockTimeout = time.Minute
+	}
+
+	all := append([]*Migration(nil), migrations...)
+	if source != nil {
+		loaded, err := loadMigrations(source)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, loaded...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	for i := 1; i < len(all); i++ {
+		if all[i].Version == all[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", all[i].Version, all[i-1].Name, all[i].Name)
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	return &Migrator{
+		db:         db,
+		config:     config,
+		migrations: all,
+		owner:      fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+	}, nil
+}
+
+// loadMigrations reads the up and down SQL files at the root of source
+func loadMigrations(source fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %s: %w", entry.Name(), err)
+		}
+		content, err := fs.ReadFile(source, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has files named %s and %s", version, m.Name, match[2])
+		}
+
+		sql := string(content)
+		if match[3] == "up" {
+			sum := sha256.Sum256(content)
+			m.checksum = hex.EncodeToString(sum[:])
+			m.Up = execSQL(sql)
+			m.NoTransaction = strings.Contains(sql, noTransaction)
+		} else {
+			m.Down = execSQL(sql)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == nil {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	return migrations, nil
+}
+
+// execSQL runs a SQL file. MySQL requires multiStatements=true for files
+// holding several statements.
+func execSQL(sql string) MigrationFunc {
+	return func(tx *gorm.DB) error {
+		if strings.TrimSpace(sql) == "" {
+			return nil
+		}
+		return tx.Exec(sql).Error
+	}
+}
+
+// Migrations returns the known migrations ordered by version
+func (m *Migrator) Migrations() []*Migration {
+	return append([]*Migration(nil), m.migrations...)
+}
+
+// Up applies the pending migrations in order
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	var applied []*Migration
+	err := m.locked(ctx, func(db *gorm.DB, rows map[int64]schemaMigration) error {
+		for _, migration := range m.migrations {
+			row, ok := rows[migration.Version]
+			if ok {
+				if migration.checksum != "" && row.Checksum != "" && row.Checksum != migration.checksum {
+					return fmt.Errorf("migration %d_%s was modified after it was applied", migration.Version, migration.Name)
+				}
+				continue
+			}
+			if err := m.apply(db, migration); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last applied migration, returning nil when none is applied
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var reverted *Migration
+	err := m.locked(ctx, func(db *gorm.DB, rows map[int64]schemaMigration) error {
+		migration, err := m.last(rows)
+		if err != nil || migration == nil {
+			return err
+		}
+		reverted = migration
+		return m.revert(db, migration)
+	})
+	return reverted, err
+}
+
+// Redo reverts and reapplies the last applied migration
+func (m *Migrator) Redo(ctx context.Context) (*Migration, error) {
+	var redone *Migration
+	err := m.locked(ctx, func(db *gorm.DB, rows map[int64]schemaMigration) error {
+		migration, err := m.last(rows)
+		if err != nil || migration == nil {
+			return err
+		}
+		redone = migration
+		if err := m.revert(db, migration); err != nil {
+			return err
+		}
+		return m.apply(db, migration)
+	})
+	return redone, err
+}
+
+// Status lists the known migrations and applied migrations that are
+// no longer known, ordered by version
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	db := m.db.WithContext(ctx)
+	if err := m.ensureTables(db); err != nil {
+		return nil, err
+	}
+	rows, err := m.applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	known := make(map[int64]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := rows[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+			status.Modified = migration.checksum != "" && row.Checksum != "" && row.Checksum != migration.checksum
+		}
+		statuses = append(statuses, status)
+	}
+	for version, row := range rows {
+		if !known[version] {
+			appliedAt := row.AppliedAt
+			statuses = append(statuses, MigrationStatus{Version: version, Name: row.Name, AppliedAt: &appliedAt, Missing: true})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// apply runs a migration and records it, atomically unless the migration
+// opts out of transactions
+func (m *Migrator) apply(db *gorm.DB, migration *Migration) error {
+	run := func(tx *gorm.DB) error {
+		if err := migration.Up(tx); err != nil {
+			return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		row := schemaMigration{Version: migration.Version, Name: migration.Name, Checksum: migration.checksum, AppliedAt: time.Now().UTC()}
+		if err := tx.Table(m.config.Table).Create(&row).Error; err != nil {
+			return fmt.Errorf("failed to record migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		return nil
+	}
+	if migration.NoTransaction {
+		return run(db)
+	}
+	return db.Transaction(run)
+}
+
+// revert runs the down migration and deletes its record
+func (m *Migrator) revert(db *gorm.DB, migration *Migration) error {
+	if migration.Down == nil {
+		return fmt.Errorf("migration %d_%s has no down migration", migration.Version, migration.Name)
+	}
+	run := func(tx *gorm.DB) error {
+		if err := migration.Down(tx); err != nil {
+			return fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if err := tx.Table(m.config.Table).Where("version = ?", migration.Version).Delete(&schemaMigration{}).Error; err != nil {
+			return fmt.Errorf("failed to delete migration record %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		return nil
+	}
+	if migration.NoTransaction {
+		return run(db)
+	}
+	return db.Transaction(run)
+}
+
+// last returns the most recently applied migration
+func (m *Migrator) last(rows map[int64]schemaMigration) (*Migration, error) {
+	var latest int64 = -1
+	for version := range rows {
+		latest = max(latest, version)
+	}
+	if latest < 0 {
+		return nil, nil
+	}
+	for _, migration := range m.migrations {
+		if migration.Version == latest {
+			return migration, nil
+		}
+	}
+	return nil, fmt.Errorf("applied migration %d_%s is missing", latest, rows[latest].Name)
+}
+
+// locked runs fn while holding the migration lock
+func (m *Migrator) locked(ctx context.Context, fn func(db *gorm.DB, rows map[int64]schemaMigration) error) error {
+	db := m.db.WithContext(ctx)
+	if err := m.ensureTables(db); err != nil {
+		return err
+	}
+	run := func(db *gorm.DB) error {
+		if err := m.lock(ctx, db); err != nil {
+			return err
+		}
+		defer m.unlock(db)
+
+		rows, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		return fn(db, rows)
+	}
+	if m.sessionLock() == nil {
+		return run(db)
+	}
+	// A session lock belongs to one connection, which runs the migrations;
+	// the server releases it when a crashed process drops the connection
+	return db.Connection(run)
+}
+
+// ensureTables creates the migrations and lock tables
+func (m *Migrator) ensureTables(db *gorm.DB) error {
+	if err := db.Table(m.config.Table).AutoMigrate(&schemaMigration{}); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	if m.sessionLock() != nil {
+		return nil
+	}
+	if err := db.Table(m.lockTable()).AutoMigrate(&migrationLock{}); err != nil {
+		return fmt.Errorf("failed to create migrations lock table: %w", err)
+	}
+	return nil
+}
+
+// applied loads the applied migrations by version
+func (m *Migrator) applied(db *gorm.DB) (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := db.Table(m.config.Table).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load applied migrations: %w", err)
+	}
+	byVersion := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		byVersion[row.Version] = row
+	}
+	return byVersion, nil
+}
+
+// sessionLock is a lock held by a database session, acquired and
+// released with a single statement taking the lock key
+type sessionLock struct {
+	key any
+	// acquire returns 1 when the lock was acquired, without waiting
+	acquire string
+	release string
+}
+
+// sessionLock returns the session lock of the database, nil for SQLite,
+// which falls back to a lock row
+func (m *Migrator) sessionLock() *sessionLock {
+	name := "fxgorm:" + m.config.Table
+	switch m.db.Dialector.Name() {
+	case "postgres":
+		hash := fnv.New64a()
+		hash.Write([]byte(name))
+		return &sessionLock{
+			key:     int64(hash.Sum64()),
+			acquire: "SELECT CASE WHEN pg_try_advisory_lock(?) THEN 1 ELSE 0 END",
+			release: "SELECT pg_advisory_unlock(?)",
+		}
+	case "mysql":
+		return &sessionLock{
+			key:     name,
+			acquire: "SELECT COALESCE(GET_LOCK(?, 0), 0)",
+			release: "SELECT RELEASE_LOCK(?)",
+		}
+	case "sqlserver":
+		return &sessionLock{
+			key: name,
+			acquire: "DECLARE @result int; " +
+				"EXEC @result = sp_getapplock @Resource = ?, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = 0; " +
+				"SELECT CASE WHEN @result >= 0 THEN 1 ELSE 0 END",
+			release: "EXEC sp_releaseapplock @Resource = ?, @LockOwner = 'Session'",
+		}
+	}
+	return nil
+}
+
+// lock acquires the migration lock, waiting up to LockTimeout for another
+// process to release it
+func (m *Migrator) lock(ctx context.Context, db *gorm.DB) error {
+	ctx, cancel := context.WithTimeout(ctx, m.config.LockTimeout)
+	defer cancel()
+
+	session := m.sessionLock()
+	for {
+		var acquired bool
+		if session != nil {
+			var result int
+			if err := db.Raw(session.acquire, session.key).Scan(&result).Error; err != nil {
+				return fmt.Errorf("failed to acquire migrations lock: %w", err)
+			}
+			acquired = result == 1
+		} else {
+			row := migrationLock{ID: 1, Owner: m.owner, LockedAt: time.Now().UTC()}
+			result := db.Table(m.lockTable()).Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+			if result.Error != nil {
+				return fmt.Errorf("failed to acquire migrations lock: %w", result.Error)
+			}
+			acquired = result.RowsAffected == 1
+		}
+		if acquired {
+			return nil
+		}
+
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			if session != nil {
+				return fmt.Errorf("migrations are locked by another process: %w", ctx.Err())
+			}
+			var holder migrationLock
+			_ = db.Table(m.lockTable()).Take(&holder).Error
+			return fmt.Errorf("migrations are locked by %s since %s, delete the row from %s if it is stale: %w",
+				holder.Owner, holder.LockedAt.Format(time.RFC3339), m.lockTable(), ctx.Err())
+		}
+	}
+}
+
+// unlock releases the migration lock of this migrator
+func (m *Migrator) unlock(db *gorm.DB) {
+	// Release the lock even when the caller's context is done
+	db = db.WithContext(context.Background())
+	if session := m.sessionLock(); session != nil {
+		db.Exec(session.release, session.key)
+		return
+	}
+	db.Table(m.lockTable()).Where("id = ? AND owner = ?", 1, m.owner).Delete(&migrationLock{})
+}
+
+func (m *Migrator) lockTable() string {
+	return m.config.Table + "_lock"
+}
+
+// CreateMigration writes empty up and down SQL files named after the
+// current time, returning their paths
+func CreateMigration(dir, name string) (string, string, error) {
+	name = strings.Trim(regexp.MustCompile(`[^\w-]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", errors.New("migration name is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", fmt.Errorf("failed to create migrations directory: %w", err)
+	}
+
+	base := time.Now().UTC().Format("20060102150405") + "_" + name
+	up := path.Join(dir, base+".up.sql")
+	down := path.Join(dir, base+".down.sql")
+	for _, file := range []string{up, down} {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to create migration: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return "", "", fmt.Errorf("failed to create migration: %w", err)
+		}
+	}
+	return up, down, nil
+}
+
+// RunMigrationCLI runs a migrate command: up, down, redo or status. Use
+// CreateMigration for create, which needs no database.
+func RunMigrationCLI(ctx context.Context, m *Migrator, command string, out io.Writer) error {
+	switch command {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return err
+	case "down", "redo":
+		run, verb := m.Down, "reverted"
+		if command == "redo" {
+			run, verb = m.Redo, "redone"
+		}
+		migration, err := run(ctx)
+		if err != nil {
+			return err
+		}
+		if migration == nil {
+			fmt.Fprintln(out, "no applied migrations")
+			return nil
+		}
+		fmt.Fprintf(out, "%s %d_%s\n", verb, migration.Version, migration.Name)
+		return nil
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			if status.Modified {
+				state += " (modified)"
+			}
+			if status.Missing {
+				state += " (missing)"
+			}
+			fmt.Fprintf(out, "%d_%s\t%s\n", status.Version, status.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+}
@@ -0,0 +1,407 @@
+package fxgorm
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newMigrationDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	manager := NewDatabaseManager(&GormConfig{
+		Database: DatabaseConfig{
+			Type: SQLite,
+			File: filepath.Join(t.TempDir(), "test.db"),
+		},
+		Log: LogConfig{Level: logger.Silent},
+	})
+	if err := manager.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { manager.Close() })
+	return manager.GetDB()
+}
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"1_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);")},
+		"1_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"2_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT;")},
+		"2_add_email.down.sql":    {Data: []byte("ALTER TABLE users DROP COLUMN email;")},
+		"README.md":               {Data: []byte("ignored")},
+	}
+}
+
+// TestMigratorUpAndDown tests applying, reverting and redoing SQL migrations
+func TestMigratorUpAndDown(t *testing.T) {
+	db := newMigrationDB(t)
+	ctx := context.Background()
+	m, err := NewMigrator(db, testMigrations(), MigrationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	if len(applied) != 2 || applied[0].Version != 1 || applied[1].Version != 2 {
+		t.Fatalf("Up should apply both migrations in order, got %v", applied)
+	}
+	if err := db.Exec("INSERT INTO users (name, email) VALUES ('a', 'a@example.com')").Error; err != nil {
+		t.Fatalf("migrated schema should be usable: %v", err)
+	}
+	if applied, err := m.Up(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("second Up should apply nothing, got %v, %v", applied, err)
+	}
+
+	reverted, err := m.Down(ctx)
+	if err != nil || reverted == nil || reverted.Version != 2 {
+		t.Fatalf("Down should revert migration 2, got %v, %v", reverted, err)
+	}
+	if db.Migrator().HasColumn("users", "email") {
+		t.Error("Down should drop the email column")
+	}
+
+	redone, err := m.Redo(ctx)
+	if err != nil || redone == nil || redone.Version != 1 {
+		t.Fatalf("Redo should redo migration 1, got %v, %v", redone, err)
+	}
+	if !db.Migrator().HasTable("users") {
+		t.Error("Redo should recreate the users table")
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil {
+		t.Errorf("status should report 1 applied and 2 pending, got %+v", statuses)
+	}
+
+	if _, err := m.Down(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if reverted, err := m.Down(ctx); err != nil || reverted != nil {
+		t.Errorf("Down without applied migrations should do nothing, got %v, %v", reverted, err)
+	}
+}
+
+// TestMigratorRollsBackFailures tests that a failed migration is not recorded
+func TestMigratorRollsBackFailures(t *testing.T) {
+	db := newMigrationDB(t)
+	source := testMigrations()
+	source["3_broken.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE broken (id INTEGER); INSERT INTO missing VALUES (1);")}
+
+	m, err := NewMigrator(db, source, MigrationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := m.Up(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "3_broken") {
+		t.Fatalf("Up should fail on the broken migration, got %v", err)
+	}
+	if len(applied) != 2 {
+		t.Errorf("migrations before the broken one should stay applied, got %v", applied)
+	}
+	if db.Migrator().HasTable("broken") {
+		t.Error("the broken migration should be rolled back")
+	}
+
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[2].AppliedAt != nil {
+		t.Error("the broken migration should not be recorded")
+	}
+}
+
+// TestMigratorDetectsChanges tests checksum mismatches and missing migrations
+func TestMigratorDetectsChanges(t *testing.T) {
+	db := newMigrationDB(t)
+	ctx := context.Background()
+	m, err := NewMigrator(db, testMigrations(), MigrationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	source := testMigrations()
+	source["1_create_users.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY);")}
+	delete(source, "2_add_email.up.sql")
+	delete(source, "2_add_email.down.sql")
+	m, err = NewMigrator(db, source, MigrationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || !statuses[0].Modified || !statuses[1].Missing {
+		t.Errorf("status should report 1 modified and 2 missing, got %+v", statuses)
+	}
+	if _, err := m.Up(ctx); err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Errorf("Up should refuse modified migrations, got %v", err)
+	}
+	if _, err := m.Down(ctx); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Down should refuse to revert a missing migration, got %v", err)
+	}
+}
+
+// TestMigratorValidatesSources tests duplicate versions and missing up files
+func TestMigratorValidatesSources(t *testing.T) {
+	db := newMigrationDB(t)
+	noop := func(*gorm.DB) error { return nil }
+
+	if _, err := NewMigrator(db, testMigrations(), MigrationConfig{}, NewMigration(2, "seed", noop, noop)); err == nil {
+		t.Error("duplicate versions should be rejected")
+	}
+	source := fstest.MapFS{"1_orphan.down.sql": {Data: []byte("SELECT 1;")}}
+	if _, err := NewMigrator(db, source, MigrationConfig{}); err == nil {
+		t.Error("a migration without an up file should be rejected")
+	}
+}
+
+// TestGoMigrations tests Go migrations ordered among SQL migrations
+func TestGoMigrations(t *testing.T) {
+	db := newMigrationDB(t)
+	ctx := context.Background()
+	seed := NewMigration(3, "seed_users",
+		func(tx *gorm.DB) error {
+			return tx.Exec("INSERT INTO users (name, email) VALUES (?, ?)", "admin", "admin@example.com").Error
+		},
+		func(tx *gorm.DB) error {
+			return tx.Exec("DELETE FROM users WHERE name = ?", "admin").Error
+		},
+	)
+	m, err := NewMigrator(db, testMigrations(), MigrationConfig{}, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	var count int64
+	db.Table("users").Count(&count)
+	if count != 1 {
+		t.Errorf("the Go migration should seed one user, got %d", count)
+	}
+
+	if _, err := m.Down(ctx); err != nil {
+		t.Fatal(err)
+	}
+	db.Table("users").Count(&count)
+	if count != 0 {
+		t.Errorf("reverting the Go migration should delete the user, got %d", count)
+	}
+}
+
+// TestMigratorLock tests that a held lock blocks other migrators until it times out
+func TestMigratorLock(t *testing.T) {
+	db := newMigrationDB(t)
+	m, err := NewMigrator(db, testMigrations(), MigrationConfig{LockTimeout: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ensureTables(db); err != nil {
+		t.Fatal(err)
+	}
+	stale := migrationLock{ID: 1, Owner: "other:1", LockedAt: time.Now()}
+	if err := db.Table(m.lockTable()).Create(&stale).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Up(context.Background()); err == nil || !strings.Contains(err.Error(), "other:1") {
+		t.Fatalf("Up should time out naming the lock owner, got %v", err)
+	}
+	var held int64
+	db.Table(m.lockTable()).Count(&held)
+	if held != 1 {
+		t.Error("a timed out migrator should not release another owner's lock")
+	}
+
+	db.Table(m.lockTable()).Where("id = ?", 1).Delete(&migrationLock{})
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("Up should succeed once the lock is released: %v", err)
+	}
+	db.Table(m.lockTable()).Count(&held)
+	if held != 0 {
+		t.Error("Up should release its lock")
+	}
+}
+
+// TestMigratorSessionLock tests that server databases use a lock of the
+// session, released when a crashed process drops its connection
+func TestMigratorSessionLock(t *testing.T) {
+	for _, dialector := range []gorm.Dialector{
+		postgres.New(postgres.Config{DSN: "host=localhost user=app dbname=app"}),
+		mysql.New(mysql.Config{DSN: "app@tcp(localhost:3306)/app", SkipInitializeWithVersion: true}),
+		sqlserver.Open("sqlserver://app@localhost:1433?database=app"),
+	} {
+		db, err := gorm.Open(dialector, &gorm.Config{DisableAutomaticPing: true, Logger: logger.Discard})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := &Migrator{db: db, config: MigrationConfig{Table: "schema_migrations"}}
+		if m.sessionLock() == nil {
+			t.Errorf("%s should use a session lock", dialector.Name())
+		}
+		_ = closeDatabase(db)
+	}
+
+	m := &Migrator{db: newMigrationDB(t), config: MigrationConfig{Table: "schema_migrations"}}
+	if m.sessionLock() != nil {
+		t.Error("SQLite should fall back to the lock row")
+	}
+}
+
+// TestMigrationsOnStart tests that FxGorm applies migrations on start when enabled
+func TestMigrationsOnStart(t *testing.T) {
+	viper.Set("database.type", "sqlite")
+	viper.Set("database.file", filepath.Join(t.TempDir(), "test.db"))
+	viper.Set("database.log.level", int(logger.Silent))
+	viper.Set("database.migrations.on_start", true)
+	defer viper.Reset()
+
+	var db *gorm.DB
+	app := fxtest.New(t,
+		fx.Provide(newTestConfig),
+		FxGorm,
+		WithMigrations(testMigrations()),
+		fx.Provide(AsMigration(func() *Migration {
+			return NewMigration(3, "seed", func(tx *gorm.DB) error {
+				return tx.Exec("INSERT INTO users (name) VALUES ('admin')").Error
+			}, nil)
+		})),
+		fx.Populate(&db),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	var count int64
+	if err := db.Table("users").Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("migrations should be applied on start, got %d, %v", count, err)
+	}
+}
+
+// TestMigrationConfigLockTimeout tests that lock_timeout takes durations
+// and bare seconds
+func TestMigrationConfigLockTimeout(t *testing.T) {
+	defer viper.Reset()
+	accessor := newTestConfig().Accessor
+	for value, want := range map[any]time.Duration{
+		"30s":  30 * time.Second,
+		"1m":   time.Minute,
+		45:     45 * time.Second,
+		"1.5":  1500 * time.Millisecond,
+		"":     0,
+		nil:    0,
+		"90ms": 90 * time.Millisecond,
+	} {
+		viper.Set("database.migrations.lock_timeout", value)
+		config, err := NewMigrationConfig(accessor)
+		if err != nil {
+			t.Errorf("lock_timeout %v: %v", value, err)
+			continue
+		}
+		if config.LockTimeout != want {
+			t.Errorf("lock_timeout %v = %v, want %v", value, config.LockTimeout, want)
+		}
+	}
+
+	viper.Set("database.migrations.lock_timeout", "soon")
+	if _, err := NewMigrationConfig(accessor); err == nil {
+		t.Error("an invalid lock_timeout should fail")
+	}
+}
+
+// TestMigrationCLI tests the output of the migrate commands
+func TestMigrationCLI(t *testing.T) {
+	db := newMigrationDB(t)
+	ctx := context.Background()
+	m, err := NewMigrator(db, testMigrations(), MigrationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := RunMigrationCLI(ctx, m, "status", &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "1_create_users\tpending") {
+		t.Errorf("status should list pending migrations, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := RunMigrationCLI(ctx, m, "up", &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "applied 1_create_users\napplied 2_add_email\n" {
+		t.Errorf("unexpected up output %q", out.String())
+	}
+
+	out.Reset()
+	if err := RunMigrationCLI(ctx, m, "redo", &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "redone 2_add_email\n" {
+		t.Errorf("unexpected redo output %q", out.String())
+	}
+
+	out.Reset()
+	if err := RunMigrationCLI(ctx, m, "down", &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "reverted 2_add_email\n" {
+		t.Errorf("unexpected down output %q", out.String())
+	}
+
+	if err := RunMigrationCLI(ctx, m, "sideways", &out); err == nil {
+		t.Error("unknown commands should fail")
+	}
+}
+
+// TestCreateMigration tests that create writes an empty up and down pair
+func TestCreateMigration(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "migrations")
+	up, down, err := CreateMigration(dir, "Add Orders Table")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(up, "_add_orders_table.up.sql") || !strings.HasSuffix(down, "_add_orders_table.down.sql") {
+		t.Errorf("unexpected migration files %s, %s", up, down)
+	}
+	for _, file := range []string{up, down} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("migration file should exist: %v", err)
+		}
+	}
+
+	migrations, err := loadMigrations(os.DirFS(dir))
+	if err != nil || len(migrations) != 1 {
+		t.Errorf("created migration should load, got %v, %v", migrations, err)
+	}
+	if _, _, err := CreateMigration(dir, "!!"); err == nil {
+		t.Error("an empty name should be rejected")
+	}
+}
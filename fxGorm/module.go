@@ -1,12 +1,11 @@
 package fxgorm
 
 import (
-	"fmt"
+	"context"
 	"time"
 
 	"go.uber.org/fx"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 // configureConnectionPool configures the connection pool settings
@@ -38,38 +37,11 @@ func (gc *GormConfig) configureConnectionPool(db *gorm.DB) error {
 	return nil
 }
 
-// NewGormDB creates a new GORM database instance with dynamic configuration
-func NewGormDB(p Params) (*gorm.DB, error) {
-	gormConfig := NewGormConfig(p.Config)
-
-	// Set default values for unconfigured settings
-	if gormConfig.Log.Level == 0 {
-		gormConfig.Log.Level = logger.Info
-	}
-	if gormConfig.Log.SlowThreshold == 0 {
-		gormConfig.Log.SlowThreshold = time.Second * 5
-	}
-
-	db, err := gormConfig.openDatabase()
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
-	}
-
-	if err := gormConfig.configureConnectionPool(db); err != nil {
-		return nil, fmt.Errorf("failed to configure connection pool: %w", err)
-	}
-
-	// Test the connection
-	sqlDB, err := db.DB()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get underlying sql.DB: %w", err)
-	}
-
-	if err := sqlDB.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
-	}
-
-	return db, nil
+// NewGormDB returns the database of the manager. It is connected when the
+// app starts, so use it in lifecycle hooks and handlers; queries run from
+// constructors fail with ErrNotConnected.
+func NewGormDB(dm *DatabaseManager) *gorm.DB {
+	return dm.GetDB()
 }
 
 // NewDatabaseManagerWithConfig creates a new database manager with the given configuration
@@ -77,10 +49,30 @@ func NewDatabaseManagerWithConfig(config *GormConfig) *DatabaseManager {
 	return NewDatabaseManager(config)
 }
 
+// NewDatabaseManagerWithLifecycle creates a database manager that connects
+// when the app starts and closes its connections when the app stops
+func NewDatabaseManagerWithLifecycle(p Params) *DatabaseManager {
+	dm := NewDatabaseManagerWithLogger(p.Config, databaseLogger(p.Logger, DefaultDatabase))
+	p.Lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			return dm.Connect(ctx)
+		},
+		OnStop: func(ctx context.Context) error {
+			return dm.Close()
+		},
+	})
+	return dm
+}
+
 // FxGorm provides the GORM module for dependency injection
 var FxGorm = fx.Module(
 	"fxgorm",
 	fx.Provide(NewGormConfig),
+	fx.Provide(NewDatabaseManagerWithLifecycle),
 	fx.Provide(NewGormDB),
-	fx.Provide(NewDatabaseManagerWithConfig),
+	fx.Provide(NewRegistry),
+	fx.Provide(NewTxManager),
+	fx.Invoke(func(*Registry) {}),
+	fx.Provide(NewMigratorWithLifecycle),
+	fx.Invoke(func(*Migrator) {}),
 )
@@ -1,15 +1,15 @@
 package fxgorm
 
 import (
-	"fmt"
-
 	"database/sql"
 )
 
 // GetPoolStats returns current connection pool statistics
 func (dm *DatabaseManager) GetPoolStats() (*sql.DBStats, error) {
-	if dm.db == nil {
-		return nil, fmt.Errorf("database not connected")
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	if !dm.connected {
+		return nil, ErrNotConnected
 	}
 
 	sqlDB, err := dm.db.DB()
@@ -23,8 +23,10 @@ func (dm *DatabaseManager) GetPoolStats() (*sql.DBStats, error) {
 
 // SetPoolConfig updates the connection pool configuration
 func (dm *DatabaseManager) SetPoolConfig(config PoolConfig) error {
-	if dm.db == nil {
-		return fmt.Errorf("database not connected")
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if !dm.connected {
+		return ErrNotConnected
 	}
 
 	sqlDB, err := dm.db.DB()
@@ -46,5 +48,7 @@ func (dm *DatabaseManager) SetPoolConfig(config PoolConfig) error {
 
 // GetPoolConfig returns the current pool configuration
 func (dm *DatabaseManager) GetPoolConfig() PoolConfig {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
 	return dm.config.Pool
 }
@@ -0,0 +1,52 @@
+// Package query describes the list requests accepted by fxgorm
+// repositories. It has no dependencies so that HTTP layers can build
+// queries without importing the database drivers.
+package query
+
+import "errors"
+
+// ErrInvalidQuery reports a filter, sort or cursor that the repository
+// does not accept
+var ErrInvalidQuery = errors.New("invalid query")
+
+// FilterOp is a comparison of a filter
+type FilterOp string
+
+// Filter operators, e.g. ?filter[age][gte]=18
+const (
+	OpEq   FilterOp = "eq"
+	OpNe   FilterOp = "ne"
+	OpGt   FilterOp = "gt"
+	OpGte  FilterOp = "gte"
+	OpLt   FilterOp = "lt"
+	OpLte  FilterOp = "lte"
+	OpLike FilterOp = "like" // contains
+	OpIn   FilterOp = "in"   // comma-separated values
+	OpNull FilterOp = "null" // true or false
+)
+
+// Filter restricts a field. Values are strings converted to the type of
+// the field, as they come from query parameters.
+type Filter struct {
+	Field string
+	Op    FilterOp
+	Value string
+}
+
+// Sort orders by a field
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Query describes a list request. Without Keyset it is paginated with
+// Page and Limit; with Keyset it continues after Cursor, starting from
+// the beginning when Cursor is empty.
+type Query struct {
+	Filters []Filter
+	Sort    []Sort
+	Page    int
+	Limit   int
+	Keyset  bool
+	Cursor  string
+}
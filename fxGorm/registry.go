@@ -0,0 +1,128 @@
+package fxgorm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	fxconfig "github.com/UTOL-s/module/fxConfig"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// DefaultDatabase names the database configured under database
+const DefaultDatabase = "default"
+
+// Registry holds the default database and the named databases configured
+// under databases.<name>, each with its own pool and logging
+type Registry struct {
+	managers map[string]*DatabaseManager
+	names    []string
+}
+
+// RegistryParams holds the dependencies of the registry
+type RegistryParams struct {
+	fx.In
+	Lifecycle fx.Lifecycle
+	Config    *fxconfig.Config
+	Default   *DatabaseManager
+	Logger    *zap.Logger `optional:"true"`
+}
+
+// NewRegistry creates a manager for each named database. Named databases
+// connect when the app starts and close when it stops, like the default.
+func NewRegistry(p RegistryParams) (*Registry, error) {
+	registry := &Registry{
+		managers: map[string]*DatabaseManager{DefaultDatabase: p.Default},
+		names:    []string{DefaultDatabase},
+	}
+
+	named, _ := p.Config.Accessor.Get("databases").(map[string]interface{})
+	names := make([]string, 0, len(named))
+	for name, settings := range named {
+		if settings != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == DefaultDatabase {
+			return nil, fmt.Errorf("databases.%s is reserved, configure the default database under database", DefaultDatabase)
+		}
+		config := NewNamedGormConfig(p.Config.Accessor, name)
+		if err := config.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid databases.%s: %w", name, err)
+		}
+
+		dm := NewDatabaseManagerWithLogger(config, databaseLogger(p.Logger, name))
+		p.Lifecycle.Append(fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				if err := dm.Connect(ctx); err != nil {
+					return fmt.Errorf("failed to connect database %s: %w", name, err)
+				}
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				return dm.Close()
+			},
+		})
+		registry.managers[name] = dm
+		registry.names = append(registry.names, name)
+	}
+	return registry, nil
+}
+
+// Get returns the named database
+func (r *Registry) Get(name string) (*gorm.DB, error) {
+	dm, ok := r.managers[name]
+	if !ok {
+		return nil, fmt.Errorf("database %q is not configured", name)
+	}
+	return dm.GetDB(), nil
+}
+
+// Manager returns the manager of the named database
+func (r *Registry) Manager(name string) (*DatabaseManager, bool) {
+	dm, ok := r.managers[name]
+	return dm, ok
+}
+
+// Names returns the database names, the default database first
+func (r *Registry) Names() []string {
+	return append([]string(nil), r.names...)
+}
+
+// Ping checks every database, returning the error of each unhealthy one
+func (r *Registry) Ping(ctx context.Context) map[string]error {
+	failed := make(map[string]error)
+	for _, name := range r.names {
+		if err := r.managers[name].Ping(ctx); err != nil {
+			failed[name] = err
+		}
+	}
+	return failed
+}
+
+// Named provides the named databases as *gorm.DB and *DatabaseManager
+// values tagged `name:"<name>"`, e.g. fxgorm.Named("reporting")
+func Named(names ...string) fx.Option {
+	options := make([]fx.Option, 0, len(names))
+	for _, name := range names {
+		tag := fmt.Sprintf(`name:"%s"`, name)
+		options = append(options, fx.Provide(
+			fx.Annotate(func(r *Registry) (*gorm.DB, error) {
+				return r.Get(name)
+			}, fx.ResultTags(tag)),
+			fx.Annotate(func(r *Registry) (*DatabaseManager, error) {
+				dm, ok := r.Manager(name)
+				if !ok {
+					return nil, fmt.Errorf("database %q is not configured", name)
+				}
+				return dm, nil
+			}, fx.ResultTags(tag)),
+		))
+	}
+	return fx.Options(options...)
+}
@@ -0,0 +1,83 @@
+package fxgorm
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestRegistry tests named databases next to the default database
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	viper.Set("database.type", "sqlite")
+	viper.Set("database.file", filepath.Join(dir, "app.db"))
+	viper.Set("database.log.level", int(logger.Silent))
+	viper.Set("databases.reporting.type", "sqlite")
+	viper.Set("databases.reporting.file", filepath.Join(dir, "reporting.db"))
+	viper.Set("databases.reporting.pool.max_open_conns", 3)
+	viper.Set("databases.reporting.log.level", int(logger.Silent))
+	defer viper.Reset()
+
+	var params struct {
+		fx.In
+		Default   *gorm.DB
+		Reporting *gorm.DB         `name:"reporting"`
+		Manager   *DatabaseManager `name:"reporting"`
+		Registry  *Registry
+	}
+	app := fxtest.New(t,
+		fx.Provide(newTestConfig),
+		FxGorm,
+		Named("reporting"),
+		fx.Populate(&params),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	if got := params.Registry.Names(); len(got) != 2 || got[0] != DefaultDatabase || got[1] != "reporting" {
+		t.Fatalf("Names() = %v", got)
+	}
+	if params.Default == params.Reporting {
+		t.Fatal("named database should have its own connection")
+	}
+	reporting, err := params.Registry.Get("reporting")
+	if err != nil || reporting != params.Reporting {
+		t.Fatalf("Get(reporting) = %v, %v", reporting, err)
+	}
+	if _, err := params.Registry.Get("missing"); err == nil {
+		t.Error("Get should fail for unknown databases")
+	}
+
+	if err := params.Reporting.Exec("CREATE TABLE reports (id INTEGER PRIMARY KEY)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if params.Default.Migrator().HasTable("reports") {
+		t.Error("default database should not see tables of the reporting database")
+	}
+	if got := params.Manager.GetPoolConfig().MaxOpenConns; got != 3 {
+		t.Errorf("reporting MaxOpenConns = %d, want 3", got)
+	}
+	if failed := params.Registry.Ping(context.Background()); len(failed) != 0 {
+		t.Errorf("Ping() = %v", failed)
+	}
+}
+
+// TestRegistryRejectsInvalidConfig tests validation of named databases
+func TestRegistryRejectsInvalidConfig(t *testing.T) {
+	viper.Set("database.type", "sqlite")
+	viper.Set("database.file", filepath.Join(t.TempDir(), "app.db"))
+	viper.Set("databases.reporting.type", "sqlite")
+	defer viper.Reset()
+
+	app := fx.New(fx.NopLogger, fx.Provide(newTestConfig), FxGorm)
+	if err := app.Err(); err == nil || !strings.Contains(err.Error(), "invalid databases.reporting") {
+		t.Errorf("app.Err() = %v", err)
+	}
+}
@@ -0,0 +1,341 @@
+package fxgorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/plugin/dbresolver"
+)
+
+// Replica policies for database.replica_policy
+const (
+	ReplicaPolicyRoundRobin = "round_robin"
+	ReplicaPolicyRandom     = "random"
+)
+
+// ReplicaConfig holds read replica configuration
+type ReplicaConfig struct {
+	// Replicas override the connection settings of the primary, so
+	// usually only the host differs
+	Replicas []DatabaseConfig `mapstructure:"replicas"`
+	// Policy picks a healthy replica for each read, round_robin or random
+	Policy string `mapstructure:"replica_policy"`
+	// HealthCheckInterval is how often replicas are pinged
+	HealthCheckInterval time.Duration `mapstructure:"replica_health_interval"`
+	// PrimaryTables are always read from the primary
+	PrimaryTables []string `mapstructure:"primary_tables"`
+}
+
+// ReplicaStatus reports the health of a read replica
+type ReplicaStatus struct {
+	Host    string
+	Healthy bool
+	Error   error
+}
+
+// replicaConfig returns the configuration of a replica, inheriting unset
+// settings from the primary
+func (gc *GormConfig) replicaConfig(replica DatabaseConfig) *GormConfig {
+	config := *gc
+	config.Replication = ReplicaConfig{}
+	database := gc.Database
+	if replica.Host != "" {
+		database.Host = replica.Host
+	}
+	if replica.Port != 0 {
+		database.Port = replica.Port
+	}
+	if replica.User != "" {
+		database.User = replica.User
+	}
+	if replica.Password != "" {
+		database.Password = replica.Password
+	}
+	if replica.DBName != "" {
+		database.DBName = replica.DBName
+	}
+	if replica.SSLMode != "" {
+		database.SSLMode = replica.SSLMode
+	}
+	if replica.SSLRootCert != "" {
+		database.SSLRootCert = replica.SSLRootCert
+	}
+	if replica.SSLCert != "" {
+		database.SSLCert = replica.SSLCert
+		database.SSLKey = replica.SSLKey
+	}
+	if len(replica.Params) > 0 {
+		database.Params = maps.Clone(database.Params)
+		if database.Params == nil {
+			database.Params = make(map[string]string, len(replica.Params))
+		}
+		maps.Copy(database.Params, replica.Params)
+	}
+	// A DSN of the primary would connect the replica to the primary
+	database.DSN = replica.DSN
+	if replica.File != "" {
+		database.File = replica.File
+	}
+	config.Database = database
+	return &config
+}
+
+// replicaHost describes a replica in statuses and logs
+func replicaHost(config DatabaseConfig) string {
+	if config.Type == SQLite && config.File != "" {
+		return config.File
+	}
+	if config.Host == "" && config.DSN != "" {
+		// The DSN is not logged, it may hold the password
+		return string(config.Type) + " dsn"
+	}
+	return fmt.Sprintf("%s:%d", config.Host, config.Port)
+}
+
+// replicaSet routes reads to healthy replicas through dbresolver and
+// falls back to the primary when none is healthy or a read cannot reach
+// its replica
+type replicaSet struct {
+	resolver *dbresolver.DBResolver
+	primary  gorm.ConnPool
+	replicas []gorm.ConnPool
+	hosts    []string
+	random   bool
+	next     atomic.Uint64
+
+	mu     sync.RWMutex
+	errors map[gorm.ConnPool]error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// openReplicas registers the replicas on db. Writes, transactions and
+// locking reads stay on the primary.
+func (gc *GormConfig) openReplicas(db *gorm.DB) (*replicaSet, error) {
+	set := &replicaSet{
+		primary: db.ConnPool,
+		random:  gc.Replication.Policy == ReplicaPolicyRandom,
+		errors:  make(map[gorm.ConnPool]error),
+	}
+
+	dialectors := make([]gorm.Dialector, 0, len(gc.Replication.Replicas))
+	for _, replica := range gc.Replication.Replicas {
+		config := gc.replicaConfig(replica)
+		dialector, err := config.dialector(true)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replica %s: %w", replicaHost(config.Database), err)
+		}
+		dialectors = append(dialectors, dialector)
+		set.hosts = append(set.hosts, replicaHost(config.Database))
+	}
+
+	set.resolver = dbresolver.Register(dbresolver.Config{Replicas: dialectors, Policy: set})
+	if err := db.Use(set.resolver); err != nil {
+		return nil, fmt.Errorf("failed to register replicas: %w", err)
+	}
+	_ = set.resolver.Call(func(pool gorm.ConnPool) error {
+		if pool != set.primary {
+			set.replicas = append(set.replicas, pool)
+		}
+		return nil
+	})
+
+	// dbresolver skips the policy with a single replica, so fall back here too
+	fallback := func(tx *gorm.DB) {
+		if pool := tx.Statement.ConnPool; pool != set.primary && !set.healthy(pool) {
+			tx.Statement.ConnPool = set.primary
+		}
+	}
+	for _, err := range []error{
+		db.Callback().Query().After("gorm:db_resolver").Before("gorm:query").Register("fxgorm:replica_fallback", fallback),
+		db.Callback().Row().After("gorm:db_resolver").Before("gorm:row").Register("fxgorm:replica_fallback", fallback),
+		db.Callback().Raw().After("gorm:db_resolver").Before("gorm:raw").Register("fxgorm:replica_fallback", fallback),
+		db.Callback().Query().After("gorm:query").Before("gorm:preload").Register("fxgorm:replica_retry", set.retryOnPrimary(callbacks.Query)),
+		db.Callback().Row().After("gorm:row").Register("fxgorm:replica_retry", set.retryOnPrimary(callbacks.RowQuery)),
+		db.Callback().Raw().After("gorm:raw").Register("fxgorm:replica_retry", set.retryOnPrimary(callbacks.RawExec)),
+	} {
+		if err != nil {
+			return nil, fmt.Errorf("failed to register replica fallback: %w", err)
+		}
+	}
+
+	if len(gc.Replication.PrimaryTables) > 0 {
+		set.usePrimary(toInterfaces(gc.Replication.PrimaryTables)...)
+	}
+	return set, nil
+}
+
+// Resolve implements dbresolver.Policy, picking among healthy replicas
+func (s *replicaSet) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	healthy := make([]gorm.ConnPool, 0, len(pools))
+	for _, pool := range pools {
+		if s.healthy(pool) {
+			healthy = append(healthy, pool)
+		}
+	}
+	if len(healthy) == 0 {
+		return s.primary
+	}
+	if s.random {
+		return healthy[rand.IntN(len(healthy))]
+	}
+	return healthy[s.next.Add(1)%uint64(len(healthy))]
+}
+
+// retryOnPrimary returns a callback marking a replica unhealthy when a
+// read fails to reach it and running the read once more on the primary
+// with run, until the next health check
+func (s *replicaSet) retryOnPrimary(run func(*gorm.DB)) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		err := tx.Error
+		// Row defers the error of the query to Scan
+		if row, ok := tx.Statement.Dest.(*sql.Row); ok && err == nil && row != nil {
+			err = row.Err()
+		}
+		pool := tx.Statement.ConnPool
+		if err == nil || pool == s.primary || !connectionError(err) || !s.fail(pool, err) {
+			return
+		}
+		// Rows() marks its statement, the setting is consumed by the first run
+		if _, ok := tx.Statement.Dest.(*sql.Rows); ok {
+			tx.Statement.Settings.Store("rows", true)
+		}
+		tx.Error = nil
+		tx.Statement.ConnPool = s.primary
+		run(tx)
+	}
+}
+
+// fail records the error of a replica, reporting whether pool is one
+func (s *replicaSet) fail(pool gorm.ConnPool, err error) bool {
+	if prepared, ok := pool.(*gorm.PreparedStmtDB); ok {
+		pool = prepared.ConnPool
+	}
+	if !slices.Contains(s.replicas, pool) {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[pool] = err
+	return true
+}
+
+// connectionError reports whether err means the server could not be
+// reached, rather than the query failing
+func connectionError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.As(err, &netErr)
+}
+
+// usePrimary routes reads of the given models or tables to the primary
+func (s *replicaSet) usePrimary(tables ...interface{}) {
+	// Without replicas dbresolver reads from the sources, i.e. the primary
+	s.resolver.Register(dbresolver.Config{}, tables...)
+}
+
+// healthy reports whether the last health check of pool succeeded; pools
+// other than replicas are always healthy
+func (s *replicaSet) healthy(pool gorm.ConnPool) bool {
+	if prepared, ok := pool.(*gorm.PreparedStmtDB); ok {
+		pool = prepared.ConnPool
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.errors[pool] == nil
+}
+
+// check pings every replica, recording the failures
+func (s *replicaSet) check(ctx context.Context) {
+	for _, pool := range s.replicas {
+		var err error
+		if pinger, ok := pool.(interface{ PingContext(context.Context) error }); ok {
+			err = pinger.PingContext(ctx)
+		}
+		s.mu.Lock()
+		if err != nil {
+			s.errors[pool] = err
+		} else {
+			delete(s.errors, pool)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// start checks the replicas every interval until close
+func (s *replicaSet) start(interval time.Duration) {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				s.check(ctx)
+				cancel()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// status returns the health of each replica
+func (s *replicaSet) status() []ReplicaStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	statuses := make([]ReplicaStatus, 0, len(s.replicas))
+	for i, pool := range s.replicas {
+		err := s.errors[pool]
+		statuses = append(statuses, ReplicaStatus{Host: s.hosts[i], Healthy: err == nil, Error: err})
+	}
+	return statuses
+}
+
+// close stops the health checks and closes the replica connections
+func (s *replicaSet) close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+	var errs []error
+	for _, pool := range s.replicas {
+		if closer, ok := pool.(interface{ Close() error }); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// toInterfaces converts table names for dbresolver.Register
+func toInterfaces(tables []string) []interface{} {
+	values := make([]interface{}, len(tables))
+	for i, table := range tables {
+		values[i] = table
+	}
+	return values
+}
@@ -0,0 +1,252 @@
+package fxgorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type replicaItem struct {
+	ID   uint
+	Name string
+}
+
+// seedDatabase creates a database file holding a single item
+func seedDatabase(t *testing.T, file, name string) {
+	manager := NewDatabaseManager(&GormConfig{
+		Database: DatabaseConfig{Type: SQLite, File: file},
+		Log:      LogConfig{Level: logger.Silent},
+	})
+	if err := manager.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+	db := manager.GetDB()
+	if err := db.AutoMigrate(&replicaItem{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&replicaItem{Name: name}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func itemNames(t *testing.T, db *gorm.DB) []string {
+	var names []string
+	if err := db.Model(&replicaItem{}).Order("id").Pluck("name", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+// TestReplicas tests read/write splitting and fallback to the primary
+func TestReplicas(t *testing.T) {
+	dir := t.TempDir()
+	seedDatabase(t, filepath.Join(dir, "primary.db"), "primary")
+	seedDatabase(t, filepath.Join(dir, "replica.db"), "replica")
+
+	viper.Set("database.type", "sqlite")
+	viper.Set("database.file", filepath.Join(dir, "primary.db"))
+	viper.Set("database.log.level", int(logger.Silent))
+	viper.Set("database.replicas", []map[string]interface{}{{"file": filepath.Join(dir, "replica.db")}})
+	viper.Set("database.replica_health_interval", 3600)
+	defer viper.Reset()
+
+	var db *gorm.DB
+	var manager *DatabaseManager
+	app := fxtest.New(t, fx.Provide(newTestConfig), FxGorm, fx.Populate(&db, &manager))
+	app.RequireStart()
+	defer app.RequireStop()
+
+	if got := itemNames(t, db); len(got) != 1 || got[0] != "replica" {
+		t.Errorf("reads should use the replica, got %v", got)
+	}
+
+	// Writes and transactions use the primary
+	if err := db.Create(&replicaItem{Name: "written"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if got := itemNames(t, tx); len(got) != 2 {
+			t.Errorf("transactions should read from the primary, got %v", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := manager.ReplicaStatus()
+	if len(status) != 1 || !status[0].Healthy || status[0].Host != filepath.Join(dir, "replica.db") {
+		t.Fatalf("ReplicaStatus() = %+v", status)
+	}
+
+	// A replica failing its health check is skipped
+	if err := manager.replicas.replicas[0].(interface{ Close() error }).Close(); err != nil {
+		t.Fatal(err)
+	}
+	manager.replicas.check(context.Background())
+	if status := manager.ReplicaStatus(); status[0].Healthy || status[0].Error == nil {
+		t.Errorf("closed replica should be unhealthy, got %+v", status)
+	}
+	if got := itemNames(t, db); len(got) != 2 || got[1] != "written" {
+		t.Errorf("reads should fall back to the primary, got %v", got)
+	}
+}
+
+// TestReplicasUsePrimary tests tables pinned to the primary
+func TestReplicasUsePrimary(t *testing.T) {
+	dir := t.TempDir()
+	seedDatabase(t, filepath.Join(dir, "primary.db"), "primary")
+	seedDatabase(t, filepath.Join(dir, "replica.db"), "replica")
+
+	manager := NewDatabaseManager(&GormConfig{
+		Database: DatabaseConfig{Type: SQLite, File: filepath.Join(dir, "primary.db")},
+		Log:      LogConfig{Level: logger.Silent},
+		Replication: ReplicaConfig{
+			Replicas: []DatabaseConfig{{File: filepath.Join(dir, "replica.db")}},
+			Policy:   ReplicaPolicyRandom,
+		},
+	})
+	manager.UsePrimary(&replicaItem{})
+	if err := manager.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	if got := itemNames(t, manager.GetDB()); len(got) != 1 || got[0] != "primary" {
+		t.Errorf("pinned model should be read from the primary, got %v", got)
+	}
+}
+
+// failingConnector connects to a replica whose server cannot be reached
+type failingConnector struct{}
+
+func (failingConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, driver.ErrBadConn
+}
+
+func (failingConnector) Driver() driver.Driver {
+	return failingDriver{}
+}
+
+type failingDriver struct{}
+
+func (failingDriver) Open(string) (driver.Conn, error) {
+	return nil, driver.ErrBadConn
+}
+
+// TestReplicaReadRetry tests that a read failing to reach its replica
+// marks it unhealthy and is retried on the primary
+func TestReplicaReadRetry(t *testing.T) {
+	dir := t.TempDir()
+	seedDatabase(t, filepath.Join(dir, "primary.db"), "primary")
+	seedDatabase(t, filepath.Join(dir, "replica.db"), "replica")
+
+	manager := NewDatabaseManager(&GormConfig{
+		Database:    DatabaseConfig{Type: SQLite, File: filepath.Join(dir, "primary.db")},
+		Log:         LogConfig{Level: logger.Silent},
+		Replication: ReplicaConfig{Replicas: []DatabaseConfig{{File: filepath.Join(dir, "replica.db")}}},
+	})
+	if err := manager.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	// Reads routed to the replica reach an unreachable server instead
+	set := manager.replicas
+	failingDB := sql.OpenDB(failingConnector{})
+	defer failingDB.Close()
+	var failing gorm.ConnPool = failingDB
+	set.replicas = append(set.replicas, failing)
+	set.hosts = append(set.hosts, "unreachable")
+	db := manager.GetDB()
+	unreachable := func(tx *gorm.DB) {
+		if tx.Statement.ConnPool != set.primary {
+			tx.Statement.ConnPool = failing
+		}
+	}
+	// The replica callbacks are registered on the connection
+	callbacks := manager.conn.Load().Callback()
+	for _, err := range []error{
+		callbacks.Query().After("fxgorm:replica_fallback").Before("gorm:query").Register("test:unreachable", unreachable),
+		callbacks.Row().After("fxgorm:replica_fallback").Before("gorm:row").Register("test:unreachable", unreachable),
+		callbacks.Raw().After("fxgorm:replica_fallback").Before("gorm:raw").Register("test:unreachable", unreachable),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	resetHealth := func() {
+		set.mu.Lock()
+		defer set.mu.Unlock()
+		delete(set.errors, failing)
+	}
+
+	if got := itemNames(t, db); len(got) != 1 || got[0] != "primary" {
+		t.Errorf("the read should be retried on the primary, got %v", got)
+	}
+	if set.healthy(failing) {
+		t.Error("the unreachable replica should be marked unhealthy")
+	}
+	if status := manager.ReplicaStatus(); status[0].Healthy != true || status[1].Healthy {
+		t.Errorf("ReplicaStatus() = %+v", status)
+	}
+
+	// Row, Rows and raw reads are retried on the primary too
+	resetHealth()
+	var name string
+	if err := db.Model(&replicaItem{}).Select("name").Row().Scan(&name); err != nil || name != "primary" {
+		t.Errorf("Row() = %q, %v; want the primary", name, err)
+	}
+	if set.healthy(failing) {
+		t.Error("Row() should mark the unreachable replica unhealthy")
+	}
+	resetHealth()
+	rows, err := db.Model(&replicaItem{}).Select("name").Rows()
+	if err != nil {
+		t.Fatalf("Rows() should be retried on the primary: %v", err)
+	}
+	for rows.Next() {
+		if err := rows.Scan(&name); err != nil || name != "primary" {
+			t.Errorf("Rows() = %q, %v; want the primary", name, err)
+		}
+	}
+	rows.Close()
+	resetHealth()
+	if err := db.Exec("SELECT name FROM replica_items").Error; err != nil {
+		t.Errorf("raw reads should be retried on the primary: %v", err)
+	}
+	if set.healthy(failing) {
+		t.Error("raw reads should mark the unreachable replica unhealthy")
+	}
+
+	// Query errors do not mark replicas unhealthy
+	if connectionError(errors.New("no such table: missing")) {
+		t.Error("query errors are not connection errors")
+	}
+	if !connectionError(fmt.Errorf("read: %w", syscall.ECONNRESET)) {
+		t.Error("reset connections are connection errors")
+	}
+}
+
+// TestReplicaPolicyValidation tests the replica policy validation
+func TestReplicaPolicyValidation(t *testing.T) {
+	config := &GormConfig{
+		Database:    DatabaseConfig{Type: SQLite, File: "./test.db"},
+		Replication: ReplicaConfig{Policy: "fastest"},
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("Validate() should reject unknown replica policies")
+	}
+}
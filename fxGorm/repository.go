@@ -0,0 +1,458 @@
+package fxgorm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UTOL-s/module/fxGorm/query"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrInvalidQuery reports a filter, sort or cursor that the repository
+// does not accept
+var ErrInvalidQuery = query.ErrInvalidQuery
+
+// The list request types live in the query package, which HTTP layers
+// import without the database drivers
+type (
+	Query    = query.Query
+	Filter   = query.Filter
+	Sort     = query.Sort
+	FilterOp = query.FilterOp
+)
+
+// Filter operators, e.g. ?filter[age][gte]=18
+const (
+	OpEq   = query.OpEq
+	OpNe   = query.OpNe
+	OpGt   = query.OpGt
+	OpGte  = query.OpGte
+	OpLt   = query.OpLt
+	OpLte  = query.OpLte
+	OpLike = query.OpLike
+	OpIn   = query.OpIn
+	OpNull = query.OpNull
+)
+
+// Page is a page of results. Total and Page are set for offset
+// pagination, NextCursor for keyset pagination when more items follow.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total,omitempty"`
+	Page       int    `json:"page,omitempty"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// RepositoryConfig configures a repository
+type RepositoryConfig struct {
+	// Fields whitelists the columns clients may filter and sort by
+	Fields []string
+	// DefaultSort applies when a query has no sort, by primary key otherwise
+	DefaultSort []Sort
+	// DefaultLimit is the page size when a query has none, 20 by default
+	DefaultLimit int
+	// MaxLimit caps the page size, 100 by default
+	MaxLimit int
+}
+
+// Repository implements CRUD and listing for the model T. It runs in the
+// transaction of the context when called within TxManager.WithinTx.
+type Repository[T any] struct {
+	tx     *TxManager
+	config RepositoryConfig
+
+	once    sync.Once
+	schema  *schema.Schema
+	fields  map[string]*schema.Field
+	initErr error
+}
+
+// NewRepository creates a repository for T
+func NewRepository[T any](tx *TxManager, config RepositoryConfig) *Repository[T] {
+	if config.DefaultLimit == 0 {
+		config.DefaultLimit = 20
+	}
+	if config.MaxLimit == 0 {
+		config.MaxLimit = 100
+	}
+	return &Repository[T]{tx: tx, config: config}
+}
+
+// DB returns the database of the repository for custom queries, bound to
+// the transaction of ctx if any
+func (r *Repository[T]) DB(ctx context.Context) *gorm.DB {
+	return r.tx.DB(ctx).Model(new(T))
+}
+
+// Get returns the item with the given primary key, or gorm.ErrRecordNotFound
+func (r *Repository[T]) Get(ctx context.Context, id any) (*T, error) {
+	var item T
+	if err := r.tx.DB(ctx).Where(clause.Eq{Column: clause.PrimaryColumn, Value: id}).Take(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Create inserts an item, filling in its generated fields
+func (r *Repository[T]) Create(ctx context.Context, item *T) error {
+	return r.tx.DB(ctx).Create(item).Error
+}
+
+// Update saves all fields of an existing item, returning
+// gorm.ErrRecordNotFound when it does not exist
+func (r *Repository[T]) Update(ctx context.Context, item *T) error {
+	result := r.tx.DB(ctx).Model(item).Select("*").Omit(clause.Associations).Updates(item)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// MySQL does not count rows whose values did not change
+		primary := result.Statement.Schema.PrioritizedPrimaryField
+		id, zero := primary.ValueOf(ctx, reflect.ValueOf(item).Elem())
+		if zero {
+			return gorm.ErrRecordNotFound
+		}
+		return r.tx.DB(ctx).Select(primary.DBName).Where(clause.Eq{Column: clause.PrimaryColumn, Value: id}).Take(new(T)).Error
+	}
+	return nil
+}
+
+// Upsert inserts an item or updates it when it conflicts on the given
+// columns, the primary key by default
+func (r *Repository[T]) Upsert(ctx context.Context, item *T, conflict ...string) error {
+	onConflict := clause.OnConflict{UpdateAll: true}
+	for _, column := range conflict {
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: column})
+	}
+	return r.tx.DB(ctx).Clauses(onConflict).Create(item).Error
+}
+
+// Delete deletes the item with the given primary key, returning
+// gorm.ErrRecordNotFound when it does not exist
+func (r *Repository[T]) Delete(ctx context.Context, id any) error {
+	result := r.tx.DB(ctx).Where(clause.Eq{Column: clause.PrimaryColumn, Value: id}).Delete(new(T))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// List returns a page of items matching the query
+func (r *Repository[T]) List(ctx context.Context, q Query) (*Page[T], error) {
+	if err := r.init(); err != nil {
+		return nil, err
+	}
+
+	db := r.tx.DB(ctx).Model(new(T))
+	db, err := r.applyFilters(db, q.Filters)
+	if err != nil {
+		return nil, err
+	}
+	sorts, err := r.sorts(q.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = r.config.DefaultLimit
+	}
+	limit = min(limit, r.config.MaxLimit)
+	page := &Page[T]{Limit: limit}
+
+	if q.Keyset {
+		return r.listKeyset(db, q.Cursor, sorts, page)
+	}
+
+	if err := db.Session(&gorm.Session{}).Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+	// Larger pages would overflow the offset
+	if q.Page > math.MaxInt/limit {
+		return nil, fmt.Errorf("%w: page %d is out of range", ErrInvalidQuery, q.Page)
+	}
+	page.Page = max(q.Page, 1)
+	for _, s := range sorts {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: s.Field}, Desc: s.Desc})
+	}
+	if err := db.Offset((page.Page - 1) * limit).Limit(limit).Find(&page.Items).Error; err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// listKeyset returns the items after the cursor, fetching one more item
+// to tell whether another page follows
+func (r *Repository[T]) listKeyset(db *gorm.DB, cursor string, sorts []Sort, page *Page[T]) (*Page[T], error) {
+	spec := sortSpec(sorts)
+	if cursor != "" {
+		values, err := r.decodeCursor(cursor, spec, sorts)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(keysetCondition(sorts, values))
+	}
+	for _, s := range sorts {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: s.Field}, Desc: s.Desc})
+	}
+	if err := db.Limit(page.Limit + 1).Find(&page.Items).Error; err != nil {
+		return nil, err
+	}
+
+	if len(page.Items) > page.Limit {
+		page.Items = page.Items[:page.Limit]
+		next, err := r.encodeCursor(db.Statement.Context, &page.Items[page.Limit-1], spec, sorts)
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = next
+	}
+	return page, nil
+}
+
+// init parses the schema of T and checks the whitelisted fields
+func (r *Repository[T]) init() error {
+	r.once.Do(func() {
+		stmt := &gorm.Statement{DB: r.tx.db}
+		if err := stmt.Parse(new(T)); err != nil {
+			r.initErr = fmt.Errorf("failed to parse model: %w", err)
+			return
+		}
+		r.schema = stmt.Schema
+		if r.schema.PrioritizedPrimaryField == nil {
+			r.initErr = fmt.Errorf("model %s has no primary key", r.schema.Name)
+			return
+		}
+		r.fields = make(map[string]*schema.Field, len(r.config.Fields))
+		for _, name := range r.config.Fields {
+			field := r.schema.LookUpField(name)
+			if field == nil || field.DBName == "" {
+				r.initErr = fmt.Errorf("model %s has no column %s", r.schema.Name, name)
+				return
+			}
+			r.fields[name] = field
+		}
+		for _, s := range r.config.DefaultSort {
+			if _, ok := r.fields[s.Field]; !ok {
+				r.initErr = fmt.Errorf("default sort field %s is not whitelisted", s.Field)
+				return
+			}
+		}
+	})
+	return r.initErr
+}
+
+// field returns the whitelisted field for a query field name
+func (r *Repository[T]) field(name string) (*schema.Field, error) {
+	field, ok := r.fields[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown field %s", ErrInvalidQuery, name)
+	}
+	return field, nil
+}
+
+// applyFilters adds the filters to db, converting values to field types
+func (r *Repository[T]) applyFilters(db *gorm.DB, filters []Filter) (*gorm.DB, error) {
+	for _, f := range filters {
+		field, err := r.field(f.Field)
+		if err != nil {
+			return nil, err
+		}
+		column := clause.Column{Name: field.DBName}
+
+		var expr clause.Expression
+		switch f.Op {
+		case OpIn:
+			raw := strings.Split(f.Value, ",")
+			values := make([]any, len(raw))
+			for i, v := range raw {
+				if values[i], err = convertValue(field, v); err != nil {
+					return nil, err
+				}
+			}
+			expr = clause.IN{Column: column, Values: values}
+		case OpNull:
+			isNull, err := strconv.ParseBool(f.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s[null] must be true or false", ErrInvalidQuery, f.Field)
+			}
+			if isNull {
+				expr = clause.Eq{Column: column, Value: nil}
+			} else {
+				expr = clause.Neq{Column: column, Value: nil}
+			}
+		case OpLike:
+			if field.DataType != schema.String {
+				return nil, fmt.Errorf("%w: %s does not support like", ErrInvalidQuery, f.Field)
+			}
+			// '!' escapes the same way in every database, unlike a backslash
+			escaped := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(f.Value)
+			expr = clause.Expr{SQL: "? LIKE ? ESCAPE '!'", Vars: []any{column, "%" + escaped + "%"}}
+		default:
+			value, err := convertValue(field, f.Value)
+			if err != nil {
+				return nil, err
+			}
+			switch f.Op {
+			case OpEq, "":
+				expr = clause.Eq{Column: column, Value: value}
+			case OpNe:
+				expr = clause.Neq{Column: column, Value: value}
+			case OpGt:
+				expr = clause.Gt{Column: column, Value: value}
+			case OpGte:
+				expr = clause.Gte{Column: column, Value: value}
+			case OpLt:
+				expr = clause.Lt{Column: column, Value: value}
+			case OpLte:
+				expr = clause.Lte{Column: column, Value: value}
+			default:
+				return nil, fmt.Errorf("%w: unknown operator %s", ErrInvalidQuery, f.Op)
+			}
+		}
+		db = db.Where(expr)
+	}
+	return db, nil
+}
+
+// sorts validates the requested order, defaulting to the configured one,
+// and appends the primary key so that the order is total
+func (r *Repository[T]) sorts(requested []Sort) ([]Sort, error) {
+	if len(requested) == 0 {
+		requested = r.config.DefaultSort
+	}
+	primary := r.schema.PrioritizedPrimaryField.DBName
+	sorts := make([]Sort, 0, len(requested)+1)
+	for _, s := range requested {
+		field, err := r.field(s.Field)
+		if err != nil {
+			return nil, err
+		}
+		sorts = append(sorts, Sort{Field: field.DBName, Desc: s.Desc})
+	}
+	if !slices.ContainsFunc(sorts, func(s Sort) bool { return s.Field == primary }) {
+		sorts = append(sorts, Sort{Field: primary})
+	}
+	return sorts, nil
+}
+
+// keysetCondition selects the rows after values in the given order:
+// (a > ?) OR (a = ? AND b > ?) OR ...
+func keysetCondition(sorts []Sort, values []any) clause.Expression {
+	alternatives := make([]clause.Expression, 0, len(sorts))
+	for i, s := range sorts {
+		conditions := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			conditions = append(conditions, clause.Eq{Column: clause.Column{Name: sorts[j].Field}, Value: values[j]})
+		}
+		column := clause.Column{Name: s.Field}
+		if s.Desc {
+			conditions = append(conditions, clause.Lt{Column: column, Value: values[i]})
+		} else {
+			conditions = append(conditions, clause.Gt{Column: column, Value: values[i]})
+		}
+		alternatives = append(alternatives, clause.And(conditions...))
+	}
+	return clause.Or(alternatives...)
+}
+
+// keysetCursor is the decoded form of a cursor
+type keysetCursor struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+// sortSpec renders the order a cursor belongs to, e.g. "-created_at,id"
+func sortSpec(sorts []Sort) string {
+	parts := make([]string, len(sorts))
+	for i, s := range sorts {
+		parts[i] = s.Field
+		if s.Desc {
+			parts[i] = "-" + s.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// encodeCursor encodes the sort values of the last item of a page
+func (r *Repository[T]) encodeCursor(ctx context.Context, item *T, spec string, sorts []Sort) (string, error) {
+	cursor := keysetCursor{Sort: spec}
+	for _, s := range sorts {
+		value, _ := r.schema.LookUpField(s.Field).ValueOf(ctx, reflect.ValueOf(item).Elem())
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode cursor: %w", err)
+		}
+		cursor.Values = append(cursor.Values, raw)
+	}
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor decodes the sort values of a cursor into the field types
+func (r *Repository[T]) decodeCursor(encoded, spec string, sorts []Sort) ([]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var cursor keysetCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || len(cursor.Values) != len(sorts) {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if cursor.Sort != spec {
+		return nil, fmt.Errorf("%w: cursor does not match the sort order", ErrInvalidQuery)
+	}
+
+	values := make([]any, len(sorts))
+	for i, s := range sorts {
+		value := reflect.New(r.schema.LookUpField(s.Field).FieldType)
+		if err := json.Unmarshal(cursor.Values[i], value.Interface()); err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+		}
+		values[i] = value.Elem().Interface()
+	}
+	return values, nil
+}
+
+// convertValue converts a filter value to the type of the field so that
+// it compares correctly in every database
+func convertValue(field *schema.Field, raw string) (any, error) {
+	var value any
+	var err error
+	switch field.DataType {
+	case schema.Bool:
+		value, err = strconv.ParseBool(raw)
+	case schema.Int:
+		value, err = strconv.ParseInt(raw, 10, 64)
+	case schema.Uint:
+		value, err = strconv.ParseUint(raw, 10, 64)
+	case schema.Float:
+		value, err = strconv.ParseFloat(raw, 64)
+	case schema.Time:
+		value, err = time.Parse(time.RFC3339, raw)
+	default:
+		value = raw
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid value %q for %s", ErrInvalidQuery, raw, field.DBName)
+	}
+	return value, nil
+}
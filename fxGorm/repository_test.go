@@ -0,0 +1,245 @@
+package fxgorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type product struct {
+	ID        uint
+	SKU       string `gorm:"uniqueIndex"`
+	Name      string
+	Price     int
+	Discount  *int
+	CreatedAt time.Time
+}
+
+func newProductRepository(t *testing.T) (*Repository[product], *TxManager) {
+	t.Helper()
+	tm, db := newTxManager(t, TxConfig{})
+	if err := db.AutoMigrate(&product{}); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewRepository[product](tm, RepositoryConfig{
+		Fields:      []string{"name", "price", "discount", "created_at"},
+		DefaultSort: []Sort{{Field: "created_at", Desc: true}},
+		MaxLimit:    5,
+	})
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ten := 10
+	for i := 1; i <= 8; i++ {
+		p := product{SKU: fmt.Sprintf("sku-%d", i), Name: fmt.Sprintf("item %d", i), Price: i * 100, CreatedAt: base.Add(time.Duration(i%4) * time.Hour)}
+		if i%2 == 0 {
+			p.Discount = &ten
+		}
+		if err := repo.Create(context.Background(), &p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repo, tm
+}
+
+func productIDs(items []product) []uint {
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids
+}
+
+// TestRepositoryCRUD tests Get, Create, Update, Upsert and Delete
+func TestRepositoryCRUD(t *testing.T) {
+	repo, _ := newProductRepository(t)
+	ctx := context.Background()
+
+	p, err := repo.Get(ctx, 3)
+	if err != nil || p.Name != "item 3" {
+		t.Fatalf("Get(3) = %+v, %v", p, err)
+	}
+	if _, err := repo.Get(ctx, 99); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Get of a missing item should return ErrRecordNotFound, got %v", err)
+	}
+
+	p.Price = 350
+	if err := repo.Update(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if updated, _ := repo.Get(ctx, 3); updated.Price != 350 {
+		t.Errorf("Update should save the price, got %d", updated.Price)
+	}
+	if err := repo.Update(ctx, &product{ID: 99, Name: "ghost"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Update of a missing item should return ErrRecordNotFound, got %v", err)
+	}
+
+	if err := repo.Upsert(ctx, &product{SKU: "sku-3", Name: "renamed", Price: 1}, "sku"); err != nil {
+		t.Fatal(err)
+	}
+	if upserted, _ := repo.Get(ctx, 3); upserted.Name != "renamed" {
+		t.Errorf("Upsert should update the conflicting item, got %q", upserted.Name)
+	}
+	fresh := product{SKU: "sku-new", Name: "new"}
+	if err := repo.Upsert(ctx, &fresh, "sku"); err != nil || fresh.ID == 0 {
+		t.Errorf("Upsert should insert a new item, got %+v, %v", fresh, err)
+	}
+
+	if err := repo.Delete(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, 3); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("second Delete should return ErrRecordNotFound, got %v", err)
+	}
+}
+
+// TestRepositoryUpdateUnchanged tests that Update succeeds when the
+// database reports no affected rows for an unchanged item, as MySQL does
+func TestRepositoryUpdateUnchanged(t *testing.T) {
+	repo, tm := newProductRepository(t)
+	ctx := context.Background()
+	err := tm.db.Callback().Update().After("gorm:update").Register("test:unchanged", func(db *gorm.DB) {
+		db.RowsAffected = 0
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := repo.Get(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(ctx, p); err != nil {
+		t.Errorf("Update of an unchanged item should succeed, got %v", err)
+	}
+	if err := repo.Update(ctx, &product{ID: 99, Name: "ghost"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Update of a missing item should return ErrRecordNotFound, got %v", err)
+	}
+}
+
+// TestRepositoryJoinsTransaction tests that the repository uses the transaction of the context
+func TestRepositoryJoinsTransaction(t *testing.T) {
+	repo, tm := newProductRepository(t)
+	ctx := context.Background()
+
+	_ = tm.WithinTx(ctx, func(ctx context.Context) error {
+		if err := repo.Delete(ctx, 1); err != nil {
+			return err
+		}
+		return errors.New("abort")
+	})
+	if _, err := repo.Get(ctx, 1); err != nil {
+		t.Errorf("the delete should be rolled back with the transaction: %v", err)
+	}
+}
+
+// TestRepositoryListOffset tests filtering, sorting and offset pagination
+func TestRepositoryListOffset(t *testing.T) {
+	repo, _ := newProductRepository(t)
+	ctx := context.Background()
+
+	page, err := repo.List(ctx, Query{
+		Filters: []Filter{{Field: "price", Op: OpGte, Value: "300"}},
+		Sort:    []Sort{{Field: "price", Desc: true}},
+		Page:    2,
+		Limit:   4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 6 || page.Page != 2 || fmt.Sprint(productIDs(page.Items)) != "[4 3]" {
+		t.Errorf("unexpected page %+v", page)
+	}
+
+	page, err = repo.List(ctx, Query{Limit: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Limit != 5 || fmt.Sprint(productIDs(page.Items)) != "[3 7 2 6 1]" {
+		t.Errorf("default sort by created_at desc then id, capped at 5, got %v limit %d", productIDs(page.Items), page.Limit)
+	}
+
+	for _, tc := range []struct {
+		filter Filter
+		want   string
+	}{
+		{Filter{Field: "name", Op: OpLike, Value: "m 5"}, "[5]"},
+		{Filter{Field: "name", Op: OpLike, Value: "%"}, "[]"},
+		{Filter{Field: "price", Op: OpIn, Value: "100,800"}, "[1 8]"},
+		{Filter{Field: "discount", Op: OpNull, Value: "true"}, "[1 3 5 7]"},
+		{Filter{Field: "name", Value: "item 2"}, "[2]"},
+		{Filter{Field: "created_at", Op: OpLt, Value: "2026-01-01T01:00:00Z"}, "[4 8]"},
+	} {
+		page, err := repo.List(ctx, Query{Filters: []Filter{tc.filter}, Sort: []Sort{{Field: "price"}}})
+		if err != nil {
+			t.Errorf("filter %+v failed: %v", tc.filter, err)
+			continue
+		}
+		if got := fmt.Sprint(productIDs(page.Items)); got != tc.want {
+			t.Errorf("filter %+v = %s, want %s", tc.filter, got, tc.want)
+		}
+	}
+}
+
+// TestRepositoryListKeyset tests cursor pagination across pages
+func TestRepositoryListKeyset(t *testing.T) {
+	repo, _ := newProductRepository(t)
+	ctx := context.Background()
+
+	var ids []uint
+	query := Query{Keyset: true, Limit: 3}
+	pages := 0
+	for {
+		page, err := repo.List(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		ids = append(ids, productIDs(page.Items)...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	if pages != 3 || fmt.Sprint(ids) != "[3 7 2 6 1 5 4 8]" {
+		t.Errorf("keyset pages should follow the default sort, got %v in %d pages", ids, pages)
+	}
+
+	_, err := repo.List(ctx, Query{Keyset: true, Cursor: query.Cursor, Sort: []Sort{{Field: "price"}}})
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("a cursor of another sort order should be rejected, got %v", err)
+	}
+	if _, err := repo.List(ctx, Query{Keyset: true, Cursor: "garbage"}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("a malformed cursor should be rejected, got %v", err)
+	}
+}
+
+// TestRepositoryRejectsUnsafeQueries tests the field whitelist and value validation
+func TestRepositoryRejectsUnsafeQueries(t *testing.T) {
+	repo, _ := newProductRepository(t)
+	ctx := context.Background()
+
+	for _, q := range []Query{
+		{Sort: []Sort{{Field: "sku"}}},
+		{Sort: []Sort{{Field: "name; DROP TABLE products"}}},
+		{Filters: []Filter{{Field: "sku", Value: "sku-1"}}},
+		{Filters: []Filter{{Field: "price", Value: "cheap"}}},
+		{Filters: []Filter{{Field: "price", Op: OpLike, Value: "1"}}},
+		{Filters: []Filter{{Field: "price", Op: "regex", Value: "1"}}},
+		{Filters: []Filter{{Field: "discount", Op: OpNull, Value: "maybe"}}},
+		{Page: math.MaxInt},
+	} {
+		if _, err := repo.List(ctx, q); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("List(%+v) should return ErrInvalidQuery, got %v", q, err)
+		}
+	}
+
+	bad := NewRepository[product](repo.tx, RepositoryConfig{Fields: []string{"missing"}})
+	if _, err := bad.List(ctx, Query{}); err == nil || errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("whitelisting an unknown column should be a configuration error, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package fxgorm
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RetryConfig holds connection retry configuration
+type RetryConfig struct {
+	// MaxAttempts bounds the connection attempts on start, which also give
+	// up when the start context is done; 1 disables retries
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// InitialInterval is the wait after the first failed attempt
+	InitialInterval time.Duration `mapstructure:"initial_interval"`
+	// MaxInterval caps the wait between attempts
+	MaxInterval time.Duration `mapstructure:"max_interval"`
+	// Multiplier grows the wait after each failed attempt
+	Multiplier float64 `mapstructure:"multiplier"`
+	// HealthCheckInterval is how often the connection is checked once
+	// connected
+	HealthCheckInterval time.Duration `mapstructure:"health_interval"`
+}
+
+// backoff returns the wait before the given retry, counting from 1, with
+// jitter so that instances restarting together spread their attempts
+func (rc RetryConfig) backoff(retry int) time.Duration {
+	wait := float64(rc.InitialInterval) * math.Pow(rc.Multiplier, float64(retry-1))
+	if wait > float64(rc.MaxInterval) || math.IsInf(wait, 0) {
+		wait = float64(rc.MaxInterval)
+	}
+	half := time.Duration(wait / 2)
+	return half + rand.N(half+1)
+}
+
+// ConnectionStats reports connection attempts and losses of a database
+type ConnectionStats struct {
+	// Healthy reports whether the last health check succeeded
+	Healthy bool
+	// ConnectAttempts counts the attempts to connect on start
+	ConnectAttempts uint64
+	// ConnectionLosses counts failed health checks of a healthy connection
+	ConnectionLosses uint64
+	// ReconnectAttempts counts the checks while the connection was lost
+	ReconnectAttempts uint64
+	// Reconnects counts recoveries from lost connections
+	Reconnects uint64
+	// LastError is the last connection error
+	LastError error
+}
+
+// connectionStats holds the counters behind ConnectionStats
+type connectionStats struct {
+	healthy           atomic.Bool
+	connectAttempts   atomic.Uint64
+	connectionLosses  atomic.Uint64
+	reconnectAttempts atomic.Uint64
+	reconnects        atomic.Uint64
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+func (s *connectionStats) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr = err
+}
+
+func (s *connectionStats) snapshot() ConnectionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ConnectionStats{
+		Healthy:           s.healthy.Load(),
+		ConnectAttempts:   s.connectAttempts.Load(),
+		ConnectionLosses:  s.connectionLosses.Load(),
+		ReconnectAttempts: s.reconnectAttempts.Load(),
+		Reconnects:        s.reconnects.Load(),
+		LastError:         s.lastErr,
+	}
+}
+
+// connectionMonitor pings a connected database, retrying with backoff
+// after a failure until the connection recovers. database/sql discards
+// broken connections and dials new ones, so a successful ping means the
+// pool recovered.
+type connectionMonitor struct {
+	logger *zap.Logger
+	ping   func(context.Context) error
+	retry  RetryConfig
+	stats  *connectionStats
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// start checks the connection every health check interval until close
+func (m *connectionMonitor) start() {
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.retry.HealthCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-m.stop:
+				return
+			}
+			err := m.check()
+			if err == nil {
+				continue
+			}
+			if !m.recover(err) {
+				return
+			}
+			ticker.Reset(m.retry.HealthCheckInterval)
+		}
+	}()
+}
+
+// recover retries until a ping succeeds, returning false when closed first
+func (m *connectionMonitor) recover(err error) bool {
+	m.stats.connectionLosses.Add(1)
+	m.stats.healthy.Store(false)
+	m.logger.Error("database connection lost", zap.Error(err))
+
+	for retry := 1; ; retry++ {
+		wait := m.retry.backoff(retry)
+		select {
+		case <-time.After(wait):
+		case <-m.stop:
+			return false
+		}
+		m.stats.reconnectAttempts.Add(1)
+		if err := m.check(); err != nil {
+			m.logger.Warn("database reconnection attempt failed", zap.Int("attempt", retry), zap.Error(err))
+			continue
+		}
+		m.stats.reconnects.Add(1)
+		m.logger.Info("database connection restored", zap.Int("attempts", retry))
+		return true
+	}
+}
+
+// check pings the database once, bounded by the health check interval
+func (m *connectionMonitor) check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.retry.HealthCheckInterval)
+	defer cancel()
+	if err := m.ping(ctx); err != nil {
+		m.stats.fail(err)
+		return err
+	}
+	m.stats.healthy.Store(true)
+	return nil
+}
+
+// close stops the health checks
+func (m *connectionMonitor) close() {
+	close(m.stop)
+	<-m.done
+}
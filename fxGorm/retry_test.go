@@ -0,0 +1,200 @@
+package fxgorm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"gorm.io/gorm/logger"
+)
+
+// unreachableConfig returns a SQLite configuration whose directory does
+// not exist yet, so connecting fails until it is created
+func unreachableConfig(t *testing.T, retry RetryConfig) (*GormConfig, string) {
+	dir := filepath.Join(t.TempDir(), "data")
+	return &GormConfig{
+		Database: DatabaseConfig{
+			Type: SQLite,
+			File: filepath.Join(dir, "test.db"),
+		},
+		Log:   LogConfig{Level: logger.Silent},
+		Retry: retry,
+	}, dir
+}
+
+// TestConnectRetries tests that Connect retries until the database is reachable
+func TestConnectRetries(t *testing.T) {
+	config, dir := unreachableConfig(t, RetryConfig{InitialInterval: 50 * time.Millisecond, MaxInterval: 100 * time.Millisecond})
+	manager := NewDatabaseManager(config)
+	defer manager.Close()
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_ = os.MkdirAll(dir, 0o755)
+	}()
+
+	if err := manager.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect should succeed once the database is reachable: %v", err)
+	}
+	stats := manager.ConnectionStats()
+	if stats.ConnectAttempts < 2 {
+		t.Errorf("Connect should retry, got %d attempts", stats.ConnectAttempts)
+	}
+	if !stats.Healthy || stats.LastError == nil {
+		t.Errorf("stats should be healthy and keep the last error, got %+v", stats)
+	}
+}
+
+// TestConnectGivesUp tests that Connect stops at the attempt limit and the context deadline
+func TestConnectGivesUp(t *testing.T) {
+	config, _ := unreachableConfig(t, RetryConfig{MaxAttempts: 3, InitialInterval: time.Millisecond})
+	manager := NewDatabaseManager(config)
+	err := manager.Connect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("Connect should give up after 3 attempts, got %v", err)
+	}
+	if attempts := manager.ConnectionStats().ConnectAttempts; attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+
+	config, _ = unreachableConfig(t, RetryConfig{MaxAttempts: 100, InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second})
+	manager = NewDatabaseManager(config)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	err = manager.Connect(ctx)
+	if err == nil || !strings.Contains(err.Error(), "before the start timeout") || !strings.Contains(err.Error(), "unable to open database file") {
+		t.Errorf("Connect should give up before the deadline with the last failure, got %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 600*time.Millisecond {
+		t.Errorf("Connect should stop by the deadline, took %s", elapsed)
+	}
+}
+
+// TestBackoff tests that waits grow exponentially up to the maximum with jitter
+func TestBackoff(t *testing.T) {
+	retry := RetryConfig{InitialInterval: 100 * time.Millisecond, MaxInterval: time.Second, Multiplier: 2}
+	for _, tc := range []struct {
+		retry int
+		max   time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{10, time.Second},
+		{5000, time.Second},
+	} {
+		for range 20 {
+			if wait := retry.backoff(tc.retry); wait < tc.max/2 || wait > tc.max {
+				t.Errorf("backoff(%d) = %s, want between %s and %s", tc.retry, wait, tc.max/2, tc.max)
+			}
+		}
+	}
+}
+
+// TestConnectionMonitor tests that a lost connection is detected and recovered
+func TestConnectionMonitor(t *testing.T) {
+	var failing atomic.Bool
+	stats := &connectionStats{}
+	stats.healthy.Store(true)
+	monitor := &connectionMonitor{
+		logger: zap.NewNop(),
+		ping: func(context.Context) error {
+			if failing.Load() {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+		retry: RetryConfig{InitialInterval: 10 * time.Millisecond, MaxInterval: 20 * time.Millisecond, Multiplier: 2, HealthCheckInterval: 20 * time.Millisecond},
+		stats: stats,
+	}
+	monitor.start()
+	defer monitor.close()
+
+	failing.Store(true)
+	waitFor(t, func() bool { return stats.reconnectAttempts.Load() >= 2 })
+	snapshot := stats.snapshot()
+	if snapshot.Healthy || snapshot.ConnectionLosses != 1 || snapshot.LastError == nil {
+		t.Errorf("the lost connection should be recorded once, got %+v", snapshot)
+	}
+
+	failing.Store(false)
+	waitFor(t, func() bool { return stats.reconnects.Load() == 1 })
+	if snapshot := stats.snapshot(); !snapshot.Healthy || snapshot.ConnectionLosses != 1 {
+		t.Errorf("the connection should recover, got %+v", snapshot)
+	}
+}
+
+// TestCloseStopsMonitor tests that closing the manager stops the health checks
+func TestCloseStopsMonitor(t *testing.T) {
+	manager := NewDatabaseManager(&GormConfig{
+		Database: DatabaseConfig{
+			Type: SQLite,
+			File: filepath.Join(t.TempDir(), "test.db"),
+		},
+		Log: LogConfig{Level: logger.Silent},
+	})
+	if err := manager.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stats := manager.ConnectionStats(); !stats.Healthy || stats.ConnectAttempts != 1 {
+		t.Errorf("unexpected stats after connect %+v", stats)
+	}
+	if err := manager.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if manager.monitor != nil || manager.ConnectionStats().Healthy {
+		t.Error("Close should stop the monitor and report unhealthy")
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestRetryConfigDurations tests that intervals accept duration strings,
+// keep the legacy units for bare numbers and must not be negative
+func TestRetryConfigDurations(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("database.type", "sqlite")
+	viper.Set("database.file", filepath.Join(t.TempDir(), "test.db"))
+	viper.Set("database.retry.initial_interval", "500ms")
+	viper.Set("database.retry.max_interval", 2000)
+	viper.Set("database.retry.health_interval", "15s")
+	viper.Set("database.replica_health_interval", "30")
+
+	config := NewGormConfig(newTestConfig())
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate should accept the durations: %v", err)
+	}
+	if config.Retry.InitialInterval != 500*time.Millisecond || config.Retry.MaxInterval != 2*time.Second {
+		t.Errorf("retry intervals should be 500ms and 2s, got %+v", config.Retry)
+	}
+	if config.Retry.HealthCheckInterval != 15*time.Second || config.Replication.HealthCheckInterval != 30*time.Second {
+		t.Errorf("health intervals should be 15s and 30s, got %s and %s", config.Retry.HealthCheckInterval, config.Replication.HealthCheckInterval)
+	}
+
+	viper.Set("database.retry.health_interval", "soon")
+	if err := NewGormConfig(newTestConfig()).Validate(); err == nil || !strings.Contains(err.Error(), "retry.health_interval") {
+		t.Errorf("Validate should reject an invalid duration, got %v", err)
+	}
+
+	viper.Set("database.retry.health_interval", "-1s")
+	if err := NewGormConfig(newTestConfig()).Validate(); err == nil || !strings.Contains(err.Error(), "must not be negative") {
+		t.Errorf("Validate should reject a negative interval, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package fxgorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+// TxConfig holds transaction configuration
+type TxConfig struct {
+	// Isolation is the default isolation level: read_uncommitted,
+	// read_committed, repeatable_read, snapshot or serializable. Empty
+	// uses the database default.
+	Isolation string `mapstructure:"isolation"`
+	// MaxRetries retries transactions failing with a serialization error
+	// or deadlock; -1 disables retries
+	MaxRetries int `mapstructure:"max_retries"`
+	// RetryInterval is the wait before the first retry, doubled after each
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
+}
+
+// isolationLevels maps configured isolation levels to database/sql levels
+var isolationLevels = map[string]sql.IsolationLevel{
+	"":                 sql.LevelDefault,
+	"read_uncommitted": sql.LevelReadUncommitted,
+	"read_committed":   sql.LevelReadCommitted,
+	"repeatable_read":  sql.LevelRepeatableRead,
+	"snapshot":         sql.LevelSnapshot,
+	"serializable":     sql.LevelSerializable,
+}
+
+// parseIsolation parses a configured isolation level
+func parseIsolation(level string) (sql.IsolationLevel, error) {
+	isolation, ok := isolationLevels[strings.ToLower(level)]
+	if !ok {
+		return sql.LevelDefault, fmt.Errorf("unsupported isolation level: %s", level)
+	}
+	return isolation, nil
+}
+
+// TxOption customizes a single transaction
+type TxOption func(*txOptions)
+
+type txOptions struct {
+	sql        sql.TxOptions
+	maxRetries int
+}
+
+// WithIsolation runs the transaction at the given isolation level
+func WithIsolation(level sql.IsolationLevel) TxOption {
+	return func(o *txOptions) {
+		o.sql.Isolation = level
+	}
+}
+
+// ReadOnly runs a read-only transaction
+func ReadOnly() TxOption {
+	return func(o *txOptions) {
+		o.sql.ReadOnly = true
+	}
+}
+
+// WithRetries overrides the number of retries on serialization errors
+// and deadlocks
+func WithRetries(retries int) TxOption {
+	return func(o *txOptions) {
+		o.maxRetries = retries
+	}
+}
+
+// txKey stores the transaction of a database in a context
+type txKey struct {
+	db *gorm.DB
+}
+
+// TxManager runs functions in transactions carried by their context, so
+// repositories and services share a transaction without passing it along
+type TxManager struct {
+	db     *gorm.DB
+	config TxConfig
+}
+
+// NewTxManager creates a transaction manager for the default database
+func NewTxManager(db *gorm.DB, config *GormConfig) *TxManager {
+	return NewTxManagerWithConfig(db, config.Tx)
+}
+
+// NewTxManagerWithConfig creates a transaction manager for db, e.g. a
+// named database
+func NewTxManagerWithConfig(db *gorm.DB, config TxConfig) *TxManager {
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+	if config.RetryInterval == 0 {
+		config.RetryInterval = 50 * time.Millisecond
+	}
+	return &TxManager{db: db, config: config}
+}
+
+// DB returns the transaction stored in ctx by WithinTx, or the pooled
+// database otherwise, bound to ctx either way
+func (m *TxManager) DB(ctx context.Context) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{m.db}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return m.db.WithContext(ctx)
+}
+
+// InTx reports whether ctx carries a transaction of this manager
+func (m *TxManager) InTx(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{m.db}).(*gorm.DB)
+	return ok
+}
+
+// WithinTx runs fn in a transaction, committing when it returns nil and
+// rolling back otherwise. Use DB(ctx) inside fn to join the transaction.
+// Nested calls run in a savepoint of the outer transaction, ignoring the
+// options. The outermost call is retried on serialization errors and
+// deadlocks, so fn must be safe to run again.
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error, opts ...TxOption) error {
+	if tx, ok := ctx.Value(txKey{m.db}).(*gorm.DB); ok {
+		return tx.WithContext(ctx).Transaction(func(nested *gorm.DB) error {
+			return fn(context.WithValue(ctx, txKey{m.db}, nested))
+		})
+	}
+
+	isolation, err := parseIsolation(m.config.Isolation)
+	if err != nil {
+		return err
+	}
+	options := txOptions{sql: sql.TxOptions{Isolation: isolation}, maxRetries: m.config.MaxRetries}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	var txOpts *sql.TxOptions
+	if options.sql != (sql.TxOptions{}) {
+		txOpts = &options.sql
+	}
+
+	backoff := RetryConfig{InitialInterval: m.config.RetryInterval, MaxInterval: time.Second, Multiplier: 2}
+	for retry := 1; ; retry++ {
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(context.WithValue(ctx, txKey{m.db}, tx))
+		}, txOpts)
+		if err == nil || !IsRetryable(err) || retry > options.maxRetries {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff.backoff(retry)):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// IsRetryable reports whether err is a serialization failure or deadlock
+// after which the transaction may succeed when run again
+func IsRetryable(err error) bool {
+	// PostgreSQL: serialization_failure and deadlock_detected
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		switch state.SQLState() {
+		case "40001", "40P01":
+			return true
+		}
+	}
+	// MySQL: deadlock and lock wait timeout
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1213 || mysqlErr.Number == 1205
+	}
+	// SQL Server: deadlock victim
+	var mssqlErr interface{ SQLErrorNumber() int32 }
+	if errors.As(err, &mssqlErr) {
+		return mssqlErr.SQLErrorNumber() == 1205
+	}
+	// SQLite: database or table locked
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package fxgorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type account struct {
+	ID      uint
+	Balance int
+}
+
+// serializationError mimics the PostgreSQL driver error of a serialization failure
+type serializationError struct{}
+
+func (serializationError) Error() string    { return "could not serialize access" }
+func (serializationError) SQLState() string { return "40001" }
+
+func newTxManager(t *testing.T, config TxConfig) (*TxManager, *gorm.DB) {
+	t.Helper()
+	manager := NewDatabaseManager(&GormConfig{
+		Database: DatabaseConfig{
+			Type: SQLite,
+			File: filepath.Join(t.TempDir(), "test.db"),
+		},
+		Log: LogConfig{Level: logger.Silent},
+	})
+	if err := manager.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { manager.Close() })
+	db := manager.GetDB()
+	if err := db.AutoMigrate(&account{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewTxManagerWithConfig(db, config), db
+}
+
+func countAccounts(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+	var count int64
+	if err := db.Model(&account{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// TestWithinTx tests that the transaction is shared through the context and committed or rolled back
+func TestWithinTx(t *testing.T) {
+	tm, db := newTxManager(t, TxConfig{})
+	ctx := context.Background()
+
+	if tm.InTx(ctx) {
+		t.Error("a plain context should not carry a transaction")
+	}
+	err := tm.WithinTx(ctx, func(ctx context.Context) error {
+		if !tm.InTx(ctx) {
+			t.Error("the context should carry the transaction")
+		}
+		return tm.DB(ctx).Create(&account{Balance: 10}).Error
+	})
+	if err != nil {
+		t.Fatalf("WithinTx failed: %v", err)
+	}
+	if count := countAccounts(t, db); count != 1 {
+		t.Errorf("the transaction should be committed, got %d accounts", count)
+	}
+
+	failure := errors.New("insufficient funds")
+	err = tm.WithinTx(ctx, func(ctx context.Context) error {
+		if err := tm.DB(ctx).Create(&account{Balance: 20}).Error; err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("WithinTx should return the error of fn, got %v", err)
+	}
+	if count := countAccounts(t, db); count != 1 {
+		t.Errorf("the transaction should be rolled back, got %d accounts", count)
+	}
+}
+
+// TestNestedTx tests that nested calls roll back to a savepoint
+func TestNestedTx(t *testing.T) {
+	tm, db := newTxManager(t, TxConfig{})
+	ctx := context.Background()
+
+	err := tm.WithinTx(ctx, func(ctx context.Context) error {
+		if err := tm.DB(ctx).Create(&account{Balance: 10}).Error; err != nil {
+			return err
+		}
+		nested := tm.WithinTx(ctx, func(ctx context.Context) error {
+			if err := tm.DB(ctx).Create(&account{Balance: 20}).Error; err != nil {
+				return err
+			}
+			return errors.New("nested failure")
+		})
+		if nested == nil {
+			t.Error("the nested call should return its error")
+		}
+		return tm.WithinTx(ctx, func(ctx context.Context) error {
+			return tm.DB(ctx).Create(&account{Balance: 30}).Error
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithinTx failed: %v", err)
+	}
+
+	var balances []int
+	db.Model(&account{}).Order("balance").Pluck("balance", &balances)
+	if fmt.Sprint(balances) != "[10 30]" {
+		t.Errorf("only the failed nested call should be rolled back, got %v", balances)
+	}
+}
+
+// TestTxRetries tests retries on serialization failures
+func TestTxRetries(t *testing.T) {
+	tm, db := newTxManager(t, TxConfig{MaxRetries: 2, RetryInterval: 1})
+	ctx := context.Background()
+
+	calls := 0
+	err := tm.WithinTx(ctx, func(ctx context.Context) error {
+		calls++
+		if err := tm.DB(ctx).Create(&account{Balance: calls}).Error; err != nil {
+			return err
+		}
+		if calls < 3 {
+			return fmt.Errorf("transfer failed: %w", serializationError{})
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("WithinTx should succeed on the third call, got %d calls, %v", calls, err)
+	}
+	if count := countAccounts(t, db); count != 1 {
+		t.Errorf("failed attempts should be rolled back, got %d accounts", count)
+	}
+
+	calls = 0
+	err = tm.WithinTx(ctx, func(ctx context.Context) error {
+		calls++
+		return serializationError{}
+	})
+	if !IsRetryable(err) || calls != 3 {
+		t.Errorf("WithinTx should give up after 2 retries, got %d calls, %v", calls, err)
+	}
+
+	calls = 0
+	_ = tm.WithinTx(ctx, func(ctx context.Context) error {
+		calls++
+		return serializationError{}
+	}, WithRetries(-1))
+	if calls != 1 {
+		t.Errorf("WithRetries(-1) should disable retries, got %d calls", calls)
+	}
+
+	calls = 0
+	_ = tm.WithinTx(ctx, func(ctx context.Context) error {
+		calls++
+		return errors.New("not retryable")
+	})
+	if calls != 1 {
+		t.Errorf("other errors should not be retried, got %d calls", calls)
+	}
+}
+
+// TestTxOptions tests transaction options and isolation validation
+func TestTxOptions(t *testing.T) {
+	tm, _ := newTxManager(t, TxConfig{})
+	err := tm.WithinTx(context.Background(), func(ctx context.Context) error {
+		var accounts []account
+		return tm.DB(ctx).Find(&accounts).Error
+	}, ReadOnly(), WithIsolation(sql.LevelSerializable))
+	if err != nil {
+		t.Errorf("read-only serializable transaction failed: %v", err)
+	}
+
+	config := &GormConfig{
+		Database: DatabaseConfig{Type: SQLite, File: "test.db"},
+		Tx:       TxConfig{Isolation: "eventual"},
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("unknown isolation levels should be rejected")
+	}
+}
+
+// TestIsRetryable tests the detection of retryable driver errors
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{serializationError{}, true},
+		{&mysql.MySQLError{Number: 1213}, true},
+		{&mysql.MySQLError{Number: 1062}, false},
+		{fmt.Errorf("wrapped: %w", sqlite3.Error{Code: sqlite3.ErrBusy}), true},
+		{sqlite3.Error{Code: sqlite3.ErrConstraint}, false},
+		{gorm.ErrRecordNotFound, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package fxgorm
 
 import (
+	"sync"
+	"sync/atomic"
 	"time"
 
-	fxconfig "github.com/UTOL-s/module/fxConfig"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -20,17 +23,25 @@ const (
 
 // DatabaseConfig holds database-specific configuration
 type DatabaseConfig struct {
-	Type      DatabaseType `mapstructure:"type"`
-	Host      string       `mapstructure:"host"`
-	Port      int          `mapstructure:"port"`
-	User      string       `mapstructure:"user"`
-	Password  string       `mapstructure:"password"`
-	DBName    string       `mapstructure:"dbname"`
-	SSLMode   string       `mapstructure:"sslmode"`
-	Charset   string       `mapstructure:"charset"`
-	ParseTime bool         `mapstructure:"parse_time"`
-	Loc       string       `mapstructure:"loc"`
-	File      string       `mapstructure:"file"` // For SQLite
+	Type            DatabaseType      `mapstructure:"type"`
+	DSN             string            `mapstructure:"dsn"` // used as is, replacing the settings below
+	Host            string            `mapstructure:"host"`
+	Port            int               `mapstructure:"port"`
+	User            string            `mapstructure:"user"`
+	Password        string            `mapstructure:"password"`
+	DBName          string            `mapstructure:"dbname"`
+	SSLMode         string            `mapstructure:"sslmode"`
+	SSLRootCert     string            `mapstructure:"sslrootcert"`
+	SSLCert         string            `mapstructure:"sslcert"`
+	SSLKey          string            `mapstructure:"sslkey"`
+	ConnectTimeout  time.Duration     `mapstructure:"connect_timeout"`
+	ApplicationName string            `mapstructure:"application_name"`
+	SearchPath      string            `mapstructure:"search_path"` // For PostgreSQL
+	Charset         string            `mapstructure:"charset"`
+	ParseTime       bool              `mapstructure:"parse_time"`
+	Loc             string            `mapstructure:"loc"`
+	File            string            `mapstructure:"file"`   // For SQLite
+	Params          map[string]string `mapstructure:"params"` // passed to the driver as is
 }
 
 // PoolConfig holds connection pool configuration
@@ -45,32 +56,71 @@ type PoolConfig struct {
 type LogConfig struct {
 	Level                     logger.LogLevel `mapstructure:"level"`
 	SlowThreshold             time.Duration   `mapstructure:"slow_threshold"`
-	Colorful                  bool            `mapstructure:"colorful"`
+	Colorful                  bool            `mapstructure:"colorful"` // ignored, the zap encoder decides
 	IgnoreRecordNotFoundError bool            `mapstructure:"ignore_record_not_found_error"`
+	LogParams                 bool            `mapstructure:"log_params"` // parameters are redacted otherwise
+	Sampling                  SamplingConfig  `mapstructure:"sampling"`
 }
 
 // GormConfig holds the complete GORM configuration
 type GormConfig struct {
-	Database DatabaseConfig `mapstructure:"database"`
-	Pool     PoolConfig     `mapstructure:"pool"`
-	Log      LogConfig      `mapstructure:"log"`
-	Debug    bool           `mapstructure:"debug"`
+	Database    DatabaseConfig `mapstructure:"database"`
+	Pool        PoolConfig     `mapstructure:"pool"`
+	Log         LogConfig      `mapstructure:"log"`
+	Replication ReplicaConfig  `mapstructure:",squash"`
+	Retry       RetryConfig    `mapstructure:"retry"`
+	Tx          TxConfig       `mapstructure:"tx"`
+	Debug       bool           `mapstructure:"debug"`
+
+	// replicasErr records a replicas entry that could not be decoded
+	replicasErr error
+	// paramsErr records a params map that could not be decoded
+	paramsErr error
+	// durationErr records durations that could not be parsed
+	durationErr error
 }
 
 // Params holds the dependency injection parameters
 type Params struct {
-	Config *fxconfig.Config
+	fx.In
+	Lifecycle fx.Lifecycle
+	Config    *GormConfig
+	Logger    *zap.Logger `optional:"true"`
 }
 
-// DatabaseManager handles database operations
+// DatabaseManager handles database operations. The *gorm.DB it hands out
+// runs its statements on the connection opened by Connect, so it can be
+// injected before the app starts; until then its queries fail with
+// ErrNotConnected.
 type DatabaseManager struct {
+	mu     sync.RWMutex
 	config *GormConfig
 	db     *gorm.DB
+	// conn is the connection opened by Connect, nil until then
+	conn      atomic.Pointer[gorm.DB]
+	connected bool
+	replicas  *replicaSet
+	primary   []interface{}
+	monitor   *connectionMonitor
+	stats     connectionStats
+	logger    *zap.Logger
 }
 
-// NewDatabaseManager creates a new database manager
+// NewDatabaseManager creates a new database manager that does not log
 func NewDatabaseManager(config *GormConfig) *DatabaseManager {
-	return &DatabaseManager{
+	return NewDatabaseManagerWithLogger(config, nil)
+}
+
+// NewDatabaseManagerWithLogger creates a database manager logging queries
+// and connection events to logger
+func NewDatabaseManagerWithLogger(config *GormConfig, logger *zap.Logger) *DatabaseManager {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	dm := &DatabaseManager{
 		config: config,
+		logger: logger,
 	}
+	dm.db = newManagedDB(dm)
+	return dm
 }